@@ -1,17 +1,60 @@
 package main
 
 import (
+	"context"
+	"expvar"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/codepnw/microservice-ecommerce/db"
 	"github.com/codepnw/microservice-ecommerce/ecom-api/handler"
 	"github.com/codepnw/microservice-ecommerce/ecom-api/server"
 	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/ecom-api/worker"
+	"github.com/codepnw/microservice-ecommerce/mailer"
+	"github.com/codepnw/microservice-ecommerce/oidc"
+	"github.com/codepnw/microservice-ecommerce/payment"
+	"github.com/codepnw/microservice-ecommerce/shipping"
+	"github.com/codepnw/microservice-ecommerce/tax"
+	"github.com/codepnw/microservice-ecommerce/token"
+	"github.com/codepnw/microservice-ecommerce/utils"
 	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
 )
 
-const envPath = "dev.env"
+const (
+	envPath              = "dev.env"
+	defaultTokenIssuer   = "ecom-api"
+	defaultTokenAudience = "ecom-api"
+
+	defaultSessionGCInterval  = time.Hour
+	defaultSessionGCRetention = 7 * 24 * time.Hour
+	defaultSessionGCBatchSize = 1000
+
+	defaultPurgeInterval  = 24 * time.Hour
+	defaultPurgeRetention = 30 * 24 * time.Hour
+	defaultPurgeBatchSize = 500
+
+	defaultIdempotencyKeyTTL         = 24 * time.Hour
+	defaultIdempotencyPurgeInterval  = time.Hour
+	defaultIdempotencyPurgeBatchSize = 1000
+
+	defaultMailFrom = "no-reply@localhost"
+
+	defaultPasswordMinLength = 8
+	defaultPasswordMaxLength = 256
+	// bcrypt only uses the first 72 bytes of a password
+	bcryptMaxPasswordBytes = 72
+
+	defaultMFAIssuer = "ecom-api"
+)
 
 func main() {
 	if err := godotenv.Load(envPath); err != nil {
@@ -26,9 +69,255 @@ func main() {
 	log.Println("successfully connected to database")
 
 	st := store.NewMySQLStore(db.GetDB())
-	srv := server.NewServer(st)
-	hdl := handler.NewHandler(srv, os.Getenv("JWT_SECRET"))
+	shippingMethods, err := newShippingMethods()
+	if err != nil {
+		log.Fatalf("error loading shipping methods: %v", err)
+	}
+	taxes, err := tax.NewEngine(os.Getenv("TAX_RULES_FILE"))
+	if err != nil {
+		log.Fatalf("error loading tax rules: %v", err)
+	}
+	paymentProviders, err := newPaymentProviders()
+	if err != nil {
+		log.Fatalf("error configuring payment providers: %v", err)
+	}
+	srv := server.NewServer(st, server.Config{
+		ShippingMethods:  shippingMethods,
+		Taxes:            taxes,
+		PaymentProviders: paymentProviders,
+
+		IdempotencyKeyTTL: getEnvDuration("IDEMPOTENCY_KEY_TTL", defaultIdempotencyKeyTTL),
+	})
+	keys, err := token.NewKeySet(os.Getenv("JWT_SECRET"), os.Getenv("JWT_KEYS_DIR"), os.Getenv("JWT_ACTIVE_KID"))
+	if err != nil {
+		log.Fatalf("error loading token keys: %v", err)
+	}
+	go reloadOnHangup(keys, taxes)
+
+	tokenMaker := token.NewJWTMaker(
+		keys,
+		getEnv("JWT_ISSUER", defaultTokenIssuer),
+		getEnv("JWT_AUDIENCE", defaultTokenAudience),
+	)
+	mail, err := newMailer()
+	if err != nil {
+		log.Fatalf("error creating mailer: %v", err)
+	}
+
+	passwords := utils.NewPasswordPolicy(
+		getEnvInt("PASSWORD_MIN_LENGTH", defaultPasswordMinLength),
+		getEnvInt("PASSWORD_MAX_LENGTH", defaultPasswordMaxLength),
+	)
+	if os.Getenv("PASSWORD_HASHER") == "bcrypt" {
+		utils.SetPasswordHasher(utils.NewBcryptHasher(getEnvInt("BCRYPT_COST", bcrypt.DefaultCost)))
+		passwords.MaxBytes = bcryptMaxPasswordBytes
+	} else {
+		utils.SetPasswordHasher(utils.NewArgon2idHasher(utils.Argon2idParams{
+			Memory:      uint32(getEnvInt("ARGON2_MEMORY_KIB", int(utils.DefaultArgon2idParams.Memory))),
+			Iterations:  uint32(getEnvInt("ARGON2_ITERATIONS", int(utils.DefaultArgon2idParams.Iterations))),
+			Parallelism: uint8(getEnvInt("ARGON2_PARALLELISM", int(utils.DefaultArgon2idParams.Parallelism))),
+			SaltLength:  utils.DefaultArgon2idParams.SaltLength,
+			KeyLength:   utils.DefaultArgon2idParams.KeyLength,
+		}))
+	}
+
+	if path := os.Getenv("PASSWORD_BREACHED_LIST"); path != "" {
+		if err := passwords.LoadBreachedList(path); err != nil {
+			log.Fatalf("error loading breached password list: %v", err)
+		}
+	}
+
+	providers, err := newOIDCProviders()
+	if err != nil {
+		log.Fatalf("error configuring oidc providers: %v", err)
+	}
+
+	hdl := handler.NewHandler(srv, handler.Config{
+		TokenMaker:     tokenMaker,
+		Mailer:         mail,
+		BaseURL:        os.Getenv("APP_BASE_URL"),
+		PasswordPolicy: passwords,
+
+		RequireAdminMFA: os.Getenv("MFA_REQUIRED_FOR_ADMINS") == "true",
+		MFAIssuer:       getEnv("MFA_ISSUER", defaultMFAIssuer),
+		OIDCProviders:   providers,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sessionGC := worker.NewPeriodic(
+		worker.SessionGCName,
+		getEnvDuration("SESSION_GC_INTERVAL", defaultSessionGCInterval),
+		st,
+		worker.NewSessionGC(
+			st,
+			getEnvDuration("SESSION_GC_RETENTION", defaultSessionGCRetention),
+			getEnvInt("SESSION_GC_BATCH_SIZE", defaultSessionGCBatchSize),
+		),
+	)
+	go sessionGC.Run(ctx)
+
+	softDeletePurge := worker.NewPeriodic(
+		worker.SoftDeletePurgeName,
+		getEnvDuration("SOFT_DELETE_PURGE_INTERVAL", defaultPurgeInterval),
+		st,
+		worker.NewSoftDeletePurge(
+			st,
+			getEnvDuration("SOFT_DELETE_RETENTION", defaultPurgeRetention),
+			getEnvInt("SOFT_DELETE_PURGE_BATCH_SIZE", defaultPurgeBatchSize),
+		),
+	)
+	go softDeletePurge.Run(ctx)
+
+	idempotencyPurge := worker.NewPeriodic(
+		worker.IdempotencyPurgeName,
+		getEnvDuration("IDEMPOTENCY_PURGE_INTERVAL", defaultIdempotencyPurgeInterval),
+		st,
+		worker.NewIdempotencyPurge(st, getEnvInt("IDEMPOTENCY_PURGE_BATCH_SIZE", defaultIdempotencyPurgeBatchSize)),
+	)
+	go idempotencyPurge.Run(ctx)
+
+	// expvar metrics are served on a separate, internal-only address
+	if addr := os.Getenv("METRICS_ADDR"); addr != "" {
+		go func() {
+			if err := http.ListenAndServe(addr, expvar.Handler()); err != nil {
+				log.Printf("error serving metrics: %v", err)
+			}
+		}()
+	}
 
 	handler.RegisterRoutes(hdl)
 	handler.Start(os.Getenv("APP_PORT"))
 }
+
+// newMailer picks the mail transport from MAILER: "smtp" relays through
+// SMTP_ADDR, anything else writes to the outbox file (or the log).
+func newMailer() (mailer.Mailer, error) {
+	from := getEnv("MAIL_FROM", defaultMailFrom)
+	if os.Getenv("MAILER") == "smtp" {
+		return mailer.NewSMTPMailer(os.Getenv("SMTP_ADDR"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	}
+
+	return mailer.NewOutboxMailer(os.Getenv("MAIL_OUTBOX_PATH"), from), nil
+}
+
+// newShippingMethods loads the shipping methods from SHIPPING_METHODS_FILE.
+// Without one every order ships for free.
+func newShippingMethods() (shipping.Methods, error) {
+	path := os.Getenv("SHIPPING_METHODS_FILE")
+	if path == "" {
+		log.Println("SHIPPING_METHODS_FILE not set, shipping is free")
+		return shipping.Methods{&shipping.FlatRate{Code: "standard", Name: "Standard shipping"}}, nil
+	}
+
+	return shipping.LoadMethods(path)
+}
+
+// newPaymentProviders sets up the providers listed in PAYMENT_PROVIDERS,
+// the first being the default. Only the fake provider exists so far; it
+// captures any card, so it has to be asked for by name for local use. Its
+// webhooks are signed with PAYMENT_FAKE_WEBHOOK_SECRET.
+func newPaymentProviders() (payment.Providers, error) {
+	var providers payment.Providers
+	for _, name := range strings.Split(os.Getenv("PAYMENT_PROVIDERS"), ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "":
+		case "fake":
+			providers = append(providers, payment.NewFake(os.Getenv("PAYMENT_FAKE_WEBHOOK_SECRET")))
+		default:
+			return nil, fmt.Errorf("provider %q: %w", name, payment.ErrUnknownProvider)
+		}
+	}
+
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("PAYMENT_PROVIDERS not set, use PAYMENT_PROVIDERS=fake to take payments locally")
+	}
+
+	return providers, nil
+}
+
+// newOIDCProviders sets up the providers listed in OIDC_PROVIDERS, e.g.
+// "google,microsoft", each configured by OIDC_<NAME>_ISSUER, _CLIENT_ID,
+// _CLIENT_SECRET and _REDIRECT_URL.
+func newOIDCProviders() ([]*oidc.Provider, error) {
+	var providers []*oidc.Provider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		p, err := oidc.NewProvider(ctx, oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+		})
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("provider %q: %w", name, err)
+		}
+
+		providers = append(providers, p)
+	}
+
+	return providers, nil
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return d
+}
+
+func getEnvInt(key string, fallback int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return n
+}
+
+// reloadOnHangup re-reads the token keys and tax rules on SIGHUP so a new
+// signing key or tax rate can be rolled out without a restart.
+func reloadOnHangup(keys *token.KeySet, taxes *tax.Engine) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	for range sig {
+		if err := keys.Reload(); err != nil {
+			log.Printf("error reloading token keys: %v", err)
+		} else {
+			log.Println("token keys reloaded")
+		}
+
+		if err := taxes.Reload(); err != nil {
+			log.Printf("error reloading tax rules: %v", err)
+		} else {
+			log.Println("tax rules reloaded")
+		}
+	}
+}
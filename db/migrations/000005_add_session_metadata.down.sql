@@ -0,0 +1,4 @@
+ALTER TABLE `sessions`
+    DROP INDEX `sessions_user_email_idx`,
+    DROP COLUMN `client_ip`,
+    DROP COLUMN `user_agent`;
@@ -0,0 +1,4 @@
+ALTER TABLE `sessions`
+    ADD COLUMN `user_agent` VARCHAR(512) NOT NULL DEFAULT '',
+    ADD COLUMN `client_ip` VARCHAR(45) NOT NULL DEFAULT '',
+    ADD INDEX `sessions_user_email_idx` (`user_email`);
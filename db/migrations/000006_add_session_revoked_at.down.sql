@@ -0,0 +1,4 @@
+ALTER TABLE `sessions`
+    DROP INDEX `sessions_revoked_at_idx`,
+    DROP INDEX `sessions_expires_at_idx`,
+    DROP COLUMN `revoked_at`;
@@ -0,0 +1,6 @@
+ALTER TABLE `sessions`
+    ADD COLUMN `revoked_at` DATETIME NULL,
+    ADD INDEX `sessions_expires_at_idx` (`expires_at`),
+    ADD INDEX `sessions_revoked_at_idx` (`revoked_at`);
+
+UPDATE `sessions` SET `revoked_at` = NOW() WHERE `is_revoked` = true;
@@ -0,0 +1,55 @@
+CREATE TABLE `roles` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `name` VARCHAR(64) NOT NULL UNIQUE,
+    `description` VARCHAR(255) NOT NULL DEFAULT '',
+    `created_at` DATETIME DEFAULT NOW()
+);
+
+CREATE TABLE `permissions` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `name` VARCHAR(64) NOT NULL UNIQUE,
+    `description` VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+CREATE TABLE `role_permissions` (
+    `role_id` INT NOT NULL,
+    `permission_id` INT NOT NULL,
+    PRIMARY KEY (`role_id`, `permission_id`),
+    FOREIGN KEY (`role_id`) REFERENCES `roles` (`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`permission_id`) REFERENCES `permissions` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE `user_roles` (
+    `user_id` INT NOT NULL,
+    `role_id` INT NOT NULL,
+    `created_at` DATETIME DEFAULT NOW(),
+    PRIMARY KEY (`user_id`, `role_id`),
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`role_id`) REFERENCES `roles` (`id`) ON DELETE CASCADE
+);
+
+INSERT INTO `roles` (`name`, `description`) VALUES
+    ('catalog-manager', 'Manages the product catalog'),
+    ('order-fulfilment', 'Views and processes orders'),
+    ('support', 'Looks up customers and their orders'),
+    ('super-admin', 'Full access');
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+    ('products:write', 'Create, update and delete products'),
+    ('orders:read', 'View all orders'),
+    ('orders:write', 'Update and delete orders'),
+    ('orders:refund', 'Refund orders'),
+    ('users:read', 'View users and their sessions'),
+    ('users:write', 'Update and delete users and revoke their sessions');
+
+INSERT INTO `role_permissions` (`role_id`, `permission_id`)
+SELECT r.`id`, p.`id` FROM `roles` r JOIN `permissions` p
+WHERE (r.`name` = 'catalog-manager' AND p.`name` = 'products:write')
+   OR (r.`name` = 'order-fulfilment' AND p.`name` IN ('orders:read', 'orders:write'))
+   OR (r.`name` = 'support' AND p.`name` IN ('users:read', 'orders:read'))
+   OR r.`name` = 'super-admin';
+
+-- existing admins keep full access
+INSERT INTO `user_roles` (`user_id`, `role_id`)
+SELECT u.`id`, r.`id` FROM `users` u JOIN `roles` r ON r.`name` = 'super-admin'
+WHERE u.`is_admin` = true;
@@ -0,0 +1,9 @@
+ALTER TABLE `users` ADD COLUMN `is_admin` BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE `users` u JOIN `user_roles` ur ON ur.`user_id` = u.`id`
+JOIN `roles` r ON r.`id` = ur.`role_id` AND r.`name` = 'super-admin'
+SET u.`is_admin` = TRUE;
+
+DELETE FROM `permissions` WHERE `name` = 'roles:write';
+
+DROP TABLE IF EXISTS `privilege_audit`;
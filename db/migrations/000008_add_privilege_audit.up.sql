@@ -0,0 +1,19 @@
+CREATE TABLE `privilege_audit` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `actor_user_id` INT NOT NULL,
+    `target_user_id` INT NOT NULL,
+    `action` VARCHAR(32) NOT NULL,
+    `role` VARCHAR(64) NOT NULL,
+    `created_at` DATETIME DEFAULT NOW(),
+    INDEX `privilege_audit_target_idx` (`target_user_id`)
+);
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+    ('roles:write', 'Grant and revoke user roles');
+
+INSERT INTO `role_permissions` (`role_id`, `permission_id`)
+SELECT r.`id`, p.`id` FROM `roles` r JOIN `permissions` p
+WHERE r.`name` = 'super-admin' AND p.`name` = 'roles:write';
+
+-- privileges are granted through user_roles only
+ALTER TABLE `users` DROP COLUMN `is_admin`;
@@ -0,0 +1,14 @@
+ALTER TABLE `users` ADD COLUMN `email_verified_at` DATETIME NULL;
+
+-- accounts created before verification existed stay usable
+UPDATE `users` SET `email_verified_at` = NOW();
+
+CREATE TABLE `email_verifications` (
+    `token_hash` CHAR(64) PRIMARY KEY NOT NULL,
+    `user_id` INT NOT NULL,
+    `expires_at` DATETIME NOT NULL,
+    `used_at` DATETIME NULL,
+    `created_at` DATETIME DEFAULT NOW(),
+    INDEX `email_verifications_user_idx` (`user_id`, `created_at`),
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+CREATE TABLE `password_resets` (
+    `token_hash` CHAR(64) PRIMARY KEY NOT NULL,
+    `user_id` INT NOT NULL,
+    `expires_at` DATETIME NOT NULL,
+    `used_at` DATETIME NULL,
+    `created_at` DATETIME DEFAULT NOW(),
+    INDEX `password_resets_user_idx` (`user_id`, `created_at`),
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
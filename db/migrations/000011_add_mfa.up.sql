@@ -0,0 +1,20 @@
+CREATE TABLE `user_mfa` (
+    `user_id` INT PRIMARY KEY NOT NULL,
+    `secret` VARCHAR(64) NOT NULL,
+    `confirmed_at` DATETIME NULL,
+    `last_used_step` BIGINT NOT NULL DEFAULT 0,
+    `failed_attempts` INT NOT NULL DEFAULT 0,
+    `locked_until` DATETIME NULL,
+    `created_at` DATETIME DEFAULT NOW(),
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE `mfa_recovery_codes` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `code_hash` CHAR(64) NOT NULL,
+    `used_at` DATETIME NULL,
+    `created_at` DATETIME DEFAULT NOW(),
+    UNIQUE (`user_id`, `code_hash`),
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
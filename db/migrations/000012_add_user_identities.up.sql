@@ -0,0 +1,11 @@
+CREATE TABLE `user_identities` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `provider` VARCHAR(64) NOT NULL,
+    `subject` VARCHAR(255) NOT NULL,
+    `email` VARCHAR(255) NOT NULL,
+    `created_at` DATETIME DEFAULT NOW(),
+    UNIQUE (`provider`, `subject`),
+    INDEX `user_identities_user_idx` (`user_id`),
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
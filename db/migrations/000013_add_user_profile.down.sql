@@ -0,0 +1,3 @@
+ALTER TABLE `users`
+    DROP COLUMN `default_address`,
+    DROP COLUMN `phone`;
@@ -0,0 +1,3 @@
+ALTER TABLE `users`
+    ADD COLUMN `phone` VARCHAR(32) NULL,
+    ADD COLUMN `default_address` VARCHAR(512) NULL;
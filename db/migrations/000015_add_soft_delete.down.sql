@@ -0,0 +1,11 @@
+ALTER TABLE `orders`
+    DROP INDEX `orders_deleted_at_idx`,
+    DROP COLUMN `deleted_at`;
+
+ALTER TABLE `products`
+    DROP INDEX `products_deleted_at_idx`,
+    DROP COLUMN `deleted_at`;
+
+ALTER TABLE `users`
+    DROP INDEX `users_deleted_at_idx`,
+    DROP COLUMN `deleted_at`;
@@ -0,0 +1,11 @@
+ALTER TABLE `users`
+    ADD COLUMN `deleted_at` DATETIME NULL,
+    ADD INDEX `users_deleted_at_idx` (`deleted_at`);
+
+ALTER TABLE `products`
+    ADD COLUMN `deleted_at` DATETIME NULL,
+    ADD INDEX `products_deleted_at_idx` (`deleted_at`);
+
+ALTER TABLE `orders`
+    ADD COLUMN `deleted_at` DATETIME NULL,
+    ADD INDEX `orders_deleted_at_idx` (`deleted_at`);
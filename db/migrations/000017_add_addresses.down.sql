@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS `order_addresses`;
+DROP TABLE IF EXISTS `addresses`;
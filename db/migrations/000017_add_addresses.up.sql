@@ -0,0 +1,35 @@
+CREATE TABLE `addresses` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `name` VARCHAR(255) NOT NULL,
+    `line1` VARCHAR(255) NOT NULL,
+    `line2` VARCHAR(255) NOT NULL DEFAULT '',
+    `city` VARCHAR(128) NOT NULL,
+    `state` VARCHAR(128) NOT NULL DEFAULT '',
+    `postal_code` VARCHAR(32) NOT NULL DEFAULT '',
+    `country` CHAR(2) NOT NULL,
+    `phone` VARCHAR(32) NOT NULL DEFAULT '',
+    `is_default` BOOLEAN NOT NULL DEFAULT FALSE,
+    `created_at` DATETIME DEFAULT NOW(),
+    `updated_at` DATETIME,
+    INDEX `addresses_user_idx` (`user_id`),
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
+
+-- addresses are copied into the order so editing the address book doesn't
+-- change where past orders went
+CREATE TABLE `order_addresses` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `order_id` INT NOT NULL,
+    `kind` VARCHAR(16) NOT NULL,
+    `name` VARCHAR(255) NOT NULL,
+    `line1` VARCHAR(255) NOT NULL,
+    `line2` VARCHAR(255) NOT NULL DEFAULT '',
+    `city` VARCHAR(128) NOT NULL,
+    `state` VARCHAR(128) NOT NULL DEFAULT '',
+    `postal_code` VARCHAR(32) NOT NULL DEFAULT '',
+    `country` CHAR(2) NOT NULL,
+    `phone` VARCHAR(32) NOT NULL DEFAULT '',
+    UNIQUE (`order_id`, `kind`),
+    FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`) ON DELETE CASCADE
+);
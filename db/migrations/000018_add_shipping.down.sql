@@ -0,0 +1,7 @@
+ALTER TABLE `orders` DROP COLUMN `shipping_method`;
+
+ALTER TABLE `products`
+    DROP COLUMN `weight_grams`,
+    DROP COLUMN `length_mm`,
+    DROP COLUMN `width_mm`,
+    DROP COLUMN `height_mm`;
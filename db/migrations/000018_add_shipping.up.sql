@@ -0,0 +1,7 @@
+ALTER TABLE `products`
+    ADD COLUMN `weight_grams` INT NOT NULL DEFAULT 0,
+    ADD COLUMN `length_mm` INT NOT NULL DEFAULT 0,
+    ADD COLUMN `width_mm` INT NOT NULL DEFAULT 0,
+    ADD COLUMN `height_mm` INT NOT NULL DEFAULT 0;
+
+ALTER TABLE `orders` ADD COLUMN `shipping_method` VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+ALTER TABLE `order_items`
+    MODIFY COLUMN `price` INTEGER NOT NULL,
+    DROP COLUMN `tax_category`,
+    DROP COLUMN `tax_name`,
+    DROP COLUMN `tax_rate`,
+    DROP COLUMN `tax_inclusive`,
+    DROP COLUMN `net_amount`,
+    DROP COLUMN `tax_amount`;
+
+ALTER TABLE `products` DROP COLUMN `tax_category`;
@@ -0,0 +1,11 @@
+ALTER TABLE `products` ADD COLUMN `tax_category` VARCHAR(64) NOT NULL DEFAULT '';
+
+-- prices were stored as whole numbers, which dropped the cents
+ALTER TABLE `order_items`
+    MODIFY COLUMN `price` DECIMAL(10,2) NOT NULL,
+    ADD COLUMN `tax_category` VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN `tax_name` VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN `tax_rate` DECIMAL(6,4) NOT NULL DEFAULT 0,
+    ADD COLUMN `tax_inclusive` BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN `net_amount` DECIMAL(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN `tax_amount` DECIMAL(10,2) NOT NULL DEFAULT 0;
@@ -0,0 +1,10 @@
+DELETE FROM `permissions` WHERE `name` = 'coupons:write';
+
+ALTER TABLE `orders`
+    DROP COLUMN `coupon_code`,
+    DROP COLUMN `discount_price`;
+
+DROP TABLE IF EXISTS `coupon_redemptions`;
+DROP TABLE IF EXISTS `coupon_categories`;
+DROP TABLE IF EXISTS `coupon_products`;
+DROP TABLE IF EXISTS `coupons`;
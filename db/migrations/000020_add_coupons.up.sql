@@ -0,0 +1,53 @@
+CREATE TABLE `coupons` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `code` VARCHAR(64) NOT NULL UNIQUE,
+    `type` VARCHAR(16) NOT NULL,
+    `value` DECIMAL(10,2) NOT NULL DEFAULT 0,
+    `min_order_value` DECIMAL(10,2) NOT NULL DEFAULT 0,
+    `max_uses` INT,
+    `max_uses_per_user` INT,
+    `times_used` INT NOT NULL DEFAULT 0,
+    `starts_at` DATETIME,
+    `ends_at` DATETIME,
+    `created_at` DATETIME DEFAULT NOW(),
+    `updated_at` DATETIME
+);
+
+-- a coupon with no products and no categories applies to the whole order
+CREATE TABLE `coupon_products` (
+    `coupon_id` INT NOT NULL,
+    `product_id` INT NOT NULL,
+    PRIMARY KEY (`coupon_id`, `product_id`),
+    FOREIGN KEY (`coupon_id`) REFERENCES `coupons` (`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`product_id`) REFERENCES `products` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE `coupon_categories` (
+    `coupon_id` INT NOT NULL,
+    `category` VARCHAR(255) NOT NULL,
+    PRIMARY KEY (`coupon_id`, `category`),
+    FOREIGN KEY (`coupon_id`) REFERENCES `coupons` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE `coupon_redemptions` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `coupon_id` INT NOT NULL,
+    `user_id` INT NOT NULL,
+    `order_id` INT NOT NULL,
+    `amount` DECIMAL(10,2) NOT NULL,
+    `created_at` DATETIME DEFAULT NOW(),
+    INDEX `coupon_redemptions_user_idx` (`coupon_id`, `user_id`),
+    FOREIGN KEY (`coupon_id`) REFERENCES `coupons` (`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`) ON DELETE CASCADE
+);
+
+ALTER TABLE `orders`
+    ADD COLUMN `coupon_code` VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN `discount_price` DECIMAL(10,2) NOT NULL DEFAULT 0;
+
+INSERT INTO `permissions` (`name`, `description`) VALUES
+    ('coupons:write', 'Create, update and delete discount codes');
+
+INSERT INTO `role_permissions` (`role_id`, `permission_id`)
+SELECT r.`id`, p.`id` FROM `roles` r JOIN `permissions` p
+WHERE r.`name` IN ('catalog-manager', 'super-admin') AND p.`name` = 'coupons:write';
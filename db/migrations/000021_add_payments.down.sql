@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `payments`;
+
+ALTER TABLE `orders`
+    DROP COLUMN `status`,
+    DROP COLUMN `paid_at`;
@@ -0,0 +1,19 @@
+ALTER TABLE `orders`
+    ADD COLUMN `status` VARCHAR(32) NOT NULL DEFAULT 'pending',
+    ADD COLUMN `paid_at` DATETIME;
+
+-- one row per attempt to pay an order
+CREATE TABLE `payments` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `order_id` INT NOT NULL,
+    `provider` VARCHAR(64) NOT NULL,
+    `reference` VARCHAR(255) NOT NULL DEFAULT '',
+    `status` VARCHAR(32) NOT NULL,
+    `amount` DECIMAL(10,2) NOT NULL,
+    `error` VARCHAR(255) NOT NULL DEFAULT '',
+    `created_at` DATETIME DEFAULT NOW(),
+    `updated_at` DATETIME,
+    INDEX `payments_order_idx` (`order_id`),
+    INDEX `payments_reference_idx` (`provider`, `reference`),
+    FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`) ON DELETE CASCADE
+);
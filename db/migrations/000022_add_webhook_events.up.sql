@@ -0,0 +1,18 @@
+-- every payment webhook received, so repeated deliveries are applied once
+-- and failed ones can be replayed
+CREATE TABLE `webhook_events` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `provider` VARCHAR(64) NOT NULL,
+    `event_id` VARCHAR(255) NOT NULL,
+    `type` VARCHAR(64) NOT NULL,
+    `reference` VARCHAR(255) NOT NULL,
+    `amount` DECIMAL(10,2) NOT NULL DEFAULT 0,
+    `payload` TEXT NOT NULL,
+    `status` VARCHAR(32) NOT NULL,
+    `error` VARCHAR(255) NOT NULL DEFAULT '',
+    `attempts` INT NOT NULL DEFAULT 0,
+    `created_at` DATETIME DEFAULT NOW(),
+    `processed_at` DATETIME,
+    UNIQUE (`provider`, `event_id`),
+    INDEX `webhook_events_status_idx` (`status`)
+);
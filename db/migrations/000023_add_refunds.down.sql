@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS `refund_items`;
+DROP TABLE IF EXISTS `refunds`;
+
+ALTER TABLE `order_items` DROP COLUMN `refunded_quantity`;
+ALTER TABLE `orders` DROP COLUMN `refunded_price`;
@@ -0,0 +1,27 @@
+ALTER TABLE `orders` ADD COLUMN `refunded_price` DECIMAL(10,2) NOT NULL DEFAULT 0;
+ALTER TABLE `order_items` ADD COLUMN `refunded_quantity` INT NOT NULL DEFAULT 0;
+
+CREATE TABLE `refunds` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `order_id` INT NOT NULL,
+    `payment_id` INT NOT NULL,
+    `amount` DECIMAL(10,2) NOT NULL,
+    `reason` VARCHAR(255) NOT NULL DEFAULT '',
+    -- the provider's ID for the refund
+    `reference` VARCHAR(255) NOT NULL DEFAULT '',
+    `restock` BOOLEAN NOT NULL DEFAULT TRUE,
+    `created_by` INT NOT NULL,
+    `created_at` DATETIME DEFAULT NOW(),
+    INDEX `refunds_payment_idx` (`payment_id`),
+    FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE `refund_items` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `refund_id` INT NOT NULL,
+    `order_item_id` INT NOT NULL,
+    `product_id` INT NOT NULL,
+    `quantity` INT NOT NULL,
+    `amount` DECIMAL(10,2) NOT NULL,
+    FOREIGN KEY (`refund_id`) REFERENCES `refunds` (`id`) ON DELETE CASCADE
+);
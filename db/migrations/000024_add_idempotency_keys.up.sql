@@ -0,0 +1,18 @@
+-- responses to requests sent with an Idempotency-Key header, so a retried
+-- request gets the original response instead of running again
+CREATE TABLE `idempotency_keys` (
+    `id` INT PRIMARY KEY NOT NULL AUTO_INCREMENT,
+    `user_id` INT NOT NULL,
+    `idem_key` VARCHAR(255) NOT NULL,
+    `method` VARCHAR(16) NOT NULL,
+    `path` VARCHAR(255) NOT NULL,
+    `request_hash` CHAR(64) NOT NULL,
+    -- 0 while the first request is still running
+    `status_code` INT NOT NULL DEFAULT 0,
+    `response_body` MEDIUMTEXT NOT NULL,
+    `created_at` DATETIME DEFAULT NOW(),
+    `expires_at` DATETIME NOT NULL,
+    UNIQUE (`user_id`, `idem_key`),
+    INDEX `idempotency_keys_expires_idx` (`expires_at`),
+    FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+);
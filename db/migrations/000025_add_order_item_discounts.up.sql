@@ -0,0 +1,2 @@
+-- each line's share of the order's coupon discount, taken off before tax
+ALTER TABLE `order_items` ADD COLUMN `discount_amount` DECIMAL(10,2) NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+ALTER TABLE `coupon_redemptions` DROP FOREIGN KEY `coupon_redemptions_order_fk`;
+ALTER TABLE `coupon_redemptions`
+    ADD CONSTRAINT `coupon_redemptions_ibfk_2` FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`) ON DELETE CASCADE;
+
+ALTER TABLE `refunds` DROP FOREIGN KEY `refunds_order_fk`;
+ALTER TABLE `refunds`
+    ADD CONSTRAINT `refunds_ibfk_1` FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`) ON DELETE CASCADE;
+
+ALTER TABLE `payments` DROP FOREIGN KEY `payments_order_fk`;
+ALTER TABLE `payments`
+    ADD CONSTRAINT `payments_ibfk_1` FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`) ON DELETE CASCADE;
@@ -0,0 +1,13 @@
+-- payments, refunds and coupon redemptions are accounting records, so an
+-- order that has any can't be deleted out from under them
+ALTER TABLE `payments` DROP FOREIGN KEY `payments_ibfk_1`;
+ALTER TABLE `payments`
+    ADD CONSTRAINT `payments_order_fk` FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`) ON DELETE RESTRICT;
+
+ALTER TABLE `refunds` DROP FOREIGN KEY `refunds_ibfk_1`;
+ALTER TABLE `refunds`
+    ADD CONSTRAINT `refunds_order_fk` FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`) ON DELETE RESTRICT;
+
+ALTER TABLE `coupon_redemptions` DROP FOREIGN KEY `coupon_redemptions_ibfk_2`;
+ALTER TABLE `coupon_redemptions`
+    ADD CONSTRAINT `coupon_redemptions_order_fk` FOREIGN KEY (`order_id`) REFERENCES `orders` (`id`) ON DELETE RESTRICT;
@@ -0,0 +1,2 @@
+-- a refund is recorded as pending before the provider is asked for it
+ALTER TABLE `refunds` ADD COLUMN `status` VARCHAR(32) NOT NULL DEFAULT 'completed';
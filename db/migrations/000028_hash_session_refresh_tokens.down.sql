@@ -0,0 +1,2 @@
+-- the hashes can't be turned back into tokens, they are left as they are
+ALTER TABLE `sessions` MODIFY `refresh_token` VARCHAR(512) NOT NULL;
@@ -0,0 +1,4 @@
+-- sessions keep a SHA-256 of the refresh token instead of the token, which
+-- can be longer than the old column once tokens are signed with RS256
+UPDATE `sessions` SET `refresh_token` = SHA2(`refresh_token`, 256) WHERE `refresh_token` <> '';
+ALTER TABLE `sessions` MODIFY `refresh_token` CHAR(64) NOT NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE `coupon_redemptions` DROP FOREIGN KEY `coupon_redemptions_coupon_fk`;
+ALTER TABLE `coupon_redemptions`
+    ADD CONSTRAINT `coupon_redemptions_ibfk_1` FOREIGN KEY (`coupon_id`) REFERENCES `coupons` (`id`) ON DELETE CASCADE;
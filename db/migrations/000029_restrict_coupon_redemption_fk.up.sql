@@ -0,0 +1,5 @@
+-- redemptions are accounting records, so a redeemed coupon is expired
+-- instead of deleted
+ALTER TABLE `coupon_redemptions` DROP FOREIGN KEY `coupon_redemptions_ibfk_1`;
+ALTER TABLE `coupon_redemptions`
+    ADD CONSTRAINT `coupon_redemptions_coupon_fk` FOREIGN KEY (`coupon_id`) REFERENCES `coupons` (`id`) ON DELETE RESTRICT;
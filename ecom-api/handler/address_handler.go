@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxAddressLineLength = 255
+	maxCityLength        = 128
+	maxPostalCodeLength  = 32
+)
+
+func (h *handler) listAddresses(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	addresses, err := h.server.ListAddresses(c.Request.Context(), claims.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := ListAddressRes{Addresses: []AddressRes{}}
+	for _, a := range addresses {
+		res.Addresses = append(res.Addresses, toAddressRes(&a))
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *handler) createAddress(c *gin.Context) {
+	var req AddressReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	a := &store.Address{
+		UserID:        claims.ID,
+		PostalAddress: toStorePostalAddress(req.PostalAddress),
+		IsDefault:     req.IsDefault != nil && *req.IsDefault,
+	}
+	if err := validateAddress(a.PostalAddress); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	created, err := h.server.CreateAddress(c.Request.Context(), a)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toAddressRes(created))
+}
+
+func (h *handler) updateAddress(c *gin.Context) {
+	var req AddressReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return
+	}
+
+	a, err := h.server.GetAddress(c.Request.Context(), claims.ID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
+		return
+	}
+
+	patchAddressReq(a, req)
+	if err := validateAddress(a.PostalAddress); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.server.UpdateAddress(c.Request.Context(), a)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toAddressRes(updated))
+}
+
+func (h *handler) deleteAddress(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return
+	}
+
+	err = h.server.DeleteAddress(c.Request.Context(), claims.ID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "address not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// orderAddresses fills in the order's shipping and billing addresses from
+// the request, copying them so later address book edits don't change the
+// order. It writes the error response and returns false on failure.
+func (h *handler) orderAddresses(c *gin.Context, o *store.Order, req OrderReq) bool {
+	shipping, ok := h.shippingAddress(c, o.UserID, req.ShippingAddress)
+	if !ok {
+		return false
+	}
+
+	billing := shipping
+	if req.BillingAddress != nil {
+		if billing, ok = h.orderAddress(c, o.UserID, req.BillingAddress); !ok {
+			return false
+		}
+	}
+
+	o.ShippingAddress = &store.OrderAddress{Kind: store.OrderAddressShipping, PostalAddress: shipping}
+	o.BillingAddress = &store.OrderAddress{Kind: store.OrderAddressBilling, PostalAddress: billing}
+	return true
+}
+
+// shippingAddress resolves req, or the user's default address when req is
+// nil.
+func (h *handler) shippingAddress(c *gin.Context, userID int64, req *OrderAddressReq) (store.PostalAddress, bool) {
+	if req != nil {
+		return h.orderAddress(c, userID, req)
+	}
+
+	a, err := h.server.GetDefaultAddress(c.Request.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "shipping address is required"})
+		return store.PostalAddress{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return store.PostalAddress{}, false
+	}
+
+	return a.PostalAddress, true
+}
+
+func (h *handler) orderAddress(c *gin.Context, userID int64, req *OrderAddressReq) (store.PostalAddress, bool) {
+	if req.AddressID != 0 {
+		a, err := h.server.GetAddress(c.Request.Context(), userID, req.AddressID)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("address %d not found", req.AddressID)})
+			return store.PostalAddress{}, false
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return store.PostalAddress{}, false
+		}
+		return a.PostalAddress, true
+	}
+
+	pa := toStorePostalAddress(req.PostalAddress)
+	if err := validateAddress(pa); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return store.PostalAddress{}, false
+	}
+
+	return pa, true
+}
+
+func patchAddressReq(a *store.Address, req AddressReq) {
+	p := toStorePostalAddress(req.PostalAddress)
+	if p.Name != "" {
+		a.Name = p.Name
+	}
+	if p.Line1 != "" {
+		a.Line1 = p.Line1
+	}
+	if p.Line2 != "" {
+		a.Line2 = p.Line2
+	}
+	if p.City != "" {
+		a.City = p.City
+	}
+	if p.State != "" {
+		a.State = p.State
+	}
+	if p.PostalCode != "" {
+		a.PostalCode = p.PostalCode
+	}
+	if p.Country != "" {
+		a.Country = p.Country
+	}
+	if p.Phone != "" {
+		a.Phone = p.Phone
+	}
+	if req.IsDefault != nil {
+		a.IsDefault = *req.IsDefault
+	}
+	a.UpdatedAt = toTimePtr(time.Now())
+}
+
+func validateAddress(a store.PostalAddress) error {
+	if a.Name == "" || a.Line1 == "" || a.City == "" || a.Country == "" {
+		return errors.New("name, line1, city and country are required")
+	}
+	for _, f := range []string{a.Name, a.Line1, a.Line2, a.State} {
+		if len(f) > maxAddressLineLength {
+			return fmt.Errorf("address lines must be at most %d characters", maxAddressLineLength)
+		}
+	}
+	if len(a.City) > maxCityLength {
+		return fmt.Errorf("city must be at most %d characters", maxCityLength)
+	}
+	if len(a.PostalCode) > maxPostalCodeLength {
+		return fmt.Errorf("postal code must be at most %d characters", maxPostalCodeLength)
+	}
+	if len(a.Country) != 2 || strings.Trim(a.Country, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return errors.New("country must be a two letter ISO 3166 code")
+	}
+
+	return validatePhone(a.Phone)
+}
+
+func toStorePostalAddress(a PostalAddress) store.PostalAddress {
+	return store.PostalAddress{
+		Name:       strings.TrimSpace(a.Name),
+		Line1:      strings.TrimSpace(a.Line1),
+		Line2:      strings.TrimSpace(a.Line2),
+		City:       strings.TrimSpace(a.City),
+		State:      strings.TrimSpace(a.State),
+		PostalCode: strings.TrimSpace(a.PostalCode),
+		Country:    strings.ToUpper(strings.TrimSpace(a.Country)),
+		Phone:      strings.TrimSpace(a.Phone),
+	}
+}
+
+func toPostalAddress(a store.PostalAddress) PostalAddress {
+	return PostalAddress{
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		State:      a.State,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+		Phone:      a.Phone,
+	}
+}
+
+func toAddressRes(a *store.Address) AddressRes {
+	return AddressRes{
+		ID:            a.ID,
+		PostalAddress: toPostalAddress(a.PostalAddress),
+		IsDefault:     a.IsDefault,
+		CreatedAt:     a.CreatedAt,
+		UpdatedAt:     a.UpdatedAt,
+	}
+}
+
+func toOrderAddressRes(a *store.OrderAddress) *PostalAddress {
+	if a == nil {
+		return nil
+	}
+
+	pa := toPostalAddress(a.PostalAddress)
+	return &pa
+}
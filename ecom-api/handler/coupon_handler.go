@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/gin-gonic/gin"
+)
+
+const maxCouponCodeLength = 64
+
+func (h *handler) createCoupon(c *gin.Context) {
+	var req CouponReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupon := toStoreCoupon(req)
+	if err := validateCoupon(coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkCouponCodeFree(c, coupon) {
+		return
+	}
+
+	created, err := h.server.CreateCoupon(c.Request.Context(), coupon)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toCouponRes(created))
+}
+
+func (h *handler) getCoupon(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return
+	}
+
+	coupon, err := h.server.GetCoupon(c.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "coupon not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toCouponRes(coupon))
+}
+
+func (h *handler) listCoupons(c *gin.Context) {
+	coupons, err := h.server.ListCoupons(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := ListCouponRes{Coupons: []CouponRes{}}
+	for _, coupon := range coupons {
+		res.Coupons = append(res.Coupons, toCouponRes(&coupon))
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *handler) updateCoupon(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return
+	}
+
+	var req CouponReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupon, err := h.server.GetCoupon(c.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "coupon not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	patchCouponReq(coupon, req)
+	if err := validateCoupon(coupon); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkCouponCodeFree(c, coupon) {
+		return
+	}
+
+	updated, err := h.server.UpdateCoupon(c.Request.Context(), coupon)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "coupon not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toCouponRes(updated))
+}
+
+func (h *handler) deleteCoupon(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return
+	}
+
+	err = h.server.DeleteCoupon(c.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "coupon not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// checkCouponCodeFree writes a 409 response and returns false if another
+// coupon already uses coupon's code.
+func (h *handler) checkCouponCodeFree(c *gin.Context, coupon *store.Coupon) bool {
+	existing, err := h.server.GetCouponByCode(c.Request.Context(), coupon.Code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if existing.ID != coupon.ID {
+		c.JSON(http.StatusConflict, gin.H{"error": "coupon code already exists"})
+		return false
+	}
+
+	return true
+}
+
+func validateCoupon(c *store.Coupon) error {
+	if c.Code == "" || len(c.Code) > maxCouponCodeLength {
+		return fmt.Errorf("code must be 1 to %d characters", maxCouponCodeLength)
+	}
+	if strings.Trim(c.Code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_") != "" {
+		return errors.New("code may only contain letters, digits, - and _")
+	}
+
+	switch c.Type {
+	case store.CouponPercentage:
+		if c.Value <= 0 || c.Value > 100 {
+			return errors.New("percentage value must be between 0 and 100")
+		}
+	case store.CouponFixed:
+		if c.Value <= 0 {
+			return errors.New("fixed value must be positive")
+		}
+	case store.CouponFreeShipping:
+		c.Value = 0
+	default:
+		return fmt.Errorf("type must be %s, %s or %s", store.CouponPercentage, store.CouponFixed, store.CouponFreeShipping)
+	}
+
+	if c.MinOrderValue < 0 {
+		return errors.New("min_order_value must not be negative")
+	}
+	if (c.MaxUses != nil && *c.MaxUses < 1) || (c.MaxUsesPerUser != nil && *c.MaxUsesPerUser < 1) {
+		return errors.New("usage limits must be at least 1")
+	}
+	if c.StartsAt != nil && c.EndsAt != nil && !c.EndsAt.After(*c.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	for _, category := range c.Categories {
+		if category == "" {
+			return errors.New("categories must not be empty")
+		}
+	}
+
+	return nil
+}
+
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func normalizeCategories(categories []string) []string {
+	if categories == nil {
+		return nil
+	}
+
+	res := make([]string, len(categories))
+	for i, category := range categories {
+		res[i] = strings.TrimSpace(category)
+	}
+	return res
+}
+
+func toStoreCoupon(req CouponReq) *store.Coupon {
+	return &store.Coupon{
+		Code:           normalizeCouponCode(req.Code),
+		Type:           req.Type,
+		Value:          req.Value,
+		MinOrderValue:  req.MinOrderValue,
+		MaxUses:        req.MaxUses,
+		MaxUsesPerUser: req.MaxUsesPerUser,
+		StartsAt:       req.StartsAt,
+		EndsAt:         req.EndsAt,
+		ProductIDs:     req.ProductIDs,
+		Categories:     normalizeCategories(req.Categories),
+	}
+}
+
+func patchCouponReq(coupon *store.Coupon, req CouponReq) {
+	if code := normalizeCouponCode(req.Code); code != "" {
+		coupon.Code = code
+	}
+	if req.Type != "" {
+		coupon.Type = req.Type
+	}
+	if req.Value != 0 {
+		coupon.Value = req.Value
+	}
+	if req.MinOrderValue != 0 {
+		coupon.MinOrderValue = req.MinOrderValue
+	}
+	if req.MaxUses != nil {
+		coupon.MaxUses = req.MaxUses
+	}
+	if req.MaxUsesPerUser != nil {
+		coupon.MaxUsesPerUser = req.MaxUsesPerUser
+	}
+	if req.StartsAt != nil {
+		coupon.StartsAt = req.StartsAt
+	}
+	if req.EndsAt != nil {
+		coupon.EndsAt = req.EndsAt
+	}
+	if req.ProductIDs != nil {
+		coupon.ProductIDs = req.ProductIDs
+	}
+	if req.Categories != nil {
+		coupon.Categories = normalizeCategories(req.Categories)
+	}
+	coupon.UpdatedAt = toTimePtr(time.Now())
+}
+
+func toCouponRes(c *store.Coupon) CouponRes {
+	res := CouponRes{
+		ID:             c.ID,
+		Code:           c.Code,
+		Type:           c.Type,
+		Value:          c.Value,
+		MinOrderValue:  c.MinOrderValue,
+		MaxUses:        c.MaxUses,
+		MaxUsesPerUser: c.MaxUsesPerUser,
+		TimesUsed:      c.TimesUsed,
+		StartsAt:       c.StartsAt,
+		EndsAt:         c.EndsAt,
+		ProductIDs:     c.ProductIDs,
+		Categories:     c.Categories,
+		CreatedAt:      c.CreatedAt,
+		UpdatedAt:      c.UpdatedAt,
+	}
+	if res.ProductIDs == nil {
+		res.ProductIDs = []int64{}
+	}
+	if res.Categories == nil {
+		res.Categories = []string{}
+	}
+
+	return res
+}
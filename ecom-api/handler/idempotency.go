@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/server"
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+)
+
+// idempotent makes a request sent with an Idempotency-Key header run at most
+// once per user and key: a retry gets the first response back, with an
+// Idempotent-Replayed header, instead of running again. Requests without the
+// header are handled as usual. It reads the claims set by
+// GetAuthMiddlewareFunc, so it must run after it.
+func (h *handler) idempotent(c *gin.Context) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "idempotency key is too long"})
+		c.Abort()
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		c.Abort()
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	hash := sha256.Sum256(body)
+
+	k, run, err := h.server.BeginIdempotentRequest(c.Request.Context(), &store.IdempotencyKey{
+		UserID:      claims.ID,
+		Key:         key,
+		Method:      c.Request.Method,
+		Path:        c.Request.URL.Path,
+		RequestHash: hex.EncodeToString(hash[:]),
+	})
+	if errors.Is(err, server.ErrIdempotencyKeyReused) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+	if errors.Is(err, server.ErrIdempotencyKeyInUse) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+	if !run {
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(k.StatusCode, gin.MIMEJSON+"; charset=utf-8", []byte(k.ResponseBody))
+		c.Abort()
+		return
+	}
+
+	w := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = w
+
+	completed := false
+	defer func() {
+		// a handler that panicked is treated as a server error, so the key
+		// is released rather than left in progress
+		status := w.Status()
+		if !completed {
+			status = http.StatusInternalServerError
+		}
+
+		// the client may have gone away, which is when the response
+		// matters most
+		ctx := context.WithoutCancel(c.Request.Context())
+		if err := h.server.FinishIdempotentRequest(ctx, k, status, w.body.Bytes()); err != nil {
+			log.Printf("error saving response for idempotency key %d: %v", k.ID, err)
+		}
+	}()
+
+	c.Next()
+	completed = true
+}
+
+// responseRecorder keeps a copy of the response body.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/token"
+	"github.com/codepnw/microservice-ecommerce/totp"
+	"github.com/codepnw/microservice-ecommerce/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	mfaChallengeTTL   = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// recoveryCodeAlphabet leaves out characters that are easy to misread.
+const recoveryCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// startMFAChallenge answers a correct password for a user with MFA enabled.
+// The returned token is only good for POST /login/mfa.
+func (h *handler) startMFAChallenge(c *gin.Context, user *store.User) {
+	sub := token.Subject{UserID: user.ID, Email: user.Email}
+	mfaToken, claims, err := h.TokenMaker.CreateToken(sub, token.MFAChallenge, mfaChallengeTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, MFAChallengeRes{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		ExpiresAt:   claims.RegisteredClaims.ExpiresAt.Time,
+	})
+}
+
+func (h *handler) loginMFA(c *gin.Context) {
+	var req VerifyMFALoginReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, err := h.TokenMaker.VerifyToken(req.MFAToken, token.MFAChallenge)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid mfa token"})
+		return
+	}
+
+	user, err := h.server.GetUserByID(c.Request.Context(), claims.ID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid mfa token"})
+		return
+	}
+
+	mfa, err := h.server.GetUserMFA(c.Request.Context(), user.ID)
+	if err != nil || !mfa.Enabled() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid mfa token"})
+		return
+	}
+
+	if !h.checkSecondFactor(c, mfa, req.Code, req.RecoveryCode) {
+		return
+	}
+
+	h.startSession(c, user, true)
+}
+
+func (h *handler) enrollTOTP(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	mfa, err := h.server.GetUserMFA(c.Request.Context(), claims.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err == nil && mfa.Enabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "mfa is already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.server.SetPendingMFA(c.Request.Context(), claims.ID, secret); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, EnrollTOTPRes{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(h.mfaIssuer, claims.Email, secret),
+	})
+}
+
+// confirmTOTP enables MFA once the user proves their app generates valid
+// codes, and hands out the recovery codes. They are only shown this once.
+func (h *handler) confirmTOTP(c *gin.Context) {
+	var req TOTPCodeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	mfa, err := h.server.GetUserMFA(c.Request.Context(), claims.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "mfa enrollment not started"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if mfa.Enabled() {
+		c.JSON(http.StatusConflict, gin.H{"error": "mfa is already enabled"})
+		return
+	}
+
+	step, ok := totp.Validate(mfa.Secret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.server.ConfirmMFA(c.Request.Context(), claims.ID, step, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, RecoveryCodesRes{RecoveryCodes: codes})
+}
+
+func (h *handler) disableTOTP(c *gin.Context) {
+	var req TOTPCodeReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	mfa, err := h.server.GetUserMFA(c.Request.Context(), claims.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "mfa is not enabled"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if mfa.Enabled() && !h.checkSecondFactor(c, mfa, req.Code, req.RecoveryCode) {
+		return
+	}
+
+	if err := h.server.DeleteMFA(c.Request.Context(), claims.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// checkSecondFactor verifies a TOTP code or, failing that, a recovery code.
+// Wrong codes count towards the lockout. It writes the error response and
+// returns false when the check doesn't pass.
+func (h *handler) checkSecondFactor(c *gin.Context, mfa *store.UserMFA, code, recoveryCode string) bool {
+	if mfa.LockedUntil != nil && time.Now().Before(*mfa.LockedUntil) {
+		retry := int(time.Until(*mfa.LockedUntil).Seconds()) + 1
+		c.Header("Retry-After", strconv.Itoa(retry))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many failed attempts"})
+		return false
+	}
+
+	ok, err := h.verifySecondFactor(c.Request.Context(), mfa, code, recoveryCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !ok {
+		if err := h.server.RecordMFAFailure(c.Request.Context(), mfa.UserID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid code"})
+		return false
+	}
+
+	return true
+}
+
+func (h *handler) verifySecondFactor(ctx context.Context, mfa *store.UserMFA, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		step, ok := totp.Validate(mfa.Secret, code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return h.server.UseTOTPStep(ctx, mfa.UserID, step)
+	}
+
+	if recoveryCode != "" {
+		hash := utils.HashOpaqueToken(normalizeRecoveryCode(recoveryCode))
+		return h.server.UseRecoveryCode(ctx, mfa.UserID, hash)
+	}
+
+	return false, nil
+}
+
+// newRecoveryCodes returns n codes formatted XXXXX-XXXXX and the hashes to
+// store for them.
+func newRecoveryCodes(n int) (codes, hashes []string, err error) {
+	buf := make([]byte, 10)
+	for i := 0; i < n; i++ {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+
+		var sb strings.Builder
+		for j, b := range buf {
+			if j == 5 {
+				sb.WriteByte('-')
+			}
+			sb.WriteByte(recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+		}
+
+		code := sb.String()
+		codes = append(codes, code)
+		hashes = append(hashes, utils.HashOpaqueToken(normalizeRecoveryCode(code)))
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode lets users type codes in any case, with or without
+// the dash.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
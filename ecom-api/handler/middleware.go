@@ -5,17 +5,19 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/codepnw/microservice-ecommerce/ecom-api/server"
+	"github.com/codepnw/microservice-ecommerce/rbac"
 	"github.com/codepnw/microservice-ecommerce/token"
 	"github.com/gin-gonic/gin"
 )
 
 const claimsKey string = "claims"
 
-func GetAuthMiddlewareFunc(tokenMaker *token.JWTMaker) gin.HandlerFunc {
+func GetAuthMiddlewareFunc(tokenMaker *token.JWTMaker, srv *server.Server) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// read the authorization header
-		// verify the token
-		claims, err := verifyClaimsFromAuthHeader(c, tokenMaker)
+		// verify the token and its session
+		claims, err := verifyClaimsFromAuthHeader(c, tokenMaker, srv)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			c.Abort()
@@ -28,30 +30,30 @@ func GetAuthMiddlewareFunc(tokenMaker *token.JWTMaker) gin.HandlerFunc {
 	}
 }
 
-func GetAdminMiddlewareFunc(tokenMaker *token.JWTMaker) gin.HandlerFunc {
+// RequirePermission rejects requests whose user lacks any of perms. It reads
+// the claims set by GetAuthMiddlewareFunc, so it must run after it.
+func RequirePermission(perms ...rbac.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// read the authorization header
-		// verify the token
-		claims, err := verifyClaimsFromAuthHeader(c, tokenMaker)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		claims, ok := claimsFromContext(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 			c.Abort()
 			return
 		}
 
-		if !claims.IsAdmin {
-			c.JSON(http.StatusForbidden, gin.H{"error": "user is not admin"})
-			c.Abort()
-			return
+		for _, p := range perms {
+			if !claims.HasPermission(p) {
+				c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("missing permission %s", p)})
+				c.Abort()
+				return
+			}
 		}
 
-		// pass the payload/claims down the context
-		c.Set(claimsKey, claims)
 		c.Next()
 	}
 }
 
-func verifyClaimsFromAuthHeader(c *gin.Context, tokenMaker *token.JWTMaker) (*token.UserClaims, error) {
+func verifyClaimsFromAuthHeader(c *gin.Context, tokenMaker *token.JWTMaker, srv *server.Server) (*token.UserClaims, error) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
 		return nil, fmt.Errorf("authorization header is missing")
@@ -62,11 +64,26 @@ func verifyClaimsFromAuthHeader(c *gin.Context, tokenMaker *token.JWTMaker) (*to
 		return nil, fmt.Errorf("invalid authorization header")
 	}
 
-	token := fields[1]
-	claims, err := tokenMaker.VerifyToken(token)
+	accessToken := fields[1]
+	claims, err := tokenMaker.VerifyToken(accessToken, token.AccessToken)
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %w", err)
 	}
 
+	// reject tokens whose session was logged out or revoked
+	if err := srv.ValidateSession(c.Request.Context(), claims.SessionID, claims.Email); err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
 	return claims, nil
 }
+
+func claimsFromContext(c *gin.Context) (*token.UserClaims, bool) {
+	v, exists := c.Get(claimsKey)
+	if !exists {
+		return nil, false
+	}
+
+	claims, ok := v.(*token.UserClaims)
+	return claims, ok
+}
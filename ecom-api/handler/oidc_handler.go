@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/server"
+	"github.com/codepnw/microservice-ecommerce/oidc"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+// oidcLogin sends the browser to the provider's sign in page. The state,
+// nonce and PKCE verifier are kept in a signed cookie for the callback.
+func (h *handler) oidcLogin(c *gin.Context) {
+	provider, ok := h.oidcProviders[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown provider"})
+		return
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	stateToken, err := h.TokenMaker.CreateOIDCState(provider.Name(), state, nonce, verifier, oidcStateTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.setOIDCStateCookie(c, stateToken, int(oidcStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce, oidc.CodeChallenge(verifier)))
+}
+
+func (h *handler) oidcCallback(c *gin.Context) {
+	provider, ok := h.oidcProviders[c.Param("provider")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown provider"})
+		return
+	}
+
+	stateToken, err := c.Cookie(oidcStateCookie)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing login state"})
+		return
+	}
+	// the state is single use
+	h.setOIDCStateCookie(c, "", -1)
+
+	state, err := h.TokenMaker.VerifyOIDCState(stateToken)
+	if err != nil || state.Provider != provider.Name() ||
+		subtle.ConstantTimeCompare([]byte(state.State), []byte(c.Query("state"))) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid login state"})
+		return
+	}
+
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login failed: " + e})
+		return
+	}
+
+	tokens, err := provider.Exchange(c.Request.Context(), c.Query("code"), state.CodeVerifier)
+	if err != nil {
+		log.Printf("error exchanging %s authorization code: %v", provider.Name(), err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login failed"})
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(c.Request.Context(), tokens.IDToken, state.Nonce)
+	if err != nil {
+		log.Printf("error verifying %s id token: %v", provider.Name(), err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "login failed"})
+		return
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		c.JSON(http.StatusForbidden, gin.H{"error": "email not verified by provider"})
+		return
+	}
+
+	user, err := h.server.UserForIdentity(c.Request.Context(), server.ExternalIdentity{
+		Provider: provider.Name(),
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		Name:     claims.Name,
+	})
+	if errors.Is(err, server.ErrUnverifiedAccount) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	// the linked account was deleted
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "account not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.completeLogin(c, user)
+}
+
+func (h *handler) setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	// Lax so the cookie comes along on the provider's redirect back to us
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, "/auth/oidc", "", strings.HasPrefix(h.baseURL, "https://"), true)
+}
@@ -1,10 +1,16 @@
 package handler
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/codepnw/microservice-ecommerce/ecom-api/server"
 	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/payment"
+	"github.com/codepnw/microservice-ecommerce/rbac"
+	"github.com/codepnw/microservice-ecommerce/shipping"
 	"github.com/codepnw/microservice-ecommerce/token"
 	"github.com/gin-gonic/gin"
 )
@@ -21,10 +27,23 @@ func (h *handler) createOrder(c *gin.Context) {
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 	}
+	if err := validateOrderItems(o.Items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	so := toStoreOrder(o)
 	so.UserID = claims.(*token.UserClaims).ID
 
+	if !h.orderAddresses(c, so, o) {
+		return
+	}
+
 	created, err := h.server.CreateOrder(c.Request.Context(), so)
+	if isCheckoutError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -53,7 +72,12 @@ func (h *handler) getOrder(c *gin.Context) {
 }
 
 func (h *handler) listOrders(c *gin.Context) {
-	orders, err := h.server.ListOrder(c.Request.Context())
+	includeDeleted, ok := h.includeDeleted(c, rbac.OrdersRead)
+	if !ok {
+		return
+	}
+
+	orders, err := h.server.ListOrder(c.Request.Context(), includeDeleted)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -75,7 +99,33 @@ func (h *handler) deleteOrder(c *gin.Context) {
 		return
 	}
 
-	if err := h.server.DeleteOrder(c.Request.Context(), idInt); err != nil {
+	err = h.server.DeleteOrder(c.Request.Context(), idInt)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *handler) restoreOrder(c *gin.Context) {
+	id := c.Param("id")
+	idInt, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return
+	}
+
+	err = h.server.RestoreOrder(c.Request.Context(), idInt)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deleted order not found"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -85,11 +135,10 @@ func (h *handler) deleteOrder(c *gin.Context) {
 
 func toStoreOrder(o OrderReq) *store.Order {
 	return &store.Order{
-		PaymentMethod: o.PaymentMethod,
-		TaxPrice:      o.TaxPrice,
-		ShippingPrice: o.ShippingPrice,
-		TotalPrice:    o.TotalPrice,
-		Items:         toStoreOrderItem(o.Items),
+		PaymentMethod:  o.PaymentMethod,
+		ShippingMethod: o.ShippingMethod,
+		CouponCode:     normalizeCouponCode(o.CouponCode),
+		Items:          toStoreOrderItem(o.Items),
 	}
 }
 
@@ -110,14 +159,22 @@ func toStoreOrderItem(items []*OrderItem) []store.OrderItem {
 
 func toOrderRes(o *store.Order) OrderRes {
 	return OrderRes{
-		ID:            o.ID,
-		Items:         toOrderItems(o.Items),
-		PaymentMethod: o.PaymentMethod,
-		TaxPrice:      o.TaxPrice,
-		ShippingPrice: o.ShippingPrice,
-		TotalPrice:    o.TotalPrice,
-		CreatedAt:     o.CreatedAt,
-		UpdatedAt:     o.UpdatedAt,
+		ID:              o.ID,
+		Items:           toOrderItems(o.Items),
+		PaymentMethod:   o.PaymentMethod,
+		TaxPrice:        o.TaxPrice,
+		ShippingPrice:   o.ShippingPrice,
+		TotalPrice:      o.TotalPrice,
+		Status:          o.Status,
+		PaidAt:          o.PaidAt,
+		ShippingMethod:  o.ShippingMethod,
+		CouponCode:      o.CouponCode,
+		DiscountPrice:   o.DiscountPrice,
+		RefundedPrice:   o.RefundedPrice,
+		ShippingAddress: toOrderAddressRes(o.ShippingAddress),
+		BillingAddress:  toOrderAddressRes(o.BillingAddress),
+		CreatedAt:       o.CreatedAt,
+		UpdatedAt:       o.UpdatedAt,
 	}
 }
 
@@ -125,12 +182,50 @@ func toOrderItems(items []store.OrderItem) []OrderItem {
 	var res []OrderItem
 	for _, i := range items {
 		res = append(res, OrderItem{
+			ID:        i.ID,
 			Name:      i.Name,
 			Quantity:  i.Quantity,
 			Image:     i.Image,
 			Price:     i.Price,
 			ProductID: i.ProductID,
+			Tax: &OrderItemTax{
+				Name:      i.TaxName,
+				Rate:      i.TaxRate,
+				Inclusive: i.TaxInclusive,
+				Net:       i.NetAmount,
+				Amount:    i.TaxAmount,
+			},
+			Discount:         i.DiscountAmount,
+			RefundedQuantity: i.RefundedQuantity,
 		})
 	}
 	return res
 }
+
+func validateOrderItems(items []*OrderItem) error {
+	if len(items) == 0 {
+		return errors.New("order has no items")
+	}
+	for _, i := range items {
+		if i == nil || i.Quantity <= 0 {
+			return errors.New("item quantity must be positive")
+		}
+	}
+
+	return nil
+}
+
+// isCheckoutError reports whether err was caused by the order itself, such
+// as an unknown product or payment provider, a shipping method that can't
+// deliver it, a product that is out of stock or a coupon that can't be
+// used.
+func isCheckoutError(err error) bool {
+	return errors.Is(err, server.ErrProductNotFound) ||
+		errors.Is(err, payment.ErrUnknownProvider) ||
+		errors.Is(err, shipping.ErrUnknownMethod) ||
+		errors.Is(err, shipping.ErrUnavailable) ||
+		errors.Is(err, server.ErrCouponInvalid) ||
+		errors.Is(err, server.ErrCouponNotApplicable) ||
+		errors.Is(err, store.ErrCouponUsedUp) ||
+		errors.Is(err, store.ErrOutOfStock)
+}
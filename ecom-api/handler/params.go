@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/codepnw/microservice-ecommerce/rbac"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// pageParams reads ?limit= and ?offset=, writing a 400 response if they
+// aren't valid.
+func pageParams(c *gin.Context) (limit, offset int, ok bool) {
+	limit, offset = defaultListLimit, 0
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return 0, 0, false
+		}
+		limit = min(n, maxListLimit)
+	}
+
+	if v := c.Query("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+			return 0, 0, false
+		}
+		offset = n
+	}
+
+	return limit, offset, true
+}
+
+// includeDeleted reads the ?include_deleted=true admin filter. Only users
+// holding perm may see deleted rows; anyone else gets a 403. On public
+// routes the bearer token, if any, is checked here.
+func (h *handler) includeDeleted(c *gin.Context, perm rbac.Permission) (include, ok bool) {
+	if c.Query("include_deleted") != "true" {
+		return false, true
+	}
+
+	claims, exists := claimsFromContext(c)
+	if !exists {
+		verified, err := verifyClaimsFromAuthHeader(c, h.TokenMaker, h.server)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return false, false
+		}
+		claims = verified
+	}
+
+	if !claims.HasPermission(perm) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "missing permission " + string(perm)})
+		return false, false
+	}
+
+	return true, true
+}
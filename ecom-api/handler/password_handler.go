@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/mailer"
+	"github.com/codepnw/microservice-ecommerce/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	passwordResetTTL          = time.Hour
+	passwordResetResendWindow = time.Minute
+)
+
+// forgotPassword mails a reset link. It answers the same way whether or not
+// the account exists so it can't be used to probe for emails.
+func (h *handler) forgotPassword(c *gin.Context) {
+	var req ForgotPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.server.GetUser(c.Request.Context(), req.Email)
+	if err != nil {
+		c.JSON(http.StatusAccepted, nil)
+		return
+	}
+
+	last, err := h.server.GetLatestPasswordReset(c.Request.Context(), user.ID)
+	if err == nil && time.Since(last.CreatedAt) < passwordResetResendWindow {
+		c.JSON(http.StatusAccepted, nil)
+		return
+	}
+
+	tok, hash, err := utils.NewOpaqueToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.server.CreatePasswordReset(c.Request.Context(), &store.PasswordReset{
+		TokenHash: hash,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.baseURL, url.QueryEscape(tok))
+	err = h.mailer.Send(c.Request.Context(), mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. If it was you, open the link below to choose a new one:\n\n%s\n\nThe link expires in 1 hour. If you didn't ask for this, you can ignore this email.\n", user.Name, link),
+	})
+	if err != nil {
+		log.Printf("error sending password reset email to user %d: %v", user.ID, err)
+	}
+
+	c.JSON(http.StatusAccepted, nil)
+}
+
+func (h *handler) resetPassword(c *gin.Context) {
+	var req ResetPasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.passwords.Validate(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashed, err := utils.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.server.ResetPassword(c.Request.Context(), utils.HashOpaqueToken(req.Token), hashed); err != nil {
+		if errors.Is(err, store.ErrInvalidToken) || errors.Is(err, store.ErrTokenExpired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *handler) changePassword(c *gin.Context) {
+	var req ChangePasswordReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	user, err := h.server.GetUserByID(c.Request.Context(), claims.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := utils.CheckPassword(req.CurrentPassword, user.Password); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "current password is wrong"})
+		return
+	}
+
+	if err := h.passwords.Validate(req.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashed, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.server.ChangePassword(c.Request.Context(), user, hashed, claims.SessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/server"
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/payment"
+	"github.com/gin-gonic/gin"
+)
+
+// payOrder pays one of the user's own orders. The attempt is returned
+// whether or not it succeeded.
+func (h *handler) payOrder(c *gin.Context) {
+	var req PayOrderReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return
+	}
+
+	o, err := h.server.GetOrderByID(c.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && o.UserID != claims.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	p, err := h.server.PayOrder(c.Request.Context(), o, req.Token)
+	if errors.Is(err, payment.ErrDeclined) {
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": err.Error(), "payment": toPaymentRes(p)})
+		return
+	}
+	if errors.Is(err, server.ErrOrderNotPayable) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, payment.ErrUnknownProvider) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, toPaymentRes(p))
+}
+
+func (h *handler) listOrderPayments(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return
+	}
+
+	payments, err := h.server.ListOrderPayments(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := ListPaymentRes{Payments: []PaymentRes{}}
+	for _, p := range payments {
+		res.Payments = append(res.Payments, toPaymentRes(&p))
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func toPaymentRes(p *store.Payment) PaymentRes {
+	return PaymentRes{
+		ID:        p.ID,
+		OrderID:   p.OrderID,
+		Provider:  p.Provider,
+		Reference: p.Reference,
+		Status:    p.Status,
+		Amount:    p.Amount,
+		Error:     p.Error,
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+	}
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/server"
+	"github.com/codepnw/microservice-ecommerce/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const exportFileName = "export.json"
+
+// exportMe sends the caller everything we hold about them as a JSON
+// download, or zipped with ?format=zip.
+func (h *handler) exportMe(c *gin.Context) {
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or zip"})
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	user, err := h.server.GetUserByID(c.Request.Context(), claims.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	export, err := h.server.ExportUserData(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := json.MarshalIndent(toUserExportRes(export), "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := fmt.Sprintf("user-%d-export", user.ID)
+	if format == "json" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, name))
+		c.Data(http.StatusOK, "application/json", data)
+		return
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create(exportFileName)
+	if err == nil {
+		_, err = f.Write(data)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, name))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// deleteMe erases the caller's personal data and closes their account.
+// Accounts with a password must confirm it.
+func (h *handler) deleteMe(c *gin.Context) {
+	var req DeleteAccountReq
+	// the body is optional for accounts that only sign in through a provider
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	user, err := h.server.GetUserByID(c.Request.Context(), claims.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	if user.Password != "" {
+		if err := utils.CheckPassword(req.Password, user.Password); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "password is wrong"})
+			return
+		}
+	}
+
+	if err := h.server.EraseUser(c.Request.Context(), user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func toUserExportRes(e *server.UserExport) UserExportRes {
+	res := UserExportRes{
+		ExportedAt: time.Now().UTC(),
+		Profile:    toUserRes(e.User),
+		Sessions:   []SessionRes{},
+		Addresses:  []AddressRes{},
+		Orders:     []OrderRes{},
+		Identities: []IdentityRes{},
+	}
+	for _, s := range e.Sessions {
+		res.Sessions = append(res.Sessions, toSessionRes(&s))
+	}
+	for _, a := range e.Addresses {
+		res.Addresses = append(res.Addresses, toAddressRes(&a))
+	}
+	for _, o := range e.Orders {
+		res.Orders = append(res.Orders, toOrderRes(&o))
+	}
+	for _, i := range e.Identities {
+		res.Identities = append(res.Identities, IdentityRes{
+			Provider:  i.Provider,
+			Subject:   i.Subject,
+			Email:     i.Email,
+			CreatedAt: i.CreatedAt,
+		})
+	}
+
+	return res
+}
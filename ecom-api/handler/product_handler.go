@@ -1,11 +1,14 @@
 package handler
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/rbac"
 	"github.com/gin-gonic/gin"
 )
 
@@ -23,6 +26,7 @@ func (h *handler) createProduct(c *gin.Context) {
 	}
 
 	res := toProductRes(product)
+	setETag(c, product.Version)
 	c.JSON(http.StatusCreated, res)
 }
 
@@ -41,11 +45,17 @@ func (h *handler) getProduct(c *gin.Context) {
 	}
 
 	res := toProductRes(product)
+	setETag(c, product.Version)
 	c.JSON(http.StatusOK, res)
 }
 
 func (h *handler) listProducts(c *gin.Context) {
-	products, err := h.server.ListProducts(c.Request.Context())
+	includeDeleted, ok := h.includeDeleted(c, rbac.ProductsWrite)
+	if !ok {
+		return
+	}
+
+	products, err := h.server.ListProducts(c.Request.Context(), includeDeleted)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -79,16 +89,25 @@ func (h *handler) updateProduct(c *gin.Context) {
 		return
 	}
 
+	if !checkIfMatch(c, product.Version) {
+		return
+	}
+
 	// patch product req
 	patchProductReq(product, p)
 
 	updated, err := h.server.UpdateProduct(c.Request.Context(), product)
+	if errors.Is(err, store.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	res := toProductRes(updated)
+	setETag(c, updated.Version)
 	c.JSON(http.StatusOK, res)
 }
 
@@ -100,7 +119,33 @@ func (h *handler) deleteProduct(c *gin.Context) {
 		return
 	}
 
-	if err := h.server.DeleteProduct(c.Request.Context(), idInt); err != nil {
+	err = h.server.DeleteProduct(c.Request.Context(), idInt)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "product not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *handler) restoreProduct(c *gin.Context) {
+	id := c.Param("id")
+	idInt, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return
+	}
+
+	err = h.server.RestoreProduct(c.Request.Context(), idInt)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deleted product not found"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -118,6 +163,11 @@ func toStoreProduct(p ProductReq) *store.Product {
 		NumReviews:   p.NumReviews,
 		Price:        p.Price,
 		CountInStock: p.CountInStock,
+		WeightGrams:  p.WeightGrams,
+		LengthMM:     p.LengthMM,
+		WidthMM:      p.WidthMM,
+		HeightMM:     p.HeightMM,
+		TaxCategory:  p.TaxCategory,
 	}
 }
 
@@ -132,6 +182,11 @@ func toProductRes(p *store.Product) ProductRes {
 		NumReviews:   p.NumReviews,
 		Price:        p.Price,
 		CountInStock: p.CountInStock,
+		WeightGrams:  p.WeightGrams,
+		LengthMM:     p.LengthMM,
+		WidthMM:      p.WidthMM,
+		HeightMM:     p.HeightMM,
+		TaxCategory:  p.TaxCategory,
 	}
 }
 
@@ -160,6 +215,21 @@ func patchProductReq(product *store.Product, p ProductReq) {
 	if p.CountInStock != 0 {
 		product.CountInStock = p.CountInStock
 	}
+	if p.WeightGrams != 0 {
+		product.WeightGrams = p.WeightGrams
+	}
+	if p.LengthMM != 0 {
+		product.LengthMM = p.LengthMM
+	}
+	if p.WidthMM != 0 {
+		product.WidthMM = p.WidthMM
+	}
+	if p.HeightMM != 0 {
+		product.HeightMM = p.HeightMM
+	}
+	if p.TaxCategory != "" {
+		product.TaxCategory = p.TaxCategory
+	}
 	product.UpdatedAt = toTimePtr(time.Now())
 }
 
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/server"
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/payment"
+	"github.com/gin-gonic/gin"
+)
+
+const maxRefundReasonLength = 255
+
+func (h *handler) refundOrder(c *gin.Context) {
+	var req RefundReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return
+	}
+
+	r := &store.Refund{
+		Amount:    req.Amount,
+		Reason:    strings.TrimSpace(req.Reason),
+		Restock:   req.Restock == nil || *req.Restock,
+		CreatedBy: claims.ID,
+	}
+	if len(r.Reason) > maxRefundReasonLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is too long"})
+		return
+	}
+	for _, i := range req.Items {
+		r.Items = append(r.Items, store.RefundItem{OrderItemID: i.OrderItemID, Quantity: i.Quantity})
+	}
+
+	err = h.server.RefundOrder(c.Request.Context(), id, r)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if errors.Is(err, server.ErrInvalidRefund) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, server.ErrOrderNotRefundable) || errors.Is(err, store.ErrConflict) || errors.Is(err, payment.ErrInvalidState) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, toRefundRes(r))
+}
+
+func (h *handler) listOrderRefunds(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return
+	}
+
+	refunds, err := h.server.ListOrderRefunds(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := ListRefundRes{Refunds: []RefundRes{}}
+	for _, r := range refunds {
+		res.Refunds = append(res.Refunds, toRefundRes(&r))
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func toRefundRes(r *store.Refund) RefundRes {
+	items := []RefundItemRes{}
+	for _, i := range r.Items {
+		items = append(items, RefundItemRes{
+			OrderItemID: i.OrderItemID,
+			ProductID:   i.ProductID,
+			Quantity:    i.Quantity,
+			Amount:      i.Amount,
+		})
+	}
+
+	return RefundRes{
+		ID:        r.ID,
+		OrderID:   r.OrderID,
+		PaymentID: r.PaymentID,
+		Amount:    r.Amount,
+		Reason:    r.Reason,
+		Reference: r.Reference,
+		Status:    r.Status,
+		Restock:   r.Restock,
+		CreatedBy: r.CreatedBy,
+		Items:     items,
+		CreatedAt: r.CreatedAt,
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *handler) getUserRoles(c *gin.Context) {
+	user, ok := h.userFromParam(c)
+	if !ok {
+		return
+	}
+
+	roles, err := h.server.GetUserRoles(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, UserRolesRes{Roles: nonNil(roles)})
+}
+
+func (h *handler) setUserRoles(c *gin.Context) {
+	var req SetUserRolesReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	user, ok := h.userFromParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.server.SetUserRoles(c.Request.Context(), user, req.Roles, claims.ID); err != nil {
+		if errors.Is(err, store.ErrUnknownRole) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	roles, err := h.server.GetUserRoles(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, UserRolesRes{Roles: nonNil(roles)})
+}
+
+func (h *handler) listPrivilegeAudit(c *gin.Context) {
+	user, ok := h.userFromParam(c)
+	if !ok {
+		return
+	}
+
+	entries, err := h.server.ListPrivilegeAudit(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := ListPrivilegeAuditRes{Entries: []PrivilegeAuditRes{}}
+	for _, e := range entries {
+		res.Entries = append(res.Entries, PrivilegeAuditRes{
+			ID:          e.ID,
+			ActorUserID: e.ActorUserID,
+			Action:      e.Action,
+			Role:        e.Role,
+			CreatedAt:   e.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -1,53 +1,131 @@
 package handler
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/codepnw/microservice-ecommerce/rbac"
+	"github.com/gin-gonic/gin"
+)
 
 var r *gin.Engine
 
 func RegisterRoutes(handler *handler) *gin.Engine {
 	r = gin.Default()
 	tokenMaker := handler.TokenMaker
+	srv := handler.server
+	auth := GetAuthMiddlewareFunc(tokenMaker, srv)
+	// honours Idempotency-Key on POSTs that create or charge something
+	idempotent := handler.idempotent
 
 	products := r.Group("/products")
 	{
-		products.POST("/", GetAdminMiddlewareFunc(tokenMaker), handler.createProduct)
+		products.POST("/", auth, RequirePermission(rbac.ProductsWrite), idempotent, handler.createProduct)
 		products.GET("/", handler.listProducts)
 
 		productID := products.Group("/:id")
 		{
 			productID.GET("", handler.getProduct)
-			productID.PATCH("", GetAdminMiddlewareFunc(tokenMaker), handler.updateProduct)
-			productID.DELETE("", GetAdminMiddlewareFunc(tokenMaker), handler.deleteProduct)
+			productID.PATCH("", auth, RequirePermission(rbac.ProductsWrite), handler.updateProduct)
+			productID.DELETE("", auth, RequirePermission(rbac.ProductsWrite), handler.deleteProduct)
+			productID.POST("/restore", auth, RequirePermission(rbac.ProductsWrite), handler.restoreProduct)
 		}
 	}
 
 	orders := r.Group("/orders")
 	{
-		orders.Use(GetAuthMiddlewareFunc(tokenMaker))
+		orders.Use(auth)
 
-		orders.GET("/", GetAdminMiddlewareFunc(tokenMaker), handler.listOrders)
-		orders.POST("/", handler.createOrder)
+		orders.GET("/", RequirePermission(rbac.OrdersRead), handler.listOrders)
+		orders.POST("/", idempotent, handler.createOrder)
 		orders.GET("/myorder", handler.getOrder)
-		orders.DELETE("/:id", handler.deleteOrder)
+		orders.DELETE("/:id", RequirePermission(rbac.OrdersWrite), handler.deleteOrder)
+		orders.POST("/:id/restore", RequirePermission(rbac.OrdersWrite), idempotent, handler.restoreOrder)
+		orders.POST("/:id/pay", idempotent, handler.payOrder)
+		orders.GET("/:id/payments", RequirePermission(rbac.OrdersRead), handler.listOrderPayments)
+		orders.POST("/:id/refunds", RequirePermission(rbac.OrdersRefund), idempotent, handler.refundOrder)
+		orders.GET("/:id/refunds", RequirePermission(rbac.OrdersRead), handler.listOrderRefunds)
+	}
+
+	r.POST("/shipping/quote", auth, handler.quoteShipping)
+
+	webhooks := r.Group("/webhooks")
+	{
+		webhooks.POST("/payments/:provider", handler.paymentWebhook)
+
+		webhooks.GET("/events", auth, RequirePermission(rbac.OrdersWrite), handler.listWebhookEvents)
+		webhooks.POST("/events/:id/replay", auth, RequirePermission(rbac.OrdersWrite), handler.replayWebhookEvent)
+	}
+
+	coupons := r.Group("/coupons")
+	{
+		coupons.Use(auth, RequirePermission(rbac.CouponsWrite))
+
+		coupons.GET("/", handler.listCoupons)
+		coupons.POST("/", idempotent, handler.createCoupon)
+		coupons.GET("/:id", handler.getCoupon)
+		coupons.PATCH("/:id", handler.updateCoupon)
+		coupons.DELETE("/:id", handler.deleteCoupon)
 	}
 
 	users := r.Group("/users")
 	{
 		users.POST("/", handler.createUser)
+		users.POST("/verify", handler.verifyEmail)
+		users.POST("/verify/resend", handler.resendVerification)
 
-		users.GET("/", GetAdminMiddlewareFunc(tokenMaker), handler.listUsers)
-		users.DELETE("/:id", GetAdminMiddlewareFunc(tokenMaker), handler.deleteUser)
+		users.GET("/", auth, RequirePermission(rbac.UsersRead), handler.listUsers)
+		users.GET("/:id", auth, RequirePermission(rbac.UsersRead), handler.getUser)
+		users.PATCH("/:id", auth, RequirePermission(rbac.UsersWrite), handler.adminUpdateUser)
+		users.DELETE("/:id", auth, RequirePermission(rbac.UsersWrite), handler.deleteUser)
+		users.POST("/:id/restore", auth, RequirePermission(rbac.UsersWrite), handler.restoreUser)
+		users.GET("/:id/sessions", auth, RequirePermission(rbac.UsersRead), handler.listUserSessions)
+		users.DELETE("/:id/sessions", auth, RequirePermission(rbac.UsersWrite), handler.revokeUserSessions)
+		users.GET("/:id/roles", auth, RequirePermission(rbac.UsersRead), handler.getUserRoles)
+		users.PUT("/:id/roles", auth, RequirePermission(rbac.RolesWrite), handler.setUserRoles)
+		users.GET("/:id/privilege-audit", auth, RequirePermission(rbac.UsersRead), handler.listPrivilegeAudit)
 
-		users.PATCH("/", GetAuthMiddlewareFunc(tokenMaker), handler.updateUser)
+		users.GET("/me", auth, handler.getMe)
+		users.DELETE("/me", auth, handler.deleteMe)
+		users.GET("/me/export", auth, handler.exportMe)
+		users.GET("/me/addresses", auth, handler.listAddresses)
+		users.POST("/me/addresses", auth, idempotent, handler.createAddress)
+		users.PATCH("/me/addresses/:id", auth, handler.updateAddress)
+		users.DELETE("/me/addresses/:id", auth, handler.deleteAddress)
+		users.PATCH("/", auth, handler.updateUser)
+		users.POST("/me/password", auth, handler.changePassword)
 	}
 
 	// Auth
 	r.POST("/login", handler.loginUser)
-	r.POST("/logout", GetAuthMiddlewareFunc(tokenMaker), handler.logoutUser)
+	r.POST("/login/mfa", handler.loginMFA)
+	r.POST("/logout", auth, handler.logoutUser)
+
+	r.GET("/auth/oidc/:provider/login", handler.oidcLogin)
+	r.GET("/auth/oidc/:provider/callback", handler.oidcCallback)
+
+	r.POST("/password/forgot", handler.forgotPassword)
+	r.POST("/password/reset", handler.resetPassword)
+
+	mfa := r.Group("/mfa")
+	{
+		mfa.Use(auth)
+
+		mfa.POST("/totp/enroll", handler.enrollTOTP)
+		mfa.POST("/totp/confirm", handler.confirmTOTP)
+		mfa.DELETE("/totp", handler.disableTOTP)
+	}
+
+	sessions := r.Group("/sessions")
+	{
+		sessions.Use(auth)
+
+		sessions.GET("/", handler.listSessions)
+		sessions.DELETE("/", handler.revokeAllSessions)
+		sessions.DELETE("/:id", handler.deleteSession)
+	}
 
 	// Token
-	r.POST("/token/renew", GetAuthMiddlewareFunc(tokenMaker), handler.renewAccessToken)
-	r.POST("/token/revoke", GetAuthMiddlewareFunc(tokenMaker), handler.revokeSession)
+	r.POST("/token/renew", auth, handler.renewAccessToken)
+	r.POST("/token/revoke", auth, handler.revokeSession)
+	r.GET("/.well-known/jwks.json", handler.getJWKS)
 
 	return r
 }
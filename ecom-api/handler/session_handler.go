@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/gin-gonic/gin"
+)
+
+func (h *handler) listSessions(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	sessions, err := h.server.ListSessions(c.Request.Context(), claims.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := ListSessionRes{Sessions: []SessionRes{}}
+	for _, s := range sessions {
+		sr := toSessionRes(&s)
+		sr.Current = s.ID == claims.SessionID
+		res.Sessions = append(res.Sessions, sr)
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *handler) deleteSession(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	session, err := h.server.GetSession(c.Request.Context(), c.Param("id"))
+	if err != nil || session.UserEmail != claims.Email {
+		// don't reveal sessions that belong to other users
+		c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+
+	if err := h.server.RevokeSession(c.Request.Context(), session.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// revokeAllSessions logs the caller out everywhere, including the session
+// making the request.
+func (h *handler) revokeAllSessions(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	if err := h.server.RevokeUserSessions(c.Request.Context(), claims.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *handler) listUserSessions(c *gin.Context) {
+	user, ok := h.userFromParam(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.server.ListSessions(c.Request.Context(), user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := ListSessionRes{Sessions: []SessionRes{}}
+	for _, s := range sessions {
+		res.Sessions = append(res.Sessions, toSessionRes(&s))
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+func (h *handler) revokeUserSessions(c *gin.Context) {
+	user, ok := h.userFromParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.server.RevokeUserSessions(c.Request.Context(), user.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// userFromParam loads the user named by the :id path parameter, writing the
+// error response itself when it can't.
+func (h *handler) userFromParam(c *gin.Context) (*store.User, bool) {
+	id := c.Param("id")
+	idInt, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return nil, false
+	}
+
+	user, err := h.server.GetUserByID(c.Request.Context(), idInt)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil, false
+	}
+
+	return user, true
+}
+
+func toSessionRes(s *store.Session) SessionRes {
+	return SessionRes{
+		ID:        s.ID,
+		UserAgent: s.UserAgent,
+		ClientIP:  s.ClientIP,
+		CreatedAt: s.CreatedAt,
+		ExpiresAt: s.ExpiresAt,
+		RevokedAt: s.RevokedAt,
+	}
+}
@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// quoteShipping lists the shipping methods that can deliver a cart to an
+// address and what each costs.
+func (h *handler) quoteShipping(c *gin.Context) {
+	var req ShippingQuoteReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateOrderItems(req.Items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	address, ok := h.shippingAddress(c, claims.ID, req.Address)
+	if !ok {
+		return
+	}
+
+	quotes, err := h.server.QuoteShipping(c.Request.Context(), toStoreOrderItem(req.Items), address)
+	if isCheckoutError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := ShippingQuoteRes{Methods: []ShippingMethodRes{}}
+	for _, q := range quotes {
+		res.Methods = append(res.Methods, ShippingMethodRes{
+			Method: q.Method,
+			Name:   q.Name,
+			Price:  q.Price,
+		})
+	}
+
+	c.JSON(http.StatusOK, res)
+}
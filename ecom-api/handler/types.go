@@ -4,18 +4,57 @@ import (
 	"time"
 
 	"github.com/codepnw/microservice-ecommerce/ecom-api/server"
+	"github.com/codepnw/microservice-ecommerce/mailer"
+	"github.com/codepnw/microservice-ecommerce/oidc"
 	"github.com/codepnw/microservice-ecommerce/token"
+	"github.com/codepnw/microservice-ecommerce/utils"
 )
 
 type handler struct {
 	server     *server.Server
 	TokenMaker *token.JWTMaker
+	mailer     mailer.Mailer
+	baseURL    string
+	passwords  *utils.PasswordPolicy
+
+	requireAdminMFA bool
+	mfaIssuer       string
+	oidcProviders   map[string]*oidc.Provider
+}
+
+// Config holds the handler's dependencies besides the server.
+type Config struct {
+	TokenMaker *token.JWTMaker
+	Mailer     mailer.Mailer
+	// BaseURL is the public address of the web app, used for links in
+	// emails.
+	BaseURL        string
+	PasswordPolicy *utils.PasswordPolicy
+	// RequireAdminMFA withholds role permissions from sessions that were
+	// not started with a second factor.
+	RequireAdminMFA bool
+	// MFAIssuer is the account issuer shown in authenticator apps.
+	MFAIssuer string
+	// OIDCProviders are the identity providers users can sign in with.
+	OIDCProviders []*oidc.Provider
 }
 
-func NewHandler(server *server.Server, secretKey string) *handler {
+func NewHandler(server *server.Server, cfg Config) *handler {
+	providers := make(map[string]*oidc.Provider, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		providers[p.Name()] = p
+	}
+
 	return &handler{
 		server:     server,
-		TokenMaker: token.NewJWTMaker(secretKey),
+		TokenMaker: cfg.TokenMaker,
+		mailer:     cfg.Mailer,
+		baseURL:    cfg.BaseURL,
+		passwords:  cfg.PasswordPolicy,
+
+		requireAdminMFA: cfg.RequireAdminMFA,
+		mfaIssuer:       cfg.MFAIssuer,
+		oidcProviders:   providers,
 	}
 }
 
@@ -29,6 +68,11 @@ type ProductReq struct {
 	NumReviews   int64   `json:"num_reviews"`
 	Price        float64 `json:"price"`
 	CountInStock int64   `json:"count_in_stock"`
+	WeightGrams  int64   `json:"weight_grams"`
+	LengthMM     int64   `json:"length_mm"`
+	WidthMM      int64   `json:"width_mm"`
+	HeightMM     int64   `json:"height_mm"`
+	TaxCategory  string  `json:"tax_category"`
 }
 
 type ProductRes struct {
@@ -41,56 +85,329 @@ type ProductRes struct {
 	NumReviews   int64      `json:"num_reviews"`
 	Price        float64    `json:"price"`
 	CountInStock int64      `json:"count_in_stock"`
+	WeightGrams  int64      `json:"weight_grams"`
+	LengthMM     int64      `json:"length_mm"`
+	WidthMM      int64      `json:"width_mm"`
+	HeightMM     int64      `json:"height_mm"`
+	TaxCategory  string     `json:"tax_category"`
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    *time.Time `json:"updated_at"`
 }
 
 // ========== ORDER ===========
+// OrderReq places an order. Prices, tax and shipping are worked out by the
+// server.
 type OrderReq struct {
-	ID            int64        `json:"id"`
-	Items         []*OrderItem `json:"items"`
-	PaymentMethod string       `json:"payment_method"`
-	TaxPrice      float32      `json:"tax_price"`
-	ShippingPrice float32      `json:"shipping_price"`
-	TotalPrice    float32      `json:"total_price"`
-	Status        string       `json:"status"`
+	ID    int64        `json:"id"`
+	Items []*OrderItem `json:"items"`
+	// PaymentMethod is the payment provider the order will be paid through.
+	// It defaults to the shop's default provider.
+	PaymentMethod string `json:"payment_method"`
+	Status        string `json:"status"`
+	// ShippingMethod defaults to the first method that can deliver the
+	// order.
+	ShippingMethod string `json:"shipping_method"`
+	// ShippingAddress defaults to the user's default address and
+	// BillingAddress to the shipping address.
+	ShippingAddress *OrderAddressReq `json:"shipping_address"`
+	BillingAddress  *OrderAddressReq `json:"billing_address"`
+	CouponCode      string           `json:"coupon_code"`
+}
+
+// OrderAddressReq picks an address from the user's address book by
+// AddressID, or gives one inline.
+type OrderAddressReq struct {
+	AddressID int64 `json:"address_id"`
+	PostalAddress
 }
 
 type OrderItem struct {
+	// ID is only set in responses.
+	ID        int64   `json:"id,omitempty"`
 	Name      string  `json:"name"`
 	Quantity  int64   `json:"quantity"`
 	Image     string  `json:"image"`
 	Price     float64 `json:"price"`
 	ProductID int64   `json:"product_id"`
+	// Tax, Discount and RefundedQuantity are only set in responses.
+	Tax              *OrderItemTax `json:"tax,omitempty"`
+	Discount         float64       `json:"discount,omitempty"`
+	RefundedQuantity int64         `json:"refunded_quantity,omitempty"`
+}
+
+type OrderItemTax struct {
+	Name      string  `json:"name"`
+	Rate      float64 `json:"rate"`
+	Inclusive bool    `json:"inclusive"`
+	Net       float64 `json:"net"`
+	Amount    float64 `json:"amount"`
 }
 
 type OrderRes struct {
-	ID            int64       `json:"id"`
-	Items         []OrderItem `json:"items"`
-	PaymentMethod string      `json:"payment_method"`
-	TaxPrice      float32     `json:"tax_price"`
-	ShippingPrice float32     `json:"shipping_price"`
-	TotalPrice    float32     `json:"total_price"`
-	Status        string      `json:"status"`
-	CreatedAt     time.Time   `json:"created_at"`
-	UpdatedAt     *time.Time  `json:"updated_at"`
-}
-
-type UserReq struct {
+	ID              int64          `json:"id"`
+	Items           []OrderItem    `json:"items"`
+	PaymentMethod   string         `json:"payment_method"`
+	TaxPrice        float32        `json:"tax_price"`
+	ShippingPrice   float32        `json:"shipping_price"`
+	TotalPrice      float32        `json:"total_price"`
+	Status          string         `json:"status"`
+	PaidAt          *time.Time     `json:"paid_at"`
+	ShippingMethod  string         `json:"shipping_method"`
+	CouponCode      string         `json:"coupon_code,omitempty"`
+	DiscountPrice   float32        `json:"discount_price"`
+	RefundedPrice   float64        `json:"refunded_price"`
+	ShippingAddress *PostalAddress `json:"shipping_address"`
+	BillingAddress  *PostalAddress `json:"billing_address"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       *time.Time     `json:"updated_at"`
+}
+
+// PayOrderReq pays an order. Token is the payment method collected by the
+// client for the order's payment provider, e.g. a tokenized card.
+type PayOrderReq struct {
+	Token string `json:"token"`
+}
+
+type PaymentRes struct {
+	ID        int64      `json:"id"`
+	OrderID   int64      `json:"order_id"`
+	Provider  string     `json:"provider"`
+	Reference string     `json:"reference"`
+	Status    string     `json:"status"`
+	Amount    float64    `json:"amount"`
+	Error     string     `json:"error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+type ListPaymentRes struct {
+	Payments []PaymentRes `json:"payments"`
+}
+
+// RefundReq refunds part or all of a paid order. Items are the order items
+// being returned. Amount defaults to the price paid for the items, or to
+// everything not yet refunded when no items are given. Restock defaults to
+// true.
+type RefundReq struct {
+	Items   []RefundItemReq `json:"items"`
+	Amount  float64         `json:"amount"`
+	Reason  string          `json:"reason"`
+	Restock *bool           `json:"restock"`
+}
+
+type RefundItemReq struct {
+	OrderItemID int64 `json:"order_item_id"`
+	Quantity    int64 `json:"quantity"`
+}
+
+type RefundRes struct {
+	ID        int64           `json:"id"`
+	OrderID   int64           `json:"order_id"`
+	PaymentID int64           `json:"payment_id"`
+	Amount    float64         `json:"amount"`
+	Reason    string          `json:"reason"`
+	Reference string          `json:"reference"`
+	Status    string          `json:"status"`
+	Restock   bool            `json:"restock"`
+	CreatedBy int64           `json:"created_by"`
+	Items     []RefundItemRes `json:"items"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type RefundItemRes struct {
+	OrderItemID int64   `json:"order_item_id"`
+	ProductID   int64   `json:"product_id"`
+	Quantity    int64   `json:"quantity"`
+	Amount      float64 `json:"amount"`
+}
+
+type ListRefundRes struct {
+	Refunds []RefundRes `json:"refunds"`
+}
+
+// ========== WEBHOOK ===========
+type WebhookEventRes struct {
+	ID          int64      `json:"id"`
+	Provider    string     `json:"provider"`
+	EventID     string     `json:"event_id"`
+	Type        string     `json:"type"`
+	Reference   string     `json:"reference"`
+	Amount      float64    `json:"amount"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Attempts    int64      `json:"attempts"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ProcessedAt *time.Time `json:"processed_at"`
+}
+
+type ListWebhookEventRes struct {
+	Events []WebhookEventRes `json:"events"`
+}
+
+// ShippingQuoteReq asks what shipping the items would cost. Only the product
+// and quantity of each item are used. Address defaults to the user's default
+// address.
+type ShippingQuoteReq struct {
+	Items   []*OrderItem     `json:"items"`
+	Address *OrderAddressReq `json:"address"`
+}
+
+type ShippingMethodRes struct {
+	Method string  `json:"method"`
+	Name   string  `json:"name"`
+	Price  float64 `json:"price"`
+}
+
+type ShippingQuoteRes struct {
+	Methods []ShippingMethodRes `json:"methods"`
+}
+
+// ========== COUPON ===========
+// CouponReq creates or updates a coupon. Omitted limits and dates mean no
+// limit. On update, ProductIDs and Categories replace the coupon's scope
+// when given; an empty list clears it.
+type CouponReq struct {
+	Code           string     `json:"code"`
+	Type           string     `json:"type"`
+	Value          float64    `json:"value"`
+	MinOrderValue  float64    `json:"min_order_value"`
+	MaxUses        *int64     `json:"max_uses"`
+	MaxUsesPerUser *int64     `json:"max_uses_per_user"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+	ProductIDs     []int64    `json:"product_ids"`
+	Categories     []string   `json:"categories"`
+}
+
+type CouponRes struct {
+	ID             int64      `json:"id"`
+	Code           string     `json:"code"`
+	Type           string     `json:"type"`
+	Value          float64    `json:"value"`
+	MinOrderValue  float64    `json:"min_order_value"`
+	MaxUses        *int64     `json:"max_uses"`
+	MaxUsesPerUser *int64     `json:"max_uses_per_user"`
+	TimesUsed      int64      `json:"times_used"`
+	StartsAt       *time.Time `json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+	ProductIDs     []int64    `json:"product_ids"`
+	Categories     []string   `json:"categories"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      *time.Time `json:"updated_at"`
+}
+
+type ListCouponRes struct {
+	Coupons []CouponRes `json:"coupons"`
+}
+
+// ========== ADDRESS ===========
+type PostalAddress struct {
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	State      string `json:"state"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone"`
+}
+
+// AddressReq adds an address to the address book. When updating, only the
+// fields that are set are changed.
+type AddressReq struct {
+	PostalAddress
+	IsDefault *bool `json:"is_default"`
+}
+
+type AddressRes struct {
+	ID int64 `json:"id"`
+	PostalAddress
+	IsDefault bool       `json:"is_default"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+type ListAddressRes struct {
+	Addresses []AddressRes `json:"addresses"`
+}
+
+// RegisterUserReq is the public sign-up body. Privileges are never taken
+// from it; roles are granted separately by an admin.
+type RegisterUserReq struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
-	IsAdmin  bool   `json:"is_admin"`
+}
+
+// UpdateProfileReq is what users may change about themselves. Passwords are
+// changed through ChangePasswordReq.
+type UpdateProfileReq struct {
+	Name           string `json:"name"`
+	Email          string `json:"email"`
+	Phone          string `json:"phone"`
+	DefaultAddress string `json:"default_address"`
+}
+
+type ChangePasswordReq struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
 }
 
 type UserRes struct {
-	Name    string `json:"name"`
-	Email   string `json:"email"`
-	IsAdmin bool   `json:"is_admin"`
+	ID             int64      `json:"id"`
+	Name           string     `json:"name"`
+	Email          string     `json:"email"`
+	EmailVerified  bool       `json:"email_verified"`
+	Phone          *string    `json:"phone"`
+	DefaultAddress *string    `json:"default_address"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      *time.Time `json:"updated_at"`
 }
 
 type ListUserRes struct {
-	Users []UserRes `json:"users"`
+	Users  []UserRes `json:"users"`
+	Total  int64     `json:"total"`
+	Limit  int       `json:"limit"`
+	Offset int       `json:"offset"`
+}
+
+// DeleteAccountReq confirms an account deletion with the current password.
+type DeleteAccountReq struct {
+	Password string `json:"password"`
+}
+
+type IdentityRes struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserExportRes is the bundle handed out for a data export request.
+type UserExportRes struct {
+	ExportedAt time.Time     `json:"exported_at"`
+	Profile    UserRes       `json:"profile"`
+	Sessions   []SessionRes  `json:"sessions"`
+	Addresses  []AddressRes  `json:"addresses"`
+	Orders     []OrderRes    `json:"orders"`
+	Identities []IdentityRes `json:"identities"`
+}
+
+type VerifyEmailReq struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationReq struct {
+	Email string `json:"email"`
+}
+
+type ForgotPasswordReq struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
 }
 
 type LoginUserReq struct {
@@ -105,6 +422,35 @@ type LoginUserRes struct {
 	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
 	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
 	User                  UserRes   `json:"user"`
+	// MFAEnrollmentRequired tells privileged users their roles stay inactive
+	// until they enrol in MFA and sign in with it.
+	MFAEnrollmentRequired bool `json:"mfa_enrollment_required,omitempty"`
+}
+
+type MFAChallengeRes struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type VerifyMFALoginReq struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type EnrollTOTPRes struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type TOTPCodeReq struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type RecoveryCodesRes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
 }
 
 type RenewAccessTokenReq struct {
@@ -115,3 +461,37 @@ type RenewAccessTokenRes struct {
 	AccessToken          string    `json:"access_token"`
 	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
 }
+
+type SessionRes struct {
+	ID        string     `json:"id"`
+	UserAgent string     `json:"user_agent"`
+	ClientIP  string     `json:"client_ip"`
+	Current   bool       `json:"current"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type ListSessionRes struct {
+	Sessions []SessionRes `json:"sessions"`
+}
+
+type SetUserRolesReq struct {
+	Roles []string `json:"roles"`
+}
+
+type UserRolesRes struct {
+	Roles []string `json:"roles"`
+}
+
+type PrivilegeAuditRes struct {
+	ID          int64     `json:"id"`
+	ActorUserID int64     `json:"actor_user_id"`
+	Action      string    `json:"action"`
+	Role        string    `json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ListPrivilegeAuditRes struct {
+	Entries []PrivilegeAuditRes `json:"entries"`
+}
@@ -1,25 +1,38 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/codepnw/microservice-ecommerce/ecom-api/server"
 	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/rbac"
 	"github.com/codepnw/microservice-ecommerce/token"
 	"github.com/codepnw/microservice-ecommerce/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 func (h *handler) createUser(c *gin.Context) {
-	var u UserReq
+	var u RegisterUserReq
 
 	if err := c.ShouldBindJSON(&u); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if err := h.passwords.Validate(u.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// hash password
 	hashed, err := utils.HashPassword(u.Password)
 	if err != nil {
@@ -34,18 +47,46 @@ func (h *handler) createUser(c *gin.Context) {
 		return
 	}
 
+	// the account still gets created if mailing fails, the user can ask
+	// for another link
+	if err := h.sendVerificationEmail(c.Request.Context(), created); err != nil {
+		log.Printf("error starting email verification: %v", err)
+	}
+
 	res := toUserRes(created)
 	c.JSON(http.StatusCreated, res)
 }
 
+const (
+	maxPhoneLength   = 32
+	maxAddressLength = 512
+)
+
+// listUsers returns a page of users, optionally filtered by ?q= matching
+// name or email. The page is set with ?limit= and ?offset=.
 func (h *handler) listUsers(c *gin.Context) {
-	users, err := h.server.ListUsers(c.Request.Context())
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	includeDeleted, ok := h.includeDeleted(c, rbac.UsersRead)
+	if !ok {
+		return
+	}
+
+	users, total, err := h.server.ListUsers(c.Request.Context(), store.ListUsersParams{
+		Query:          strings.TrimSpace(c.Query("q")),
+		Limit:          limit,
+		Offset:         offset,
+		IncludeDeleted: includeDeleted,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	var res ListUserRes
+	res := ListUserRes{Users: []UserRes{}, Total: total, Limit: limit, Offset: offset}
 	for _, u := range users {
 		res.Users = append(res.Users, toUserRes(&u))
 	}
@@ -53,13 +94,45 @@ func (h *handler) listUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, res)
 }
 
+func (h *handler) getMe(c *gin.Context) {
+	claims, ok := claimsFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	user, err := h.server.GetUserByID(c.Request.Context(), claims.ID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	setETag(c, user.Version)
+	c.JSON(http.StatusOK, toUserRes(user))
+}
+
+func (h *handler) getUser(c *gin.Context) {
+	user, ok := h.userFromParam(c)
+	if !ok {
+		return
+	}
+
+	setETag(c, user.Version)
+	c.JSON(http.StatusOK, toUserRes(user))
+}
+
 func (h *handler) updateUser(c *gin.Context) {
-	var u UserReq
+	var u UpdateProfileReq
 	if err := c.ShouldBindJSON(&u); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	if err := validateProfile(u); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Get Context
 	claims, exists := c.Get(claimsKey)
 	if !exists {
@@ -73,23 +146,88 @@ func (h *handler) updateUser(c *gin.Context) {
 		return
 	}
 
+	if !checkIfMatch(c, user.Version) {
+		return
+	}
+
 	// patch user req
+	oldEmail := user.Email
 	patchUserReq(user, u)
 	if user.Email == "" {
 		user.Email = email
 	}
 
-	updated, err := h.server.UpdateUser(c.Request.Context(), user)
+	updated, err := h.server.UpdateUser(c.Request.Context(), user, oldEmail)
+	if errors.Is(err, store.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.verifyChangedEmail(c.Request.Context(), updated, oldEmail)
 
 	res := toUserRes(updated)
+	setETag(c, updated.Version)
 	c.JSON(http.StatusOK, res)
 }
 
+// adminUpdateUser lets staff correct another user's profile.
+func (h *handler) adminUpdateUser(c *gin.Context) {
+	var u UpdateProfileReq
+	if err := c.ShouldBindJSON(&u); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateProfile(u); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.userFromParam(c)
+	if !ok {
+		return
+	}
+
+	if !checkIfMatch(c, user.Version) {
+		return
+	}
+
+	oldEmail := user.Email
+	patchUserReq(user, u)
+
+	updated, err := h.server.UpdateUser(c.Request.Context(), user, oldEmail)
+	if errors.Is(err, store.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.verifyChangedEmail(c.Request.Context(), updated, oldEmail)
+
+	setETag(c, updated.Version)
+	c.JSON(http.StatusOK, toUserRes(updated))
+}
+
 func (h *handler) deleteUser(c *gin.Context) {
+	user, ok := h.userFromParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.server.DeleteUser(c.Request.Context(), user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *handler) restoreUser(c *gin.Context) {
 	id := c.Param("id")
 	idInt, err := strconv.ParseInt(id, 10, 64)
 	if err != nil {
@@ -97,7 +235,12 @@ func (h *handler) deleteUser(c *gin.Context) {
 		return
 	}
 
-	if err := h.server.DeleteUser(c.Request.Context(), idInt); err != nil {
+	err = h.server.RestoreUser(c.Request.Context(), idInt)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "deleted user not found"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -124,31 +267,94 @@ func (h *handler) loginUser(c *gin.Context) {
 		return
 	}
 
+	// upgrade hashes made with an older algorithm or weaker parameters
+	// while we have the plain password at hand
+	if utils.NeedsRehash(gu.Password) {
+		h.rehashPassword(c.Request.Context(), gu, u.Password)
+	}
+
+	if gu.EmailVerifiedAt == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "email not verified"})
+		return
+	}
+
+	h.completeLogin(c, gu)
+}
+
+// completeLogin finishes a login once the user proved who they are, either
+// by password or through an identity provider. Users with MFA still have to
+// pass the second factor.
+func (h *handler) completeLogin(c *gin.Context, user *store.User) {
+	mfa, err := h.server.GetUserMFA(c.Request.Context(), user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err == nil && mfa.Enabled() {
+		h.startMFAChallenge(c, user)
+		return
+	}
+
+	h.startSession(c, user, false)
+}
+
+// rehashPassword stores a fresh hash of password for user. A failure only
+// means the upgrade is retried on the next login.
+func (h *handler) rehashPassword(ctx context.Context, user *store.User, password string) {
+	hashed, err := utils.HashPassword(password)
+	if err != nil {
+		log.Printf("error rehashing password for user %d: %v", user.ID, err)
+		return
+	}
+
+	if err := h.server.RehashPassword(ctx, user.ID, hashed); err != nil {
+		log.Printf("error rehashing password for user %d: %v", user.ID, err)
+		return
+	}
+
+	user.Password = hashed
+}
+
+// startSession creates a session for user and responds with its access and
+// refresh tokens. mfa records whether a second factor was verified.
+func (h *handler) startSession(c *gin.Context, user *store.User, mfa bool) {
+	sessionID, err := uuid.NewRandom()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// create JWT
-	accessToken, accessClaims, err := h.TokenMaker.CreateToken(gu.ID, gu.Email, gu.IsAdmin, 15*time.Minute)
+	sub, err := h.subjectFor(c.Request.Context(), user, sessionID.String(), mfa)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	refreshToken, refreshClaims, err := h.TokenMaker.CreateToken(gu.ID, gu.Email, gu.IsAdmin, 24*time.Hour)
+	accessToken, accessClaims, err := h.TokenMaker.CreateToken(sub, token.AccessToken, 15*time.Minute)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	log.Println(refreshClaims.RegisteredClaims.ExpiresAt.Time)
+	refreshToken, refreshClaims, err := h.TokenMaker.CreateToken(sub, token.RefreshToken, 24*time.Hour)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	// Session
 	session, err := h.server.CreateSession(c.Request.Context(), &store.Session{
-		ID:           refreshClaims.RegisteredClaims.ID,
-		UserEmail:    gu.Email,
-		RefreshToken: refreshToken,
-		IsRevoked:    false,
-		ExpiresAt:    refreshClaims.RegisteredClaims.ExpiresAt.Time,
+		ID:               sub.SessionID,
+		UserEmail:        user.Email,
+		RefreshTokenHash: utils.HashOpaqueToken(refreshToken),
+		IsRevoked:        false,
+		ExpiresAt:        refreshClaims.RegisteredClaims.ExpiresAt.Time,
+		UserAgent:        c.Request.UserAgent(),
+		ClientIP:         c.ClientIP(),
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error-3": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -158,7 +364,8 @@ func (h *handler) loginUser(c *gin.Context) {
 		RefreshToken:          refreshToken,
 		AccessTokenExpiresAt:  accessClaims.RegisteredClaims.ExpiresAt.Time,
 		RefreshTokenExpiresAt: refreshClaims.RegisteredClaims.ExpiresAt.Time,
-		User:                  toUserRes(gu),
+		User:                  toUserRes(user),
+		MFAEnrollmentRequired: h.requireAdminMFA && !mfa && len(sub.Roles) > 0,
 	}
 
 	c.JSON(http.StatusOK, res)
@@ -170,7 +377,7 @@ func (h *handler) logoutUser(c *gin.Context) {
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 	}
-	id := claims.(*token.UserClaims).RegisteredClaims.ID
+	id := claims.(*token.UserClaims).SessionID
 
 	if err := h.server.DeleteSession(c.Request.Context(), id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -187,29 +394,36 @@ func (h *handler) renewAccessToken(c *gin.Context) {
 		return
 	}
 
-	refreshClaims, err := h.TokenMaker.VerifyToken(req.RefreshToken)
+	refreshClaims, err := h.TokenMaker.VerifyToken(req.RefreshToken, token.RefreshToken)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
-	session, err := h.server.GetSession(c.Request.Context(), refreshClaims.RegisteredClaims.ID)
+	session, err := h.server.ValidateRefreshSession(c.Request.Context(), refreshClaims.SessionID, refreshClaims.Email, req.RefreshToken)
+	if server.IsSessionError(err) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if session.IsRevoked {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+	// pick up role changes made since the session started
+	user, err := h.server.GetUserByID(c.Request.Context(), refreshClaims.ID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid session"})
 		return
 	}
 
-	if session.UserEmail != refreshClaims.Email {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid session"})
+	sub, err := h.subjectFor(c.Request.Context(), user, session.ID, refreshClaims.MFA)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	accessToken, accessClaims, err := h.TokenMaker.CreateToken(refreshClaims.ID, refreshClaims.Email, refreshClaims.IsAdmin, 15*time.Minute)
+	accessToken, accessClaims, err := h.TokenMaker.CreateToken(sub, token.AccessToken, 15*time.Minute)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -229,7 +443,7 @@ func (h *handler) revokeSession(c *gin.Context) {
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 	}
-	id := claims.(*token.UserClaims).RegisteredClaims.ID
+	id := claims.(*token.UserClaims).SessionID
 
 	if err := h.server.RevokeSession(c.Request.Context(), id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -239,39 +453,92 @@ func (h *handler) revokeSession(c *gin.Context) {
 	c.JSON(http.StatusNoContent, nil)
 }
 
-func toStoreUser(u UserReq) *store.User {
+// subjectFor builds the token subject for user with their current roles and
+// permissions. When admins must use MFA and the session was started without
+// it, the roles are kept for display but their permissions are withheld, so
+// the user can still sign in to enrol.
+func (h *handler) subjectFor(ctx context.Context, user *store.User, sessionID string, mfa bool) (token.Subject, error) {
+	roles, err := h.server.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return token.Subject{}, err
+	}
+
+	perms, err := h.server.GetUserPermissions(ctx, user.ID)
+	if err != nil {
+		return token.Subject{}, err
+	}
+
+	if h.requireAdminMFA && !mfa {
+		perms = nil
+	}
+
+	return token.Subject{
+		UserID:      user.ID,
+		Email:       user.Email,
+		Roles:       roles,
+		Permissions: perms,
+		SessionID:   sessionID,
+		MFA:         mfa,
+	}, nil
+}
+
+func toStoreUser(u RegisterUserReq) *store.User {
 	return &store.User{
 		Name:     u.Name,
 		Email:    u.Email,
 		Password: u.Password,
-		IsAdmin:  u.IsAdmin,
 	}
 }
 
 func toUserRes(u *store.User) UserRes {
 	return UserRes{
-		Name:    u.Name,
-		Email:   u.Email,
-		IsAdmin: u.IsAdmin,
+		ID:             u.ID,
+		Name:           u.Name,
+		Email:          u.Email,
+		EmailVerified:  u.EmailVerifiedAt != nil,
+		Phone:          u.Phone,
+		DefaultAddress: u.DefaultAddress,
+		CreatedAt:      u.CreatedAt,
+		UpdatedAt:      u.UpdatedAt,
 	}
 }
 
-func patchUserReq(user *store.User, u UserReq) {
+func patchUserReq(user *store.User, u UpdateProfileReq) {
 	if u.Name != "" {
 		user.Name = u.Name
 	}
 	if u.Email != "" {
 		user.Email = u.Email
 	}
-	if u.Password != "" {
-		hashed, err := utils.HashPassword(u.Password)
-		if err != nil {
-			panic(err)
-		}
-		user.Password = hashed
+	if u.Phone != "" {
+		user.Phone = &u.Phone
 	}
-	if u.IsAdmin {
-		user.IsAdmin = u.IsAdmin
+	if u.DefaultAddress != "" {
+		user.DefaultAddress = &u.DefaultAddress
 	}
 	user.UpdatedAt = toTimePtr(time.Now())
 }
+
+func validateProfile(u UpdateProfileReq) error {
+	if err := validatePhone(u.Phone); err != nil {
+		return err
+	}
+	if len(u.DefaultAddress) > maxAddressLength {
+		return fmt.Errorf("default address must be at most %d characters", maxAddressLength)
+	}
+
+	return nil
+}
+
+func validatePhone(phone string) error {
+	if len(phone) > maxPhoneLength {
+		return fmt.Errorf("phone must be at most %d characters", maxPhoneLength)
+	}
+	for _, r := range phone {
+		if !strings.ContainsRune("+0123456789 -()", r) {
+			return errors.New("phone may only contain digits, spaces, +, - and parentheses")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/server"
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/payment"
+	"github.com/gin-gonic/gin"
+)
+
+const maxWebhookBodySize = 1 << 20
+
+// paymentWebhook receives payment events from a provider. Anything but a
+// 2xx response makes the provider deliver the event again later.
+func (h *handler) paymentWebhook(c *gin.Context) {
+	name := c.Param("provider")
+	verifier, err := h.server.WebhookVerifier(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBodySize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ev, err := verifier.ParseWebhook(c.Request.Header, body)
+	if errors.Is(err, payment.ErrInvalidSignature) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.server.HandlePaymentEvent(c.Request.Context(), name, ev, body); err != nil {
+		log.Printf("error handling %s webhook %s: %v", name, ev.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// listWebhookEvents lists received webhooks, newest first. ?status=failed
+// shows the ones waiting to be replayed.
+func (h *handler) listWebhookEvents(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	events, err := h.server.ListWebhookEvents(c.Request.Context(), c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := ListWebhookEventRes{Events: []WebhookEventRes{}}
+	for _, e := range events {
+		res.Events = append(res.Events, toWebhookEventRes(&e))
+	}
+
+	c.JSON(http.StatusOK, res)
+}
+
+// replayWebhookEvent applies a failed webhook again, e.g. once the payment
+// it is about has been recorded.
+func (h *handler) replayWebhookEvent(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "error pasing ID"})
+		return
+	}
+
+	e, err := h.server.ReplayWebhookEvent(c.Request.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook event not found"})
+		return
+	}
+	if errors.Is(err, server.ErrEventProcessed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil && e == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// a replay that failed again is reported through the event's status
+	c.JSON(http.StatusOK, toWebhookEventRes(e))
+}
+
+func toWebhookEventRes(e *store.WebhookEvent) WebhookEventRes {
+	return WebhookEventRes{
+		ID:          e.ID,
+		Provider:    e.Provider,
+		EventID:     e.EventID,
+		Type:        e.Type,
+		Reference:   e.Reference,
+		Amount:      e.Amount,
+		Status:      e.Status,
+		Error:       e.Error,
+		Attempts:    e.Attempts,
+		CreatedAt:   e.CreatedAt,
+		ProcessedAt: e.ProcessedAt,
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/shipping"
+	"github.com/codepnw/microservice-ecommerce/tax"
+)
+
+// ErrProductNotFound is returned when an order names a product that doesn't
+// exist or was deleted.
+var ErrProductNotFound = errors.New("product not found")
+
+// QuoteShipping prices every shipping method that can deliver items to
+// address. Only the product and quantity of each item are used.
+func (s *Server) QuoteShipping(ctx context.Context, items []store.OrderItem, address store.PostalAddress) ([]shipping.Quote, error) {
+	products, err := s.priceItems(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.shipping.Quotes(shippingItems(items, products), destination(address))
+}
+
+// CreateOrder prices o from the catalog, the tax rules, the chosen shipping
+// method and its coupon, if any, and saves it. Prices sent by the client
+// are ignored.
+func (s *Server) CreateOrder(ctx context.Context, o *store.Order) (*store.Order, error) {
+	provider, err := s.payments.Get(o.PaymentMethod)
+	if err != nil {
+		return nil, err
+	}
+	o.PaymentMethod = provider.Name()
+	o.Status = store.OrderPending
+
+	products, err := s.priceItems(ctx, o.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	var address store.PostalAddress
+	if o.ShippingAddress != nil {
+		address = o.ShippingAddress.PostalAddress
+	}
+	quote, err := s.shipping.Quote(o.ShippingMethod, shippingItems(o.Items, products), destination(address))
+	if err != nil {
+		return nil, err
+	}
+
+	o.ShippingMethod = quote.Method
+	o.ShippingPrice = float32(quote.Price)
+
+	if err := s.applyCoupon(ctx, o, products); err != nil {
+		return nil, err
+	}
+	var shippingDiscount float64
+	if o.Coupon != nil && o.Coupon.Type == store.CouponFreeShipping {
+		shippingDiscount = float64(o.DiscountPrice)
+	}
+
+	// item discounts come off before tax
+	lines := make([]tax.Line, len(o.Items))
+	for i, item := range o.Items {
+		lines[i] = tax.Line{Category: item.TaxCategory, UnitPrice: item.Price, Quantity: item.Quantity, Discount: item.DiscountAmount}
+	}
+
+	// shipping is not taxed
+	var taxTotal, gross float64
+	for i, t := range s.taxes.Calculate(tax.Destination{Country: address.Country, Region: address.State}, lines) {
+		o.Items[i].TaxName = t.Name
+		o.Items[i].TaxRate = t.Rate
+		o.Items[i].TaxInclusive = t.Inclusive
+		o.Items[i].NetAmount = t.Net
+		o.Items[i].TaxAmount = t.Tax
+		taxTotal += t.Tax
+		gross += t.Gross
+	}
+
+	o.TaxPrice = float32(taxTotal)
+	o.TotalPrice = float32(gross + quote.Price - shippingDiscount)
+
+	return s.store.CreateOrder(ctx, o)
+}
+
+// priceItems fills in each item's name, image, price and tax category from
+// the catalog and returns the product of each item.
+func (s *Server) priceItems(ctx context.Context, items []store.OrderItem) ([]store.Product, error) {
+	products := make([]store.Product, len(items))
+	for i := range items {
+		p, err := s.store.GetProduct(ctx, items[i].ProductID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %d", ErrProductNotFound, items[i].ProductID)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		items[i].Name = p.Name
+		items[i].Image = p.Image
+		items[i].Price = p.Price
+		items[i].TaxCategory = p.TaxCategory
+		products[i] = *p
+	}
+
+	return products, nil
+}
+
+// shippingItems returns the items as seen by the shipping calculators.
+func shippingItems(items []store.OrderItem, products []store.Product) []shipping.Item {
+	shipped := make([]shipping.Item, len(items))
+	for i, p := range products {
+		shipped[i] = shipping.Item{
+			Quantity:    items[i].Quantity,
+			UnitPrice:   p.Price,
+			WeightGrams: p.WeightGrams,
+			LengthMM:    p.LengthMM,
+			WidthMM:     p.WidthMM,
+			HeightMM:    p.HeightMM,
+		}
+	}
+
+	return shipped
+}
+
+func destination(a store.PostalAddress) shipping.Destination {
+	return shipping.Destination{
+		Country:    a.Country,
+		State:      a.State,
+		PostalCode: a.PostalCode,
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/payment"
+	"github.com/codepnw/microservice-ecommerce/shipping"
+	"github.com/codepnw/microservice-ecommerce/tax"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateOrderTaxesDiscountedPrices(t *testing.T) {
+	mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	taxes, err := tax.NewEngineFromRules([]tax.Rule{{Country: "US", Name: "Sales tax", Rate: 0.1}})
+	require.NoError(t, err)
+	s := NewServer(store.NewMySQLStore(sqlx.NewDb(mockDB, "sqlmock")), Config{
+		ShippingMethods:  shipping.Methods{&shipping.FlatRate{Code: "standard", Price: 10}},
+		Taxes:            taxes,
+		PaymentProviders: payment.Providers{payment.NewFake("")},
+	})
+
+	mock.ExpectQuery("SELECT * FROM products WHERE id=? AND deleted_at IS NULL").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "price", "created_at"}).AddRow(1, "book", 100, time.Now()))
+	mock.ExpectQuery("SELECT * FROM coupons WHERE code=?").WithArgs("TENOFF").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code", "type", "value", "created_at"}).AddRow(3, "TENOFF", store.CouponPercentage, 10, time.Now()))
+	mock.ExpectQuery("SELECT product_id FROM coupon_products WHERE coupon_id=?").WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"product_id"}))
+	mock.ExpectQuery("SELECT category FROM coupon_categories WHERE coupon_id=?").WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"category"}))
+	// the order is fully priced before it is saved, so stop there
+	mock.ExpectBegin().WillReturnError(errors.New("stop"))
+
+	o := &store.Order{
+		UserID:          1,
+		CouponCode:      "TENOFF",
+		Items:           []store.OrderItem{{ProductID: 1, Quantity: 2}},
+		ShippingAddress: &store.OrderAddress{PostalAddress: store.PostalAddress{Country: "US"}},
+	}
+	_, err = s.CreateOrder(context.Background(), o)
+	require.Error(t, err)
+
+	// 200 less 10% is 180, taxed at 10% on top, plus 10 shipping
+	require.Equal(t, 20.0, o.Items[0].DiscountAmount)
+	require.Equal(t, 180.0, o.Items[0].NetAmount)
+	require.Equal(t, 18.0, o.Items[0].TaxAmount)
+	require.Equal(t, float32(20), o.DiscountPrice)
+	require.Equal(t, float32(18), o.TaxPrice)
+	require.Equal(t, float32(208), o.TotalPrice)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+)
+
+var (
+	// ErrCouponInvalid is returned for a coupon code that doesn't exist or
+	// can't be used right now.
+	ErrCouponInvalid = errors.New("invalid coupon")
+	// ErrCouponNotApplicable is returned when the order doesn't meet the
+	// coupon's conditions.
+	ErrCouponNotApplicable = errors.New("coupon does not apply to this order")
+)
+
+// applyCoupon looks up o.CouponCode and sets the order's discount, spread
+// over the items it covers unless it is off shipping. It does nothing for
+// orders without a code. The coupon is only redeemed once the order is saved.
+func (s *Server) applyCoupon(ctx context.Context, o *store.Order, products []store.Product) error {
+	if o.CouponCode == "" {
+		return nil
+	}
+
+	c, err := s.store.GetCouponByCode(ctx, o.CouponCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrCouponInvalid, o.CouponCode)
+	}
+	if err != nil {
+		return err
+	}
+
+	discount, err := couponDiscount(c, o.Items, products, float64(o.ShippingPrice), time.Now())
+	if err != nil {
+		return err
+	}
+
+	if c.Type != store.CouponFreeShipping {
+		spreadDiscount(c, o.Items, products, discount)
+	}
+
+	o.Coupon = c
+	o.CouponCode = c.Code
+	o.DiscountPrice = float32(discount)
+	return nil
+}
+
+// couponDiscount works out what c takes off an order of items, priced from
+// products, with the given shipping price. Discounts apply to catalog
+// prices, before any tax that is added on top, and never take more than the
+// matching items cost.
+func couponDiscount(c *store.Coupon, items []store.OrderItem, products []store.Product, shippingPrice float64, now time.Time) (float64, error) {
+	if c.StartsAt != nil && now.Before(*c.StartsAt) {
+		return 0, fmt.Errorf("%w: %s is not active yet", ErrCouponInvalid, c.Code)
+	}
+	if c.EndsAt != nil && !now.Before(*c.EndsAt) {
+		return 0, fmt.Errorf("%w: %s has expired", ErrCouponInvalid, c.Code)
+	}
+	if c.MaxUses != nil && c.TimesUsed >= *c.MaxUses {
+		return 0, store.ErrCouponUsedUp
+	}
+
+	var subtotal, eligible float64
+	var matched bool
+	for i, item := range items {
+		amount := item.Price * float64(item.Quantity)
+		subtotal += amount
+		if couponCovers(c, &products[i]) {
+			eligible += amount
+			matched = true
+		}
+	}
+
+	if !matched {
+		return 0, fmt.Errorf("%w: no eligible items", ErrCouponNotApplicable)
+	}
+	if subtotal < c.MinOrderValue {
+		return 0, fmt.Errorf("%w: the order must be at least %.2f", ErrCouponNotApplicable, c.MinOrderValue)
+	}
+
+	var discount float64
+	switch c.Type {
+	case store.CouponPercentage:
+		discount = eligible * c.Value / 100
+	case store.CouponFixed:
+		discount = min(c.Value, eligible)
+	case store.CouponFreeShipping:
+		discount = shippingPrice
+	default:
+		return 0, fmt.Errorf("unknown coupon type %q", c.Type)
+	}
+
+	return roundCents(discount), nil
+}
+
+// spreadDiscount splits discount over the items c covers in proportion to
+// their price, so each line is taxed and refunded on what was paid for it.
+// The last line takes the rounding difference.
+func spreadDiscount(c *store.Coupon, items []store.OrderItem, products []store.Product, discount float64) {
+	var eligible float64
+	last := -1
+	for i, item := range items {
+		if couponCovers(c, &products[i]) {
+			eligible += item.Price * float64(item.Quantity)
+			last = i
+		}
+	}
+	if last < 0 || eligible == 0 {
+		return
+	}
+
+	left := discount
+	for i, item := range items {
+		if !couponCovers(c, &products[i]) {
+			continue
+		}
+		share := roundCents(discount * item.Price * float64(item.Quantity) / eligible)
+		if i == last {
+			share = roundCents(left)
+		}
+		items[i].DiscountAmount = share
+		left -= share
+	}
+}
+
+func couponCovers(c *store.Coupon, p *store.Product) bool {
+	if len(c.ProductIDs) == 0 && len(c.Categories) == 0 {
+		return true
+	}
+
+	return slices.Contains(c.ProductIDs, p.ID) ||
+		slices.ContainsFunc(c.Categories, func(category string) bool {
+			return strings.EqualFold(category, p.Category)
+		})
+}
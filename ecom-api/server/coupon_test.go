@@ -0,0 +1,122 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCouponDiscount(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	items := []store.OrderItem{
+		{ProductID: 1, Price: 100, Quantity: 2},
+		{ProductID: 2, Price: 50, Quantity: 1},
+	}
+	products := []store.Product{
+		{ID: 1, Category: "Books"},
+		{ID: 2, Category: "Toys"},
+	}
+	ptr := func(v int64) *int64 { return &v }
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	tcs := []struct {
+		name     string
+		coupon   store.Coupon
+		discount float64
+		err      error
+	}{
+		{
+			name:     "percentage",
+			coupon:   store.Coupon{Type: store.CouponPercentage, Value: 10},
+			discount: 25,
+		},
+		{
+			name:     "percentage of category",
+			coupon:   store.Coupon{Type: store.CouponPercentage, Value: 15, Categories: []string{"books"}},
+			discount: 30,
+		},
+		{
+			name:     "fixed capped at eligible items",
+			coupon:   store.Coupon{Type: store.CouponFixed, Value: 80, ProductIDs: []int64{2}},
+			discount: 50,
+		},
+		{
+			name:     "free shipping",
+			coupon:   store.Coupon{Type: store.CouponFreeShipping, MinOrderValue: 250},
+			discount: 40,
+		},
+		{
+			name:   "below minimum",
+			coupon: store.Coupon{Type: store.CouponFreeShipping, MinOrderValue: 300},
+			err:    ErrCouponNotApplicable,
+		},
+		{
+			name:   "no eligible items",
+			coupon: store.Coupon{Type: store.CouponFixed, Value: 10, Categories: []string{"garden"}},
+			err:    ErrCouponNotApplicable,
+		},
+		{
+			name:   "not started",
+			coupon: store.Coupon{Type: store.CouponFixed, Value: 10, StartsAt: at(time.Hour)},
+			err:    ErrCouponInvalid,
+		},
+		{
+			name:   "expired",
+			coupon: store.Coupon{Type: store.CouponFixed, Value: 10, StartsAt: at(-48 * time.Hour), EndsAt: at(-time.Hour)},
+			err:    ErrCouponInvalid,
+		},
+		{
+			name:   "used up",
+			coupon: store.Coupon{Type: store.CouponFixed, Value: 10, MaxUses: ptr(5), TimesUsed: 5},
+			err:    store.ErrCouponUsedUp,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			discount, err := couponDiscount(&tc.coupon, items, products, 40, now)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.discount, discount)
+		})
+	}
+}
+
+func TestSpreadDiscount(t *testing.T) {
+	products := []store.Product{
+		{ID: 1, Category: "Books"},
+		{ID: 2, Category: "Toys"},
+		{ID: 3, Category: "Books"},
+	}
+	newItems := func() []store.OrderItem {
+		return []store.OrderItem{
+			{ProductID: 1, Price: 10, Quantity: 1},
+			{ProductID: 2, Price: 50, Quantity: 1},
+			{ProductID: 3, Price: 10, Quantity: 2},
+		}
+	}
+	discounts := func(items []store.OrderItem) []float64 {
+		d := make([]float64, len(items))
+		for i, item := range items {
+			d[i] = item.DiscountAmount
+		}
+		return d
+	}
+
+	items := newItems()
+	spreadDiscount(&store.Coupon{Type: store.CouponPercentage, Value: 10}, items, products, 8)
+	require.Equal(t, []float64{1, 5, 2}, discounts(items))
+
+	// 10 over 10 and 20 of books: the last line takes the rounding
+	items = newItems()
+	spreadDiscount(&store.Coupon{Type: store.CouponFixed, Value: 10, Categories: []string{"books"}}, items, products, 10)
+	require.Equal(t, []float64{3.33, 0, 6.67}, discounts(items))
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+)
+
+const defaultIdempotencyKeyTTL = 24 * time.Hour
+
+var (
+	// ErrIdempotencyKeyReused is returned when a key is sent again with a
+	// different request.
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used for a different request")
+	// ErrIdempotencyKeyInUse is returned when a key is sent again before
+	// the first request with it has finished.
+	ErrIdempotencyKeyInUse = errors.New("a request with this idempotency key is still in progress")
+)
+
+// BeginIdempotentRequest claims k for a request. It reports whether the
+// request should run; if not, the key returned holds the response to
+// replay. Keys that expired are claimed again.
+func (s *Server) BeginIdempotentRequest(ctx context.Context, k *store.IdempotencyKey) (*store.IdempotencyKey, bool, error) {
+	k.ExpiresAt = time.Now().Add(s.idempotencyKeyTTL)
+
+	existing, created, err := s.store.CreateIdempotencyKey(ctx, k)
+	if err != nil {
+		return nil, false, err
+	}
+	if !created && existing.ExpiresAt.Before(time.Now()) {
+		// not purged yet
+		if err := s.store.DeleteIdempotencyKey(ctx, existing.ID); err != nil {
+			return nil, false, err
+		}
+		existing, created, err = s.store.CreateIdempotencyKey(ctx, k)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if created {
+		return existing, true, nil
+	}
+
+	if existing.Method != k.Method || existing.Path != k.Path || existing.RequestHash != k.RequestHash {
+		return nil, false, ErrIdempotencyKeyReused
+	}
+	if existing.StatusCode == 0 {
+		return nil, false, ErrIdempotencyKeyInUse
+	}
+
+	return existing, false, nil
+}
+
+// FinishIdempotentRequest stores the response to the request k was claimed
+// for. Server errors aren't stored, so the request can be retried with the
+// same key.
+func (s *Server) FinishIdempotentRequest(ctx context.Context, k *store.IdempotencyKey, status int, body []byte) error {
+	if status >= http.StatusInternalServerError {
+		return s.store.DeleteIdempotencyKey(ctx, k.ID)
+	}
+
+	k.StatusCode = status
+	k.ResponseBody = string(body)
+	return s.store.SaveIdempotentResponse(ctx, k)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBeginIdempotentRequest(t *testing.T) {
+	ctx := context.Background()
+	insertQuery := `
+		INSERT INTO idempotency_keys (user_id, idem_key, method, path, request_hash, response_body, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE id=id
+	`
+	selectQuery := "SELECT * FROM idempotency_keys WHERE user_id=? AND idem_key=?"
+	columns := []string{"id", "user_id", "idem_key", "method", "path", "request_hash", "status_code", "response_body", "created_at", "expires_at"}
+	newKey := func() *store.IdempotencyKey {
+		return &store.IdempotencyKey{UserID: 1, Key: "key-1", Method: "POST", Path: "/orders/", RequestHash: "abc"}
+	}
+	expectExisting := func(mock sqlmock.Sqlmock, hash string, status int, expiresAt time.Time) {
+		mock.ExpectExec(insertQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(selectQuery).WithArgs(1, "key-1").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 1, "key-1", "POST", "/orders/", hash, status, `{"id":7}`, time.Now(), expiresAt))
+	}
+	later := time.Now().Add(time.Hour)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "first request",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertQuery).WithArgs(1, "key-1", "POST", "/orders/", "abc", "", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(4, 1))
+
+				k, run, err := s.BeginIdempotentRequest(ctx, newKey())
+				require.NoError(t, err)
+				require.True(t, run)
+				require.Equal(t, int64(4), k.ID)
+				require.WithinDuration(t, time.Now().Add(defaultIdempotencyKeyTTL), k.ExpiresAt, time.Minute)
+			},
+		},
+		{
+			name: "retry",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				expectExisting(mock, "abc", 201, later)
+
+				k, run, err := s.BeginIdempotentRequest(ctx, newKey())
+				require.NoError(t, err)
+				require.False(t, run)
+				require.Equal(t, 201, k.StatusCode)
+				require.Equal(t, `{"id":7}`, k.ResponseBody)
+			},
+		},
+		{
+			name: "different body",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				expectExisting(mock, "def", 201, later)
+
+				_, _, err := s.BeginIdempotentRequest(ctx, newKey())
+				require.ErrorIs(t, err, ErrIdempotencyKeyReused)
+			},
+		},
+		{
+			name: "still running",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				expectExisting(mock, "abc", 0, later)
+
+				_, _, err := s.BeginIdempotentRequest(ctx, newKey())
+				require.ErrorIs(t, err, ErrIdempotencyKeyInUse)
+			},
+		},
+		{
+			name: "expired",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				expectExisting(mock, "def", 201, time.Now().Add(-time.Minute))
+				mock.ExpectExec("DELETE FROM idempotency_keys WHERE id=?").WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(insertQuery).WillReturnResult(sqlmock.NewResult(4, 1))
+
+				k, run, err := s.BeginIdempotentRequest(ctx, newKey())
+				require.NoError(t, err)
+				require.True(t, run)
+				require.Equal(t, int64(4), k.ID)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, tc.test)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+)
+
+// ErrUnverifiedAccount is returned when an external identity's email
+// belongs to an account that never verified it. Linking would let whoever
+// registered that account sign in as the identity's owner.
+var ErrUnverifiedAccount = errors.New("an account with this email exists but is not verified")
+
+// ExternalIdentity is a user as asserted by an OpenID Connect provider. The
+// email must have been verified by the provider.
+type ExternalIdentity struct {
+	Provider string
+	Subject  string
+	Email    string
+	Name     string
+}
+
+// UserForIdentity returns the user linked to identity. The first time an
+// identity is seen it is linked to the account with the same email, or a
+// new account without a password is created for it.
+func (s *Server) UserForIdentity(ctx context.Context, identity ExternalIdentity) (*store.User, error) {
+	linked, err := s.store.GetUserIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		return s.store.GetUserByID(ctx, linked.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	link := &store.UserIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	user, err := s.store.GetUser(ctx, identity.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		// an empty password hash never matches, so the account can only
+		// sign in through the provider until a password is set by reset
+		return s.store.CreateUserWithIdentity(ctx, &store.User{
+			Name:  identity.Name,
+			Email: identity.Email,
+		}, link)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		return nil, ErrUnverifiedAccount
+	}
+
+	link.UserID = user.ID
+	if err := s.store.CreateUserIdentity(ctx, link); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/payment"
+)
+
+// ErrOrderNotPayable is returned when paying an order that isn't awaiting
+// payment.
+var ErrOrderNotPayable = errors.New("order is not awaiting payment")
+
+const maxPaymentErrorLength = 255
+
+// PayOrder takes the order's total through its payment provider with the
+// payment method in token, and marks the order paid once the payment is
+// captured. Every attempt is recorded; a failed one leaves the order
+// pending so it can be paid again.
+func (s *Server) PayOrder(ctx context.Context, o *store.Order, token string) (*store.Payment, error) {
+	if o.Status != store.OrderPending {
+		return nil, ErrOrderNotPayable
+	}
+
+	provider, err := s.payments.Get(o.PaymentMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := s.store.CreatePayment(ctx, &store.Payment{
+		OrderID:  o.ID,
+		Provider: provider.Name(),
+		Status:   store.PaymentPending,
+		Amount:   roundCents(float64(o.TotalPrice)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing to charge, e.g. when a coupon covers the whole order
+	if p.Amount <= 0 {
+		return p, s.markPaid(ctx, o, provider, p)
+	}
+
+	ref, err := provider.Authorize(ctx, payment.AuthorizeRequest{OrderID: o.ID, Amount: p.Amount, Token: token})
+	if err != nil {
+		return p, s.failPayment(ctx, p, err)
+	}
+
+	p.Reference = ref
+	p.Status = store.PaymentAuthorized
+	if err := s.store.UpdatePayment(ctx, p); err != nil {
+		return p, err
+	}
+
+	if err := provider.Capture(ctx, ref, p.Amount); err != nil {
+		if vErr := provider.Void(ctx, ref); vErr != nil {
+			log.Printf("error voiding payment %d: %v", p.ID, vErr)
+		}
+		return p, s.failPayment(ctx, p, err)
+	}
+
+	return p, s.markPaid(ctx, o, provider, p)
+}
+
+func (s *Server) ListOrderPayments(ctx context.Context, orderID int64) ([]store.Payment, error) {
+	return s.store.ListOrderPayments(ctx, orderID)
+}
+
+func (s *Server) markPaid(ctx context.Context, o *store.Order, provider payment.Provider, p *store.Payment) error {
+	if err := s.capturePayment(ctx, provider, p); err != nil {
+		return err
+	}
+
+	o.Status = store.OrderPaid
+	return nil
+}
+
+// capturePayment marks p's order paid. If another request captured p in
+// the meantime, e.g. its webhook racing the checkout, there is nothing left
+// to do. If another payment paid the order, p is refunded.
+func (s *Server) capturePayment(ctx context.Context, provider payment.Provider, p *store.Payment) error {
+	err := s.store.CapturePayment(ctx, p)
+	if errors.Is(err, store.ErrConflict) {
+		captured, lErr := s.capturedPayment(ctx, p.OrderID)
+		if lErr != nil && !errors.Is(lErr, ErrOrderNotRefundable) {
+			return lErr
+		}
+		if captured != nil && captured.ID == p.ID {
+			*p = *captured
+			return nil
+		}
+
+		if p.Amount > 0 {
+			if _, rErr := provider.Refund(ctx, p.Reference, p.Amount); rErr != nil {
+				log.Printf("error refunding duplicate payment %d: %v", p.ID, rErr)
+			}
+		}
+		return s.failPayment(ctx, p, ErrOrderNotPayable)
+	}
+	return err
+}
+
+// failPayment records why p failed and returns cause.
+func (s *Server) failPayment(ctx context.Context, p *store.Payment, cause error) error {
+	p.Status = store.PaymentFailed
+	p.Error = cause.Error()
+	if len(p.Error) > maxPaymentErrorLength {
+		p.Error = p.Error[:maxPaymentErrorLength]
+	}
+
+	if err := s.store.UpdatePayment(ctx, p); err != nil {
+		return fmt.Errorf("%w (and %v)", cause, err)
+	}
+
+	return cause
+}
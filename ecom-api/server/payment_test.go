@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/payment"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayOrder(t *testing.T) {
+	insertQuery := "INSERT INTO payments (order_id, provider, reference, status, amount, error) VALUES (?, ?, ?, ?, ?, ?)"
+	updateQuery := "UPDATE payments SET reference=?, status=?, error=?, updated_at=NOW() WHERE id=?"
+	paymentColumns := []string{"id", "order_id", "provider", "reference", "status", "amount", "error", "created_at", "updated_at"}
+	newOrder := func() *store.Order {
+		return &store.Order{ID: 9, PaymentMethod: "fake", TotalPrice: 129.99, Status: store.OrderPending}
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "paid",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				o := newOrder()
+				mock.ExpectExec(insertQuery).WithArgs(9, "fake", "", store.PaymentPending, 129.99, "").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(updateQuery).WithArgs("fake_auth_1", store.PaymentAuthorized, "", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE orders SET status=?, paid_at=NOW(), updated_at=NOW() WHERE id=? AND status=?").WithArgs(store.OrderPaid, 9, store.OrderPending).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE payments SET status=?, updated_at=NOW() WHERE id=?").WithArgs(store.PaymentCaptured, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				p, err := s.PayOrder(context.Background(), o, "tok_visa")
+				require.NoError(t, err)
+				require.Equal(t, store.PaymentCaptured, p.Status)
+				require.Equal(t, store.OrderPaid, o.Status)
+			},
+		},
+		{
+			name: "captured by its webhook meanwhile",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				o := newOrder()
+				mock.ExpectExec(insertQuery).WithArgs(9, "fake", "", store.PaymentPending, 129.99, "").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(updateQuery).WithArgs("fake_auth_1", store.PaymentAuthorized, "", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE orders SET status=?, paid_at=NOW(), updated_at=NOW() WHERE id=? AND status=?").WithArgs(store.OrderPaid, 9, store.OrderPending).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+				mock.ExpectQuery("SELECT * FROM payments WHERE order_id=? ORDER BY id").WithArgs(9).
+					WillReturnRows(sqlmock.NewRows(paymentColumns).AddRow(1, 9, "fake", "fake_auth_1", store.PaymentCaptured, 129.99, "", time.Now(), nil))
+
+				p, err := s.PayOrder(context.Background(), o, "tok_visa")
+				require.NoError(t, err)
+				require.Equal(t, store.PaymentCaptured, p.Status)
+				require.Equal(t, store.OrderPaid, o.Status)
+			},
+		},
+		{
+			name: "paid by another payment",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				o := newOrder()
+				mock.ExpectExec(insertQuery).WithArgs(9, "fake", "", store.PaymentPending, 129.99, "").WillReturnResult(sqlmock.NewResult(3, 1))
+				mock.ExpectExec(updateQuery).WithArgs("fake_auth_1", store.PaymentAuthorized, "", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE orders SET status=?, paid_at=NOW(), updated_at=NOW() WHERE id=? AND status=?").WithArgs(store.OrderPaid, 9, store.OrderPending).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+				mock.ExpectQuery("SELECT * FROM payments WHERE order_id=? ORDER BY id").WithArgs(9).
+					WillReturnRows(sqlmock.NewRows(paymentColumns).
+						AddRow(1, 9, "fake", "fake_auth_0", store.PaymentCaptured, 129.99, "", time.Now(), nil).
+						AddRow(3, 9, "fake", "fake_auth_1", store.PaymentAuthorized, 129.99, "", time.Now(), nil))
+				mock.ExpectExec(updateQuery).WithArgs("fake_auth_1", store.PaymentFailed, ErrOrderNotPayable.Error(), 3).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				p, err := s.PayOrder(context.Background(), o, "tok_visa")
+				require.ErrorIs(t, err, ErrOrderNotPayable)
+				require.Equal(t, store.PaymentFailed, p.Status)
+
+				// the duplicate was refunded in full
+				_, err = s.payments[0].Refund(context.Background(), "fake_auth_1", 0.01)
+				require.ErrorIs(t, err, payment.ErrInvalidState)
+			},
+		},
+		{
+			name: "declined",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				o := newOrder()
+				mock.ExpectExec(insertQuery).WithArgs(9, "fake", "", store.PaymentPending, 129.99, "").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(updateQuery).WithArgs("", store.PaymentFailed, payment.ErrDeclined.Error(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				p, err := s.PayOrder(context.Background(), o, payment.FakeTokenDeclined)
+				require.ErrorIs(t, err, payment.ErrDeclined)
+				require.Equal(t, store.PaymentFailed, p.Status)
+				require.Equal(t, store.OrderPending, o.Status)
+			},
+		},
+		{
+			name: "capture declined",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				o := newOrder()
+				mock.ExpectExec(insertQuery).WithArgs(9, "fake", "", store.PaymentPending, 129.99, "").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(updateQuery).WithArgs("fake_auth_1", store.PaymentAuthorized, "", 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(updateQuery).WithArgs("fake_auth_1", store.PaymentFailed, payment.ErrDeclined.Error(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				_, err := s.PayOrder(context.Background(), o, payment.FakeTokenCaptureDeclined)
+				require.ErrorIs(t, err, payment.ErrDeclined)
+			},
+		},
+		{
+			name: "already paid",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				o := newOrder()
+				o.Status = store.OrderPaid
+
+				_, err := s.PayOrder(context.Background(), o, "tok_visa")
+				require.ErrorIs(t, err, ErrOrderNotPayable)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, tc.test)
+		})
+	}
+}
+
+// withTestServer runs fn against a server backed by a mock database and the
+// fake payment provider.
+func withTestServer(t *testing.T, fn func(*testing.T, *Server, sqlmock.Sqlmock)) {
+	mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	s := NewServer(store.NewMySQLStore(sqlx.NewDb(mockDB, "sqlmock")), Config{
+		PaymentProviders: payment.Providers{payment.NewFake("")},
+	})
+	fn(t, s, mock)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
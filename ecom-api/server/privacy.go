@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+)
+
+// UserExport is all the personal data held about a user.
+type UserExport struct {
+	User       *store.User
+	Sessions   []store.Session
+	Addresses  []store.Address
+	Orders     []store.Order
+	Identities []store.UserIdentity
+}
+
+// ExportUserData collects the user's profile, sessions, address book, orders
+// and linked identities for a data export request.
+func (s *Server) ExportUserData(ctx context.Context, u *store.User) (*UserExport, error) {
+	sessions, err := s.store.ListSessionHistory(ctx, u.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses, err := s.store.ListAddresses(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := s.store.ListUserOrders(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	identities, err := s.store.ListUserIdentities(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserExport{
+		User:       u,
+		Sessions:   sessions,
+		Addresses:  addresses,
+		Orders:     orders,
+		Identities: identities,
+	}, nil
+}
+
+// EraseUser anonymises the user's personal data and closes the account.
+// Their orders are kept for accounting.
+func (s *Server) EraseUser(ctx context.Context, u *store.User) error {
+	if err := s.store.AnonymizeUser(ctx, u); err != nil {
+		return err
+	}
+
+	s.sessions.invalidateEmail(u.Email)
+	return nil
+}
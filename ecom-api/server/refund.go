@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/payment"
+)
+
+var (
+	// ErrOrderNotRefundable is returned for an order that wasn't paid or
+	// was refunded in full already.
+	ErrOrderNotRefundable = errors.New("order has nothing to refund")
+	// ErrInvalidRefund is returned for a refund that doesn't fit the order,
+	// such as one for more units than were bought.
+	ErrInvalidRefund = errors.New("invalid refund")
+)
+
+// RefundOrder refunds r through the payment that paid the order and
+// records it. r.Items name the order items and quantities being returned;
+// the rest of each item is filled in. A zero r.Amount is worked out from
+// the items, or refunds whatever is left when there are none.
+//
+// The refund is recorded as pending before the provider is asked for it,
+// so a concurrent refund of the same order fails with store.ErrConflict
+// instead of refunding twice. It is cancelled if the provider refuses.
+func (s *Server) RefundOrder(ctx context.Context, orderID int64, r *store.Refund) error {
+	o, err := s.store.GetOrderByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if o.Status != store.OrderPaid && o.Status != store.OrderPartiallyRefunded {
+		return ErrOrderNotRefundable
+	}
+
+	p, err := s.capturedPayment(ctx, o.ID)
+	if err != nil {
+		return err
+	}
+	remaining := roundCents(p.Amount - o.RefundedPrice)
+
+	full := len(r.Items) == 0 && r.Amount == 0
+	if full {
+		for _, item := range o.Items {
+			if left := item.Quantity - item.RefundedQuantity; left > 0 {
+				r.Items = append(r.Items, store.RefundItem{OrderItemID: item.ID, Quantity: left})
+			}
+		}
+	}
+
+	var itemsAmount float64
+	for i := range r.Items {
+		if err := fillRefundItem(o, &r.Items[i]); err != nil {
+			return err
+		}
+		itemsAmount += r.Items[i].Amount
+	}
+
+	switch {
+	case full:
+		r.Amount = remaining
+	case r.Amount == 0:
+		r.Amount = roundCents(itemsAmount)
+	}
+	if r.Amount < 0 || r.Amount > remaining {
+		return fmt.Errorf("%w: amount must be between 0 and %.2f", ErrInvalidRefund, remaining)
+	}
+	if r.Amount == 0 && len(r.Items) == 0 {
+		return ErrOrderNotRefundable
+	}
+
+	r.OrderID = o.ID
+	r.PaymentID = p.ID
+	r.Status = store.RefundCompleted
+
+	var provider payment.Provider
+	if r.Amount > 0 && p.Reference != "" {
+		if provider, err = s.payments.Get(p.Provider); err != nil {
+			return err
+		}
+		r.Status = store.RefundPending
+	}
+
+	o.Status = store.OrderPartiallyRefunded
+	if (p.Amount > 0 && roundCents(o.RefundedPrice+r.Amount) >= p.Amount) || allReturned(o, r) {
+		o.Status = store.OrderRefunded
+	}
+
+	if err := s.store.CreateRefund(ctx, o, r); err != nil {
+		return err
+	}
+	if provider == nil {
+		return nil
+	}
+
+	ref, err := provider.Refund(ctx, p.Reference, r.Amount)
+	if err != nil {
+		if cErr := s.store.CancelRefund(ctx, r); cErr != nil {
+			log.Printf("error cancelling refund %d of order %d: %v", r.ID, o.ID, cErr)
+		}
+		return err
+	}
+
+	r.Reference = ref
+	if err := s.store.CompleteRefund(ctx, r); err != nil {
+		log.Printf("refund %s of order %d was made but not recorded: %v", r.Reference, o.ID, err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) ListOrderRefunds(ctx context.Context, orderID int64) ([]store.Refund, error) {
+	return s.store.ListOrderRefunds(ctx, orderID)
+}
+
+func (s *Server) capturedPayment(ctx context.Context, orderID int64) (*store.Payment, error) {
+	payments, err := s.store.ListOrderPayments(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range payments {
+		if payments[i].Status == store.PaymentCaptured {
+			return &payments[i], nil
+		}
+	}
+
+	return nil, ErrOrderNotRefundable
+}
+
+// fillRefundItem checks ri against the order and works out its share of
+// what was paid for the item, tax included and coupon discount taken off.
+func fillRefundItem(o *store.Order, ri *store.RefundItem) error {
+	for _, item := range o.Items {
+		if item.ID != ri.OrderItemID {
+			continue
+		}
+
+		if left := item.Quantity - item.RefundedQuantity; ri.Quantity <= 0 || ri.Quantity > left {
+			return fmt.Errorf("%w: item %d has %d units left to refund", ErrInvalidRefund, item.ID, left)
+		}
+
+		// the net amount already has the item's discount taken off
+		gross := item.NetAmount + item.TaxAmount
+		// orders placed before tax was tracked
+		if gross == 0 {
+			gross = item.Price*float64(item.Quantity) - item.DiscountAmount
+		}
+
+		ri.ProductID = item.ProductID
+		ri.Amount = roundCents(gross * float64(ri.Quantity) / float64(item.Quantity))
+		return nil
+	}
+
+	return fmt.Errorf("%w: order has no item %d", ErrInvalidRefund, ri.OrderItemID)
+}
+
+// allReturned reports whether r returns everything that is left of o.
+func allReturned(o *store.Order, r *store.Refund) bool {
+	returned := make(map[int64]int64, len(r.Items))
+	for _, ri := range r.Items {
+		returned[ri.OrderItemID] += ri.Quantity
+	}
+
+	for _, item := range o.Items {
+		if item.RefundedQuantity+returned[item.ID] < item.Quantity {
+			return false
+		}
+	}
+
+	return len(o.Items) > 0
+}
+
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/payment"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefundOrder(t *testing.T) {
+	ctx := context.Background()
+	paymentColumns := []string{"id", "order_id", "provider", "reference", "status", "amount", "error", "created_at", "updated_at"}
+
+	// order 9 bought 2 × item 11 at 107 including tax and paid 214
+	expectOrder := func(mock sqlmock.Sqlmock, status string, refunded float64, refundedQuantity int64) {
+		mock.ExpectQuery("SELECT * FROM orders WHERE id=? AND deleted_at IS NULL").WithArgs(9).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status", "refunded_price", "total_price", "created_at"}).AddRow(9, status, refunded, 214, time.Now()))
+		mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=?").WithArgs(9).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "product_id", "quantity", "price", "net_amount", "tax_amount", "refunded_quantity"}).AddRow(11, 9, 4, 2, 107, 200, 14, refundedQuantity))
+		mock.ExpectQuery("SELECT * FROM order_addresses WHERE order_id=?").WithArgs(9).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT * FROM payments WHERE order_id=? ORDER BY id").WithArgs(9).
+			WillReturnRows(sqlmock.NewRows(paymentColumns).AddRow(2, 9, "fake", "fake_auth_1", store.PaymentCaptured, 214, "", time.Now(), nil))
+	}
+	// capture the payment on the fake provider so it can be refunded
+	capture := func(t *testing.T, s *Server) *payment.Fake {
+		f := s.payments[0].(*payment.Fake)
+		ref, err := f.Authorize(ctx, payment.AuthorizeRequest{OrderID: 9, Amount: 214, Token: "tok_visa"})
+		require.NoError(t, err)
+		require.NoError(t, f.Capture(ctx, ref, 214))
+		return f
+	}
+	refundQuery := "INSERT INTO refunds (order_id, payment_id, amount, reason, reference, status, restock, created_by) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"
+	itemQuery := "INSERT INTO refund_items (refund_id, order_item_id, product_id, quantity, amount) VALUES (?, ?, ?, ?, ?)"
+	quantityQuery := "UPDATE order_items SET refunded_quantity=refunded_quantity+? WHERE id=? AND order_id=? AND refunded_quantity+? <= quantity"
+	orderQuery := "UPDATE orders SET refunded_price=refunded_price+?, status=?, updated_at=NOW() WHERE id=? AND refunded_price=?"
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "one unit",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				capture(t, s)
+				expectOrder(mock, store.OrderPaid, 0, 0)
+				mock.ExpectBegin()
+				mock.ExpectExec(refundQuery).WithArgs(9, 2, 107.0, "", "", store.RefundPending, true, 1).WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectExec(itemQuery).WithArgs(5, 11, 4, 1, 107.0).WillReturnResult(sqlmock.NewResult(6, 1))
+				mock.ExpectExec(quantityQuery).WithArgs(1, 11, 9, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(orderQuery).WithArgs(107.0, store.OrderPartiallyRefunded, 9, 0.0).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE refunds SET status=?, reference=? WHERE id=? AND status=?").
+					WithArgs(store.RefundCompleted, "fake_refund_2", 5, store.RefundPending).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE products SET count_in_stock=count_in_stock+? WHERE id=?").WithArgs(1, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				r := &store.Refund{Restock: true, CreatedBy: 1, Items: []store.RefundItem{{OrderItemID: 11, Quantity: 1}}}
+				err := s.RefundOrder(ctx, 9, r)
+				require.NoError(t, err)
+				require.Equal(t, "fake_refund_2", r.Reference)
+				require.Equal(t, store.RefundCompleted, r.Status)
+			},
+		},
+		{
+			name: "refunded concurrently",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				f := capture(t, s)
+				expectOrder(mock, store.OrderPaid, 0, 0)
+				mock.ExpectBegin()
+				mock.ExpectExec(refundQuery).WithArgs(9, 2, 107.0, "", "", store.RefundPending, false, 1).WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectExec(itemQuery).WithArgs(5, 11, 4, 1, 107.0).WillReturnResult(sqlmock.NewResult(6, 1))
+				mock.ExpectExec(quantityQuery).WithArgs(1, 11, 9, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				// another refund moved refunded_price on
+				mock.ExpectExec(orderQuery).WithArgs(107.0, store.OrderPartiallyRefunded, 9, 0.0).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				r := &store.Refund{CreatedBy: 1, Items: []store.RefundItem{{OrderItemID: 11, Quantity: 1}}}
+				err := s.RefundOrder(ctx, 9, r)
+				require.ErrorIs(t, err, store.ErrConflict)
+
+				// the provider was never asked, so all of it can still be refunded
+				_, err = f.Refund(ctx, "fake_auth_1", 214)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "rest of the order",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				expectOrder(mock, store.OrderPartiallyRefunded, 107, 1)
+				mock.ExpectBegin()
+				mock.ExpectExec(refundQuery).WithArgs(9, 2, 107.0, "", "", store.RefundPending, false, 1).WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectExec(itemQuery).WithArgs(5, 11, 4, 1, 107.0).WillReturnResult(sqlmock.NewResult(6, 1))
+				mock.ExpectExec(quantityQuery).WithArgs(1, 11, 9, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(orderQuery).WithArgs(107.0, store.OrderRefunded, 9, 107.0).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				// without the fake's authorization the provider refuses, so
+				// the pending refund is cancelled
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE refunds SET status=? WHERE id=? AND status=?").
+					WithArgs(store.RefundFailed, 5, store.RefundPending).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE order_items SET refunded_quantity=refunded_quantity-? WHERE id=? AND order_id=?").
+					WithArgs(1, 11, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(`
+			UPDATE orders SET refunded_price=refunded_price-?,
+				status=IF(refunded_price=0 AND NOT EXISTS (SELECT 1 FROM order_items WHERE order_id=? AND refunded_quantity>0), ?, ?),
+				updated_at=NOW()
+			WHERE id=?
+		`).WithArgs(107.0, 9, store.OrderPaid, store.OrderPartiallyRefunded, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				r := &store.Refund{CreatedBy: 1}
+				err := s.RefundOrder(ctx, 9, r)
+				require.ErrorIs(t, err, payment.ErrInvalidState)
+				require.Equal(t, store.RefundFailed, r.Status)
+			},
+		},
+		{
+			name: "more units than left",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				expectOrder(mock, store.OrderPartiallyRefunded, 107, 1)
+
+				r := &store.Refund{CreatedBy: 1, Items: []store.RefundItem{{OrderItemID: 11, Quantity: 2}}}
+				err := s.RefundOrder(ctx, 9, r)
+				require.ErrorIs(t, err, ErrInvalidRefund)
+			},
+		},
+		{
+			name: "amount over what was paid",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				expectOrder(mock, store.OrderPartiallyRefunded, 107, 1)
+
+				err := s.RefundOrder(ctx, 9, &store.Refund{CreatedBy: 1, Amount: 107.01})
+				require.ErrorIs(t, err, ErrInvalidRefund)
+			},
+		},
+		{
+			name: "not paid",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT * FROM orders WHERE id=? AND deleted_at IS NULL").WithArgs(9).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "status", "created_at"}).AddRow(9, store.OrderPending, time.Now()))
+				mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=?").WithArgs(9).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectQuery("SELECT * FROM order_addresses WHERE order_id=?").WithArgs(9).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+				err := s.RefundOrder(ctx, 9, &store.Refund{CreatedBy: 1})
+				require.ErrorIs(t, err, ErrOrderNotRefundable)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, tc.test)
+		})
+	}
+}
+
+func TestFillRefundItem(t *testing.T) {
+	tcs := []struct {
+		name string
+		item store.OrderItem
+		want float64
+	}{
+		{
+			name: "taxed",
+			item: store.OrderItem{ID: 11, ProductID: 4, Quantity: 2, Price: 107, NetAmount: 200, TaxAmount: 14},
+			want: 107,
+		},
+		{
+			// 10% off 200 before 7% tax
+			name: "coupon",
+			item: store.OrderItem{ID: 11, ProductID: 4, Quantity: 2, Price: 100, DiscountAmount: 20, NetAmount: 180, TaxAmount: 12.6},
+			want: 96.3,
+		},
+		{
+			name: "coupon before tax was tracked",
+			item: store.OrderItem{ID: 11, ProductID: 4, Quantity: 2, Price: 100, DiscountAmount: 20},
+			want: 90,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &store.Order{ID: 9, Items: []store.OrderItem{tc.item}}
+			ri := store.RefundItem{OrderItemID: 11, Quantity: 1}
+
+			err := fillRefundItem(o, &ri)
+			require.NoError(t, err)
+			require.Equal(t, int64(4), ri.ProductID)
+			require.Equal(t, tc.want, ri.Amount)
+		})
+	}
+}
@@ -2,16 +2,53 @@ package server
 
 import (
 	"context"
+	"time"
 
 	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/payment"
+	"github.com/codepnw/microservice-ecommerce/rbac"
+	"github.com/codepnw/microservice-ecommerce/shipping"
+	"github.com/codepnw/microservice-ecommerce/tax"
 )
 
 type Server struct {
-	store *store.MySQLStore
+	store    *store.MySQLStore
+	sessions *sessionCache
+	shipping shipping.Methods
+	taxes    *tax.Engine
+	payments payment.Providers
+
+	idempotencyKeyTTL time.Duration
+}
+
+// Config holds the server's dependencies besides the store.
+type Config struct {
+	// ShippingMethods are the shipping methods orders can be placed with.
+	ShippingMethods shipping.Methods
+	// Taxes works out the tax on each order line.
+	Taxes *tax.Engine
+	// PaymentProviders are the payment gateways orders can be paid through.
+	// The first is used when an order doesn't name one.
+	PaymentProviders payment.Providers
+	// IdempotencyKeyTTL is how long a response is kept for requests retried
+	// with the same Idempotency-Key. It defaults to a day.
+	IdempotencyKeyTTL time.Duration
 }
 
-func NewServer(store *store.MySQLStore) *Server {
-	return &Server{store: store}
+func NewServer(store *store.MySQLStore, cfg Config) *Server {
+	if cfg.IdempotencyKeyTTL <= 0 {
+		cfg.IdempotencyKeyTTL = defaultIdempotencyKeyTTL
+	}
+
+	return &Server{
+		store:    store,
+		sessions: newSessionCache(defaultSessionCacheTTL, defaultSessionCacheSize),
+		shipping: cfg.ShippingMethods,
+		taxes:    cfg.Taxes,
+		payments: cfg.PaymentProviders,
+
+		idempotencyKeyTTL: cfg.IdempotencyKeyTTL,
+	}
 }
 
 // ========= PRODUCT ==========
@@ -23,8 +60,8 @@ func (s *Server) GetProduct(ctx context.Context, id int64) (*store.Product, erro
 	return s.store.GetProduct(ctx, id)
 }
 
-func (s *Server) ListProducts(ctx context.Context) ([]store.Product, error) {
-	return s.store.ListProducts(ctx)
+func (s *Server) ListProducts(ctx context.Context, includeDeleted bool) ([]store.Product, error) {
+	return s.store.ListProducts(ctx, includeDeleted)
 }
 
 func (s *Server) UpdateProduct(ctx context.Context, p *store.Product) (*store.Product, error) {
@@ -35,23 +72,56 @@ func (s *Server) DeleteProduct(ctx context.Context, id int64) error {
 	return s.store.DeleteProduct(ctx, id)
 }
 
-// ========= ORDER ==========
-func (s *Server) CreateOrder(ctx context.Context, o *store.Order) (*store.Order, error) {
-	return s.store.CreateOrder(ctx, o)
+func (s *Server) RestoreProduct(ctx context.Context, id int64) error {
+	return s.store.RestoreProduct(ctx, id)
 }
 
+// ========= ORDER ==========
 func (s *Server) GetOrder(ctx context.Context, id int64) (*store.Order, error) {
 	return s.store.GetOrder(ctx, id)
 }
 
-func (s *Server) ListOrder(ctx context.Context) ([]store.Order, error) {
-	return s.store.ListOrders(ctx)
+func (s *Server) GetOrderByID(ctx context.Context, id int64) (*store.Order, error) {
+	return s.store.GetOrderByID(ctx, id)
+}
+
+func (s *Server) ListOrder(ctx context.Context, includeDeleted bool) ([]store.Order, error) {
+	return s.store.ListOrders(ctx, includeDeleted)
 }
 
 func (s *Server) DeleteOrder(ctx context.Context, id int64) error {
 	return s.store.DeleteOrder(ctx, id)
 }
 
+func (s *Server) RestoreOrder(ctx context.Context, id int64) error {
+	return s.store.RestoreOrder(ctx, id)
+}
+
+// ========= COUPON ==========
+func (s *Server) CreateCoupon(ctx context.Context, c *store.Coupon) (*store.Coupon, error) {
+	return s.store.CreateCoupon(ctx, c)
+}
+
+func (s *Server) GetCoupon(ctx context.Context, id int64) (*store.Coupon, error) {
+	return s.store.GetCoupon(ctx, id)
+}
+
+func (s *Server) GetCouponByCode(ctx context.Context, code string) (*store.Coupon, error) {
+	return s.store.GetCouponByCode(ctx, code)
+}
+
+func (s *Server) ListCoupons(ctx context.Context) ([]store.Coupon, error) {
+	return s.store.ListCoupons(ctx)
+}
+
+func (s *Server) UpdateCoupon(ctx context.Context, c *store.Coupon) (*store.Coupon, error) {
+	return s.store.UpdateCoupon(ctx, c)
+}
+
+func (s *Server) DeleteCoupon(ctx context.Context, id int64) error {
+	return s.store.DeleteCoupon(ctx, id)
+}
+
 // ========= USER ==========
 func (s *Server) CreateUser(ctx context.Context, u *store.User) (*store.User, error) {
 	return s.store.CreateUser(ctx, u)
@@ -61,16 +131,191 @@ func (s *Server) GetUser(ctx context.Context, email string) (*store.User, error)
 	return s.store.GetUser(ctx, email)
 }
 
-func (s *Server) ListUsers(ctx context.Context) ([]store.User, error) {
-	return s.store.ListUsers(ctx)
+func (s *Server) GetUserByID(ctx context.Context, id int64) (*store.User, error) {
+	return s.store.GetUserByID(ctx, id)
 }
 
-func (s *Server) UpdateUser(ctx context.Context, u *store.User) (*store.User, error) {
-	return s.store.UpdateUser(ctx, u)
+func (s *Server) ListUsers(ctx context.Context, params store.ListUsersParams) ([]store.User, int64, error) {
+	return s.store.ListUsers(ctx, params)
 }
 
-func (s *Server) DeleteUser(ctx context.Context, id int64) error {
-	return s.store.DeleteUser(ctx, id)
+// UpdateUser saves u. If its email changed from oldEmail, the new address
+// has to be verified again and the user is logged out everywhere.
+func (s *Server) UpdateUser(ctx context.Context, u *store.User, oldEmail string) (*store.User, error) {
+	if u.Email == oldEmail {
+		return s.store.UpdateUser(ctx, u)
+	}
+
+	updated, err := s.store.ChangeUserEmail(ctx, u, oldEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sessions.invalidateEmail(oldEmail)
+	return updated, nil
+}
+
+// ChangePassword sets a new password and logs the user out of every session
+// but the one making the change.
+func (s *Server) ChangePassword(ctx context.Context, u *store.User, passwordHash, currentSessionID string) error {
+	if err := s.store.UpdateUserPassword(ctx, u.ID, passwordHash); err != nil {
+		return err
+	}
+
+	if err := s.store.RevokeOtherSessions(ctx, u.Email, currentSessionID); err != nil {
+		return err
+	}
+
+	s.sessions.invalidateEmail(u.Email)
+	return nil
+}
+
+// RehashPassword replaces the stored hash of an unchanged password, so
+// unlike ChangePassword it leaves sessions alone.
+func (s *Server) RehashPassword(ctx context.Context, userID int64, passwordHash string) error {
+	return s.store.UpdateUserPassword(ctx, userID, passwordHash)
+}
+
+// DeleteUser soft deletes the user and logs them out everywhere.
+func (s *Server) DeleteUser(ctx context.Context, u *store.User) error {
+	if err := s.store.DeleteUser(ctx, u.ID); err != nil {
+		return err
+	}
+
+	return s.RevokeUserSessions(ctx, u.Email)
+}
+
+func (s *Server) RestoreUser(ctx context.Context, id int64) error {
+	return s.store.RestoreUser(ctx, id)
+}
+
+// ========= ADDRESS ==========
+func (s *Server) ListAddresses(ctx context.Context, userID int64) ([]store.Address, error) {
+	return s.store.ListAddresses(ctx, userID)
+}
+
+func (s *Server) GetAddress(ctx context.Context, userID, id int64) (*store.Address, error) {
+	return s.store.GetAddress(ctx, userID, id)
+}
+
+func (s *Server) GetDefaultAddress(ctx context.Context, userID int64) (*store.Address, error) {
+	return s.store.GetDefaultAddress(ctx, userID)
+}
+
+func (s *Server) CreateAddress(ctx context.Context, a *store.Address) (*store.Address, error) {
+	return s.store.CreateAddress(ctx, a)
+}
+
+func (s *Server) UpdateAddress(ctx context.Context, a *store.Address) (*store.Address, error) {
+	return s.store.UpdateAddress(ctx, a)
+}
+
+func (s *Server) DeleteAddress(ctx context.Context, userID, id int64) error {
+	return s.store.DeleteAddress(ctx, userID, id)
+}
+
+// ========= EMAIL VERIFICATION ==========
+func (s *Server) CreateEmailVerification(ctx context.Context, v *store.EmailVerification) error {
+	return s.store.CreateEmailVerification(ctx, v)
+}
+
+func (s *Server) GetLatestEmailVerification(ctx context.Context, userID int64) (*store.EmailVerification, error) {
+	return s.store.GetLatestEmailVerification(ctx, userID)
+}
+
+func (s *Server) ConsumeEmailVerification(ctx context.Context, tokenHash string) (int64, error) {
+	return s.store.ConsumeEmailVerification(ctx, tokenHash)
+}
+
+// ========= PASSWORD RESET ==========
+func (s *Server) CreatePasswordReset(ctx context.Context, r *store.PasswordReset) error {
+	return s.store.CreatePasswordReset(ctx, r)
+}
+
+func (s *Server) GetLatestPasswordReset(ctx context.Context, userID int64) (*store.PasswordReset, error) {
+	return s.store.GetLatestPasswordReset(ctx, userID)
+}
+
+// ResetPassword sets a new password using a reset token and logs the user
+// out everywhere.
+func (s *Server) ResetPassword(ctx context.Context, tokenHash, passwordHash string) error {
+	userID, err := s.store.ConsumePasswordReset(ctx, tokenHash, passwordHash)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.RevokeUserSessions(ctx, user.Email)
+}
+
+// ========= MFA ==========
+func (s *Server) GetUserMFA(ctx context.Context, userID int64) (*store.UserMFA, error) {
+	return s.store.GetUserMFA(ctx, userID)
+}
+
+func (s *Server) SetPendingMFA(ctx context.Context, userID int64, secret string) error {
+	return s.store.SetPendingMFA(ctx, userID, secret)
+}
+
+func (s *Server) ConfirmMFA(ctx context.Context, userID, step int64, recoveryCodeHashes []string) error {
+	return s.store.ConfirmMFA(ctx, userID, step, recoveryCodeHashes)
+}
+
+func (s *Server) UseTOTPStep(ctx context.Context, userID, step int64) (bool, error) {
+	return s.store.UseTOTPStep(ctx, userID, step)
+}
+
+func (s *Server) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	return s.store.UseRecoveryCode(ctx, userID, codeHash)
+}
+
+func (s *Server) RecordMFAFailure(ctx context.Context, userID int64) error {
+	return s.store.RecordMFAFailure(ctx, userID)
+}
+
+func (s *Server) DeleteMFA(ctx context.Context, userID int64) error {
+	return s.store.DeleteMFA(ctx, userID)
+}
+
+// ========= ROLE ==========
+func (s *Server) GetUserRoles(ctx context.Context, userID int64) ([]string, error) {
+	return s.store.GetUserRoles(ctx, userID)
+}
+
+func (s *Server) GetUserPermissions(ctx context.Context, userID int64) ([]rbac.Permission, error) {
+	names, err := s.store.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	perms := make([]rbac.Permission, len(names))
+	for i, n := range names {
+		perms[i] = rbac.Permission(n)
+	}
+	return perms, nil
+}
+
+// SetUserRoles replaces the user's roles on behalf of actorID. When a role is
+// taken away the user's sessions are revoked so tokens carrying the old
+// permissions stop working right away.
+func (s *Server) SetUserRoles(ctx context.Context, user *store.User, roles []string, actorID int64) error {
+	revoked, err := s.store.SetUserRoles(ctx, user.ID, roles, actorID)
+	if err != nil {
+		return err
+	}
+
+	if revoked {
+		return s.RevokeUserSessions(ctx, user.Email)
+	}
+	return nil
+}
+
+func (s *Server) ListPrivilegeAudit(ctx context.Context, userID int64) ([]store.PrivilegeAudit, error) {
+	return s.store.ListPrivilegeAudit(ctx, userID)
 }
 
 // ========= SESSION ==========
@@ -82,10 +327,34 @@ func (s *Server) GetSession(ctx context.Context, id string) (*store.Session, err
 	return s.store.GetSession(ctx, id)
 }
 
+func (s *Server) ListSessions(ctx context.Context, email string) ([]store.Session, error) {
+	return s.store.ListSessions(ctx, email)
+}
+
 func (s *Server) RevokeSession(ctx context.Context, id string) error {
-	return s.store.RevokeSession(ctx, id)
+	if err := s.store.RevokeSession(ctx, id); err != nil {
+		return err
+	}
+
+	s.sessions.invalidate(id)
+	return nil
 }
 
 func (s *Server) DeleteSession(ctx context.Context, id string) error {
-	return s.store.DeleteSession(ctx, id)
+	if err := s.store.DeleteSession(ctx, id); err != nil {
+		return err
+	}
+
+	s.sessions.invalidate(id)
+	return nil
+}
+
+// RevokeUserSessions logs the user out everywhere.
+func (s *Server) RevokeUserSessions(ctx context.Context, email string) error {
+	if err := s.store.RevokeUserSessions(ctx, email); err != nil {
+		return err
+	}
+
+	s.sessions.invalidateEmail(email)
+	return nil
 }
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/utils"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionRevoked  = errors.New("session revoked")
+	ErrSessionExpired  = errors.New("session expired")
+	ErrSessionInvalid  = errors.New("invalid session")
+)
+
+// ValidateSession reports whether the session a token is bound to still
+// exists, belongs to email and has been neither revoked nor expired.
+func (s *Server) ValidateSession(ctx context.Context, id, email string) error {
+	if id == "" {
+		return ErrSessionInvalid
+	}
+
+	if cached, ok := s.sessions.get(id); ok {
+		if cached != email {
+			return ErrSessionInvalid
+		}
+		return nil
+	}
+
+	sess, err := s.liveSession(ctx, id, email)
+	if err != nil {
+		return err
+	}
+
+	s.sessions.set(sess.ID, sess.UserEmail, sess.ExpiresAt)
+
+	return nil
+}
+
+// ValidateRefreshSession is ValidateSession for a refresh token. The
+// session is always read, so the token can be checked against its hash.
+func (s *Server) ValidateRefreshSession(ctx context.Context, id, email, refreshToken string) (*store.Session, error) {
+	if id == "" {
+		return nil, ErrSessionInvalid
+	}
+
+	sess, err := s.liveSession(ctx, id, email)
+	if err != nil {
+		return nil, err
+	}
+	if sess.RefreshTokenHash != utils.HashOpaqueToken(refreshToken) {
+		return nil, ErrSessionInvalid
+	}
+
+	return sess, nil
+}
+
+// liveSession reads session id and checks it belongs to email and has been
+// neither revoked nor expired.
+func (s *Server) liveSession(ctx context.Context, id, email string) (*store.Session, error) {
+	sess, err := s.store.GetSession(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	switch {
+	case sess.IsRevoked:
+		return nil, ErrSessionRevoked
+	case time.Now().After(sess.ExpiresAt):
+		return nil, ErrSessionExpired
+	case sess.UserEmail != email:
+		return nil, ErrSessionInvalid
+	}
+
+	return sess, nil
+}
+
+// IsSessionError reports whether err means a token's session can't be
+// used, as opposed to the session failing to load.
+func IsSessionError(err error) bool {
+	return errors.Is(err, ErrSessionNotFound) ||
+		errors.Is(err, ErrSessionRevoked) ||
+		errors.Is(err, ErrSessionExpired) ||
+		errors.Is(err, ErrSessionInvalid)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultSessionCacheTTL  = 30 * time.Second
+	defaultSessionCacheSize = 10000
+)
+
+// sessionCache remembers sessions that were recently found to be valid so
+// authenticated requests don't hit the sessions table every time. Revoking
+// or deleting a session through the Server evicts it immediately; changes
+// made by other replicas are picked up once the entry expires.
+type sessionCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]sessionCacheEntry
+}
+
+type sessionCacheEntry struct {
+	email     string
+	expiresAt time.Time
+}
+
+func newSessionCache(ttl time.Duration, size int) *sessionCache {
+	return &sessionCache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]sessionCacheEntry),
+	}
+}
+
+func (c *sessionCache) get(id string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(e.expiresAt) {
+		delete(c.entries, id)
+		return "", false
+	}
+
+	return e.email, true
+}
+
+// set caches a valid session until the cache TTL or the session's own
+// expiry, whichever comes first.
+func (c *sessionCache) set(id, email string, sessionExpiresAt time.Time) {
+	now := time.Now()
+	expiresAt := now.Add(c.ttl)
+	if sessionExpiresAt.Before(expiresAt) {
+		expiresAt = sessionExpiresAt
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= c.size {
+		c.evictExpired(now)
+	}
+	if len(c.entries) >= c.size {
+		// still full, start over rather than track recency
+		c.entries = make(map[string]sessionCacheEntry)
+	}
+
+	c.entries[id] = sessionCacheEntry{email: email, expiresAt: expiresAt}
+}
+
+func (c *sessionCache) invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, id)
+}
+
+func (c *sessionCache) invalidateEmail(email string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, e := range c.entries {
+		if e.email == email {
+			delete(c.entries, id)
+		}
+	}
+}
+
+func (c *sessionCache) evictExpired(now time.Time) {
+	for id, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, id)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionCache(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *sessionCache)
+	}{
+		{
+			name: "hit",
+			test: func(t *testing.T, c *sessionCache) {
+				c.set("s1", "test@example.com", time.Now().Add(time.Hour))
+
+				email, ok := c.get("s1")
+				require.True(t, ok)
+				require.Equal(t, "test@example.com", email)
+			},
+		},
+		{
+			name: "invalidated",
+			test: func(t *testing.T, c *sessionCache) {
+				c.set("s1", "test@example.com", time.Now().Add(time.Hour))
+				c.invalidate("s1")
+
+				_, ok := c.get("s1")
+				require.False(t, ok)
+			},
+		},
+		{
+			name: "session expires before ttl",
+			test: func(t *testing.T, c *sessionCache) {
+				c.set("s1", "test@example.com", time.Now().Add(-time.Second))
+
+				_, ok := c.get("s1")
+				require.False(t, ok)
+			},
+		},
+		{
+			name: "bounded size",
+			test: func(t *testing.T, c *sessionCache) {
+				c.set("s1", "a@example.com", time.Now().Add(time.Hour))
+				c.set("s2", "b@example.com", time.Now().Add(time.Hour))
+				c.set("s3", "c@example.com", time.Now().Add(time.Hour))
+
+				require.LessOrEqual(t, len(c.entries), 2)
+				_, ok := c.get("s3")
+				require.True(t, ok)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newSessionCache(time.Minute, 2))
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/codepnw/microservice-ecommerce/utils"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateRefreshSession(t *testing.T) {
+	ctx := context.Background()
+	query := "SELECT * FROM sessions WHERE id=?"
+	columns := []string{"id", "user_email", "refresh_token", "is_revoked", "expires_at"}
+	hash := utils.HashOpaqueToken("refresh-token")
+
+	tcs := []struct {
+		name string
+		rows func() *sqlmock.Rows
+		err  error
+	}{
+		{
+			name: "valid",
+			rows: func() *sqlmock.Rows {
+				return sqlmock.NewRows(columns).AddRow("s1", "test@example.com", hash, false, time.Now().Add(time.Hour))
+			},
+		},
+		{
+			name: "logged out",
+			err:  ErrSessionNotFound,
+		},
+		{
+			name: "revoked",
+			rows: func() *sqlmock.Rows {
+				return sqlmock.NewRows(columns).AddRow("s1", "test@example.com", hash, true, time.Now().Add(time.Hour))
+			},
+			err: ErrSessionRevoked,
+		},
+		{
+			name: "expired",
+			rows: func() *sqlmock.Rows {
+				return sqlmock.NewRows(columns).AddRow("s1", "test@example.com", hash, false, time.Now().Add(-time.Minute))
+			},
+			err: ErrSessionExpired,
+		},
+		{
+			name: "other refresh token",
+			rows: func() *sqlmock.Rows {
+				return sqlmock.NewRows(columns).AddRow("s1", "test@example.com", utils.HashOpaqueToken("old-token"), false, time.Now().Add(time.Hour))
+			},
+			err: ErrSessionInvalid,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				if tc.rows == nil {
+					mock.ExpectQuery(query).WithArgs("s1").WillReturnError(sql.ErrNoRows)
+				} else {
+					mock.ExpectQuery(query).WithArgs("s1").WillReturnRows(tc.rows())
+				}
+
+				sess, err := s.ValidateRefreshSession(ctx, "s1", "test@example.com", "refresh-token")
+				if tc.err != nil {
+					require.ErrorIs(t, err, tc.err)
+					require.True(t, IsSessionError(err))
+					return
+				}
+				require.NoError(t, err)
+				require.Equal(t, "s1", sess.ID)
+			})
+		})
+	}
+}
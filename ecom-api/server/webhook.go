@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/payment"
+)
+
+var (
+	// ErrUnknownPayment is returned for an event about a payment that isn't
+	// recorded, e.g. because the webhook beat the checkout to it. Such
+	// events can be replayed later.
+	ErrUnknownPayment = errors.New("unknown payment")
+	// ErrEventProcessed is returned when replaying an event that was
+	// already applied, or is being applied by another request.
+	ErrEventProcessed = errors.New("webhook event was already processed")
+)
+
+const maxWebhookErrorLength = 255
+
+// WebhookVerifier returns the named provider's webhook verifier.
+func (s *Server) WebhookVerifier(name string) (payment.WebhookVerifier, error) {
+	if name == "" {
+		return nil, payment.ErrUnknownProvider
+	}
+
+	provider, err := s.payments.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := provider.(payment.WebhookVerifier)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s doesn't send webhooks", payment.ErrUnknownProvider, name)
+	}
+
+	return v, nil
+}
+
+// HandlePaymentEvent records an event a provider sent and applies it to
+// the payment and order it is about. Repeated deliveries of an event that
+// was applied, or is being applied by another request, are ignored.
+func (s *Server) HandlePaymentEvent(ctx context.Context, provider string, ev payment.Event, payload []byte) error {
+	e, err := s.store.CreateWebhookEvent(ctx, &store.WebhookEvent{
+		Provider:  provider,
+		EventID:   ev.ID,
+		Type:      ev.Type,
+		Reference: ev.Reference,
+		Amount:    ev.Amount,
+		Payload:   string(payload),
+		Status:    store.WebhookReceived,
+	})
+	if err != nil {
+		return err
+	}
+	if e.Status == store.WebhookProcessed {
+		return nil
+	}
+
+	err = s.processWebhookEvent(ctx, e)
+	if errors.Is(err, ErrEventProcessed) {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) GetWebhookEvent(ctx context.Context, id int64) (*store.WebhookEvent, error) {
+	return s.store.GetWebhookEvent(ctx, id)
+}
+
+func (s *Server) ListWebhookEvents(ctx context.Context, status string, limit, offset int) ([]store.WebhookEvent, error) {
+	return s.store.ListWebhookEvents(ctx, status, limit, offset)
+}
+
+// ReplayWebhookEvent applies a recorded event that failed before.
+func (s *Server) ReplayWebhookEvent(ctx context.Context, id int64) (*store.WebhookEvent, error) {
+	e, err := s.store.GetWebhookEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if e.Status == store.WebhookProcessed {
+		return e, ErrEventProcessed
+	}
+
+	return e, s.processWebhookEvent(ctx, e)
+}
+
+// processWebhookEvent claims e, applies it and records the outcome. It
+// returns ErrEventProcessed if another request claimed e first.
+func (s *Server) processWebhookEvent(ctx context.Context, e *store.WebhookEvent) error {
+	if err := s.store.ClaimWebhookEvent(ctx, e); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			return ErrEventProcessed
+		}
+		return err
+	}
+
+	err := s.applyPaymentEvent(ctx, e)
+
+	e.Attempts++
+	if err != nil {
+		e.Status = store.WebhookFailed
+		e.Error = err.Error()
+		if len(e.Error) > maxWebhookErrorLength {
+			e.Error = e.Error[:maxWebhookErrorLength]
+		}
+	} else {
+		e.Status = store.WebhookProcessed
+		e.Error = ""
+		now := time.Now()
+		e.ProcessedAt = &now
+	}
+
+	if uErr := s.store.UpdateWebhookEvent(ctx, e); uErr != nil {
+		if err != nil {
+			return fmt.Errorf("%w (and %v)", err, uErr)
+		}
+		return uErr
+	}
+
+	return err
+}
+
+func (s *Server) applyPaymentEvent(ctx context.Context, e *store.WebhookEvent) error {
+	switch e.Type {
+	case payment.EventCaptured, payment.EventFailed, payment.EventVoided:
+	default:
+		// nothing to do for events we don't track
+		return nil
+	}
+
+	p, err := s.store.GetPaymentByReference(ctx, e.Provider, e.Reference)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %s %s", ErrUnknownPayment, e.Provider, e.Reference)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch e.Type {
+	case payment.EventCaptured:
+		if p.Status == store.PaymentCaptured {
+			return nil
+		}
+
+		provider, err := s.payments.Get(e.Provider)
+		if err != nil {
+			return err
+		}
+		err = s.capturePayment(ctx, provider, p)
+		// the order was paid by another payment and this one was refunded
+		if errors.Is(err, ErrOrderNotPayable) {
+			return nil
+		}
+		return err
+	case payment.EventFailed:
+		if p.Status != store.PaymentPending && p.Status != store.PaymentAuthorized {
+			return nil
+		}
+		p.Status = store.PaymentFailed
+		p.Error = "reported failed by " + e.Provider
+		return s.store.UpdatePayment(ctx, p)
+	default:
+		if p.Status != store.PaymentAuthorized {
+			return nil
+		}
+		p.Status = store.PaymentVoided
+		return s.store.UpdatePayment(ctx, p)
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+	"github.com/codepnw/microservice-ecommerce/payment"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlePaymentEvent(t *testing.T) {
+	insertQuery := `
+		INSERT INTO webhook_events (provider, event_id, type, reference, amount, payload, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE id=id
+	`
+	eventColumns := []string{"id", "provider", "event_id", "type", "reference", "amount", "payload", "status", "error", "attempts", "created_at", "processed_at"}
+	paymentColumns := []string{"id", "order_id", "provider", "reference", "status", "amount", "error", "created_at", "updated_at"}
+	updateQuery := "UPDATE webhook_events SET status=?, error=?, attempts=?, processed_at=? WHERE id=?"
+	claimQuery := "UPDATE webhook_events SET status=? WHERE id=? AND status IN (?, ?)"
+	captureQuery := "UPDATE orders SET status=?, paid_at=NOW(), updated_at=NOW() WHERE id=? AND status=?"
+	ev := payment.Event{ID: "evt_1", Type: payment.EventCaptured, Reference: "fake_auth_1", Amount: 100}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *Server, sqlmock.Sqlmock)
+	}{
+		{
+			name: "captured",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertQuery).WillReturnResult(sqlmock.NewResult(4, 1))
+				mock.ExpectExec(claimQuery).WithArgs(store.WebhookProcessing, 4, store.WebhookReceived, store.WebhookFailed).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT * FROM payments WHERE provider=? AND reference=?").WithArgs("fake", "fake_auth_1").
+					WillReturnRows(sqlmock.NewRows(paymentColumns).AddRow(2, 9, "fake", "fake_auth_1", store.PaymentAuthorized, 100, "", time.Now(), nil))
+				mock.ExpectBegin()
+				mock.ExpectExec(captureQuery).WithArgs(store.OrderPaid, 9, store.OrderPending).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE payments SET status=?, updated_at=NOW() WHERE id=?").WithArgs(store.PaymentCaptured, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+				mock.ExpectExec(updateQuery).WithArgs(store.WebhookProcessed, "", 1, sqlmock.AnyArg(), 4).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				err := s.HandlePaymentEvent(context.Background(), "fake", ev, []byte("{}"))
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "captured by the checkout meanwhile",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertQuery).WillReturnResult(sqlmock.NewResult(4, 1))
+				mock.ExpectExec(claimQuery).WithArgs(store.WebhookProcessing, 4, store.WebhookReceived, store.WebhookFailed).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT * FROM payments WHERE provider=? AND reference=?").WithArgs("fake", "fake_auth_1").
+					WillReturnRows(sqlmock.NewRows(paymentColumns).AddRow(2, 9, "fake", "fake_auth_1", store.PaymentAuthorized, 100, "", time.Now(), nil))
+				mock.ExpectBegin()
+				mock.ExpectExec(captureQuery).WithArgs(store.OrderPaid, 9, store.OrderPending).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+				// the payment is captured already, so it is neither refunded
+				// nor marked failed
+				mock.ExpectQuery("SELECT * FROM payments WHERE order_id=? ORDER BY id").WithArgs(9).
+					WillReturnRows(sqlmock.NewRows(paymentColumns).AddRow(2, 9, "fake", "fake_auth_1", store.PaymentCaptured, 100, "", time.Now(), nil))
+				mock.ExpectExec(updateQuery).WithArgs(store.WebhookProcessed, "", 1, sqlmock.AnyArg(), 4).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				err := s.HandlePaymentEvent(context.Background(), "fake", ev, []byte("{}"))
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "delivery being processed",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT * FROM webhook_events WHERE provider=? AND event_id=?").WithArgs("fake", "evt_1").
+					WillReturnRows(sqlmock.NewRows(eventColumns).AddRow(4, "fake", "evt_1", payment.EventCaptured, "fake_auth_1", 100, "{}", store.WebhookReceived, "", 0, time.Now(), nil))
+				mock.ExpectExec(claimQuery).WithArgs(store.WebhookProcessing, 4, store.WebhookReceived, store.WebhookFailed).WillReturnResult(sqlmock.NewResult(0, 0))
+
+				err := s.HandlePaymentEvent(context.Background(), "fake", ev, []byte("{}"))
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "repeated delivery",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertQuery).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT * FROM webhook_events WHERE provider=? AND event_id=?").WithArgs("fake", "evt_1").
+					WillReturnRows(sqlmock.NewRows(eventColumns).AddRow(4, "fake", "evt_1", payment.EventCaptured, "fake_auth_1", 100, "{}", store.WebhookProcessed, "", 1, time.Now(), time.Now()))
+
+				err := s.HandlePaymentEvent(context.Background(), "fake", ev, []byte("{}"))
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unknown payment",
+			test: func(t *testing.T, s *Server, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertQuery).WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectExec(claimQuery).WithArgs(store.WebhookProcessing, 5, store.WebhookReceived, store.WebhookFailed).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT * FROM payments WHERE provider=? AND reference=?").WithArgs("fake", "fake_auth_1").WillReturnError(sql.ErrNoRows)
+				mock.ExpectExec(updateQuery).WithArgs(store.WebhookFailed, "unknown payment: fake fake_auth_1", 1, nil, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				err := s.HandlePaymentEvent(context.Background(), "fake", ev, []byte("{}"))
+				require.ErrorIs(t, err, ErrUnknownPayment)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, tc.test)
+		})
+	}
+}
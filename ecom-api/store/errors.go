@@ -0,0 +1,17 @@
+package store
+
+import "errors"
+
+var (
+	ErrUnknownRole  = errors.New("unknown role")
+	ErrInvalidToken = errors.New("invalid or already used token")
+	ErrTokenExpired = errors.New("token expired")
+	// ErrConflict means the row changed since it was read.
+	ErrConflict = errors.New("resource was modified by another request")
+	// ErrCouponUsedUp means the coupon reached its usage limit, overall or
+	// for the user.
+	ErrCouponUsedUp = errors.New("coupon usage limit reached")
+	// ErrOutOfStock means a product doesn't have enough units in stock for
+	// the order.
+	ErrOutOfStock = errors.New("product out of stock")
+)
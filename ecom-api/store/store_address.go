@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ListAddresses returns the user's address book, default address first.
+func (s *MySQLStore) ListAddresses(ctx context.Context, userID int64) ([]Address, error) {
+	addresses := []Address{}
+	query := "SELECT * FROM addresses WHERE user_id=? ORDER BY is_default DESC, id"
+	if err := s.db.SelectContext(ctx, &addresses, query, userID); err != nil {
+		return nil, fmt.Errorf("error listing addresses: %w", err)
+	}
+
+	return addresses, nil
+}
+
+// GetAddress returns one of the user's addresses. Addresses of other users
+// are not found.
+func (s *MySQLStore) GetAddress(ctx context.Context, userID, id int64) (*Address, error) {
+	var a Address
+	if err := s.db.GetContext(ctx, &a, "SELECT * FROM addresses WHERE id=? AND user_id=?", id, userID); err != nil {
+		return nil, fmt.Errorf("error getting address: %w", err)
+	}
+
+	return &a, nil
+}
+
+func (s *MySQLStore) GetDefaultAddress(ctx context.Context, userID int64) (*Address, error) {
+	var a Address
+	if err := s.db.GetContext(ctx, &a, "SELECT * FROM addresses WHERE user_id=? AND is_default=1", userID); err != nil {
+		return nil, fmt.Errorf("error getting default address: %w", err)
+	}
+
+	return &a, nil
+}
+
+// CreateAddress adds a to the user's address book. The user's first address
+// becomes their default.
+func (s *MySQLStore) CreateAddress(ctx context.Context, a *Address) (*Address, error) {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		var count int64
+		if err := tx.GetContext(ctx, &count, "SELECT COUNT(*) FROM addresses WHERE user_id=? FOR UPDATE", a.UserID); err != nil {
+			return fmt.Errorf("error counting addresses: %w", err)
+		}
+		if count == 0 {
+			a.IsDefault = true
+		}
+
+		if a.IsDefault {
+			if err := clearDefaultAddress(ctx, tx, a.UserID); err != nil {
+				return err
+			}
+		}
+
+		query := `
+			INSERT INTO addresses (user_id, name, line1, line2, city, state, postal_code, country, phone, is_default)
+			VALUES (:user_id, :name, :line1, :line2, :city, :state, :postal_code, :country, :phone, :is_default)
+		`
+		res, err := tx.NamedExecContext(ctx, query, a)
+		if err != nil {
+			return fmt.Errorf("error inserting address: %w", err)
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("error getting last insert ID: %w", err)
+		}
+		a.ID = id
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating address: %w", err)
+	}
+
+	return a, nil
+}
+
+// UpdateAddress saves a. Making it the default takes the flag away from the
+// user's other addresses.
+func (s *MySQLStore) UpdateAddress(ctx context.Context, a *Address) (*Address, error) {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		if a.IsDefault {
+			if err := clearDefaultAddress(ctx, tx, a.UserID); err != nil {
+				return err
+			}
+		}
+
+		query := `
+			UPDATE addresses SET name=:name, line1=:line1, line2=:line2, city=:city, state=:state,
+				postal_code=:postal_code, country=:country, phone=:phone, is_default=:is_default, updated_at=:updated_at
+			WHERE id=:id AND user_id=:user_id
+		`
+		res, err := tx.NamedExecContext(ctx, query, a)
+		if err != nil {
+			return fmt.Errorf("error updating address: %w", err)
+		}
+
+		return checkRowAffected(res)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error updating address: %w", err)
+	}
+
+	return a, nil
+}
+
+func (s *MySQLStore) DeleteAddress(ctx context.Context, userID, id int64) error {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM addresses WHERE id=? AND user_id=?", id, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting address: %w", err)
+	}
+
+	if err := checkRowAffected(res); err != nil {
+		return fmt.Errorf("error deleting address: %w", err)
+	}
+
+	return nil
+}
+
+func clearDefaultAddress(ctx context.Context, tx *sqlx.Tx, userID int64) error {
+	if _, err := tx.ExecContext(ctx, "UPDATE addresses SET is_default=0 WHERE user_id=? AND is_default=1", userID); err != nil {
+		return fmt.Errorf("error clearing default address: %w", err)
+	}
+
+	return nil
+}
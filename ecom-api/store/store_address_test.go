@@ -0,0 +1,135 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAddress(t *testing.T) {
+	countQuery := "SELECT COUNT(*) FROM addresses WHERE user_id=? FOR UPDATE"
+	clearQuery := "UPDATE addresses SET is_default=0 WHERE user_id=? AND is_default=1"
+	insertQuery := `
+			INSERT INTO addresses (user_id, name, line1, line2, city, state, postal_code, country, phone, is_default)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+	newAddress := func(isDefault bool) *Address {
+		return &Address{
+			UserID:        3,
+			PostalAddress: PostalAddress{Name: "John Doe", Line1: "1 Main St", City: "Bangkok", Country: "TH"},
+			IsDefault:     isDefault,
+		}
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "first address becomes default",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(countQuery).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec(clearQuery).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(insertQuery).WithArgs(3, "John Doe", "1 Main St", "", "Bangkok", "", "", "TH", "", true).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				a, err := st.CreateAddress(context.Background(), newAddress(false))
+				require.NoError(t, err)
+				require.Equal(t, int64(1), a.ID)
+				require.True(t, a.IsDefault)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "additional address",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(countQuery).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectExec(insertQuery).WithArgs(3, "John Doe", "1 Main St", "", "Bangkok", "", "", "TH", "", false).WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+
+				a, err := st.CreateAddress(context.Background(), newAddress(false))
+				require.NoError(t, err)
+				require.False(t, a.IsDefault)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "new default",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(countQuery).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				mock.ExpectExec(clearQuery).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(insertQuery).WithArgs(3, "John Doe", "1 Main St", "", "Bangkok", "", "", "TH", "", true).WillReturnResult(sqlmock.NewResult(3, 1))
+				mock.ExpectCommit()
+
+				_, err := st.CreateAddress(context.Background(), newAddress(true))
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestDeleteAddress(t *testing.T) {
+	query := "DELETE FROM addresses WHERE id=? AND user_id=?"
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs(5, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				err := st.DeleteAddress(context.Background(), 3, 5)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "another user's address",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs(5, 4).WillReturnResult(sqlmock.NewResult(0, 0))
+
+				err := st.DeleteAddress(context.Background(), 4, 5)
+				require.ErrorIs(t, err, sql.ErrNoRows)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
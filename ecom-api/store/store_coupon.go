@@ -0,0 +1,212 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func (s *MySQLStore) CreateCoupon(ctx context.Context, c *Coupon) (*Coupon, error) {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		query := `
+			INSERT INTO coupons (code, type, value, min_order_value, max_uses, max_uses_per_user, starts_at, ends_at)
+			VALUES (:code, :type, :value, :min_order_value, :max_uses, :max_uses_per_user, :starts_at, :ends_at)
+		`
+		res, err := tx.NamedExecContext(ctx, query, c)
+		if err != nil {
+			return fmt.Errorf("error inserting coupon: %w", err)
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("error getting last insert id: %w", err)
+		}
+		c.ID = id
+
+		return insertCouponScope(ctx, tx, c)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating coupon: %w", err)
+	}
+
+	return c, nil
+}
+
+func (s *MySQLStore) GetCoupon(ctx context.Context, id int64) (*Coupon, error) {
+	var c Coupon
+	if err := s.db.GetContext(ctx, &c, "SELECT * FROM coupons WHERE id=?", id); err != nil {
+		return nil, fmt.Errorf("error getting coupon: %w", err)
+	}
+
+	if err := s.getCouponScope(ctx, &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (s *MySQLStore) GetCouponByCode(ctx context.Context, code string) (*Coupon, error) {
+	var c Coupon
+	if err := s.db.GetContext(ctx, &c, "SELECT * FROM coupons WHERE code=?", code); err != nil {
+		return nil, fmt.Errorf("error getting coupon: %w", err)
+	}
+
+	if err := s.getCouponScope(ctx, &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (s *MySQLStore) ListCoupons(ctx context.Context) ([]Coupon, error) {
+	var coupons []Coupon
+	if err := s.db.SelectContext(ctx, &coupons, "SELECT * FROM coupons ORDER BY id"); err != nil {
+		return nil, fmt.Errorf("error listing coupons: %w", err)
+	}
+
+	for i := range coupons {
+		if err := s.getCouponScope(ctx, &coupons[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return coupons, nil
+}
+
+// UpdateCoupon saves c and replaces its products and categories. The usage
+// count is left alone.
+func (s *MySQLStore) UpdateCoupon(ctx context.Context, c *Coupon) (*Coupon, error) {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		query := `
+			UPDATE coupons
+			SET code=:code, type=:type, value=:value, min_order_value=:min_order_value, max_uses=:max_uses,
+				max_uses_per_user=:max_uses_per_user, starts_at=:starts_at, ends_at=:ends_at, updated_at=:updated_at
+			WHERE id=:id
+		`
+		res, err := tx.NamedExecContext(ctx, query, c)
+		if err != nil {
+			return fmt.Errorf("error updating coupon: %w", err)
+		}
+		if err := checkRowAffected(res); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM coupon_products WHERE coupon_id=?", c.ID); err != nil {
+			return fmt.Errorf("error deleting coupon products: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM coupon_categories WHERE coupon_id=?", c.ID); err != nil {
+			return fmt.Errorf("error deleting coupon categories: %w", err)
+		}
+
+		return insertCouponScope(ctx, tx, c)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error updating coupon: %w", err)
+	}
+
+	return c, nil
+}
+
+// DeleteCoupon removes a coupon that was never redeemed. A redeemed one is
+// expired instead, so its redemptions are kept for accounting; its code
+// stays taken.
+func (s *MySQLStore) DeleteCoupon(ctx context.Context, id int64) error {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		// locking the coupon keeps it from being redeemed in the meantime
+		var redeemed bool
+		query := "SELECT EXISTS (SELECT 1 FROM coupon_redemptions cr WHERE cr.coupon_id = c.id) FROM coupons c WHERE c.id=? FOR UPDATE"
+		if err := tx.GetContext(ctx, &redeemed, query, id); err != nil {
+			return fmt.Errorf("error getting coupon: %w", err)
+		}
+
+		if !redeemed {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM coupons WHERE id=?", id); err != nil {
+				return fmt.Errorf("error deleting coupon: %w", err)
+			}
+			return nil
+		}
+
+		// never move an earlier end date later
+		query = "UPDATE coupons SET ends_at=LEAST(COALESCE(ends_at, NOW()), NOW()), updated_at=NOW() WHERE id=?"
+		if _, err := tx.ExecContext(ctx, query, id); err != nil {
+			return fmt.Errorf("error expiring coupon: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting coupon: %w", err)
+	}
+
+	return nil
+}
+
+func insertCouponScope(ctx context.Context, tx *sqlx.Tx, c *Coupon) error {
+	for _, id := range c.ProductIDs {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO coupon_products (coupon_id, product_id) VALUES (?, ?)", c.ID, id); err != nil {
+			return fmt.Errorf("error inserting coupon product: %w", err)
+		}
+	}
+
+	for _, category := range c.Categories {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO coupon_categories (coupon_id, category) VALUES (?, ?)", c.ID, category); err != nil {
+			return fmt.Errorf("error inserting coupon category: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *MySQLStore) getCouponScope(ctx context.Context, c *Coupon) error {
+	if err := s.db.SelectContext(ctx, &c.ProductIDs, "SELECT product_id FROM coupon_products WHERE coupon_id=?", c.ID); err != nil {
+		return fmt.Errorf("error getting coupon products: %w", err)
+	}
+
+	if err := s.db.SelectContext(ctx, &c.Categories, "SELECT category FROM coupon_categories WHERE coupon_id=?", c.ID); err != nil {
+		return fmt.Errorf("error getting coupon categories: %w", err)
+	}
+
+	return nil
+}
+
+// redeemCoupon counts one use of c by userID, failing with ErrCouponUsedUp
+// if that would go over either limit. Bumping the count locks the coupon
+// row, so concurrent orders with the same code are checked one at a time.
+func redeemCoupon(ctx context.Context, tx *sqlx.Tx, c *Coupon, userID int64) error {
+	query := "UPDATE coupons SET times_used=times_used+1 WHERE id=? AND (max_uses IS NULL OR times_used < max_uses)"
+	res, err := tx.ExecContext(ctx, query, c.ID)
+	if err != nil {
+		return fmt.Errorf("error redeeming coupon: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrCouponUsedUp
+	}
+
+	if c.MaxUsesPerUser != nil {
+		var used int64
+		query := "SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id=? AND user_id=?"
+		if err := tx.GetContext(ctx, &used, query, c.ID, userID); err != nil {
+			return fmt.Errorf("error counting coupon redemptions: %w", err)
+		}
+		if used >= *c.MaxUsesPerUser {
+			return ErrCouponUsedUp
+		}
+	}
+
+	return nil
+}
+
+func createCouponRedemption(ctx context.Context, tx *sqlx.Tx, o *Order) error {
+	query := "INSERT INTO coupon_redemptions (coupon_id, user_id, order_id, amount) VALUES (?, ?, ?, ?)"
+	if _, err := tx.ExecContext(ctx, query, o.Coupon.ID, o.UserID, o.ID, o.DiscountPrice); err != nil {
+		return fmt.Errorf("error inserting coupon redemption: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateCoupon(t *testing.T) {
+	insertQuery := `
+			INSERT INTO coupons (code, type, value, min_order_value, max_uses, max_uses_per_user, starts_at, ends_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`
+	maxUses := int64(100)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "whole order",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				c := &Coupon{Code: "SHIPFREE", Type: CouponFreeShipping}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(insertQuery).WithArgs("SHIPFREE", CouponFreeShipping, 0.0, 0.0, nil, nil, nil, nil).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				created, err := st.CreateCoupon(context.Background(), c)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), created.ID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "scoped",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				c := &Coupon{
+					Code:       "BOOKS20",
+					Type:       CouponPercentage,
+					Value:      20,
+					MaxUses:    &maxUses,
+					ProductIDs: []int64{7},
+					Categories: []string{"books"},
+				}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(insertQuery).WithArgs("BOOKS20", CouponPercentage, 20.0, 0.0, &maxUses, nil, nil, nil).WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectExec("INSERT INTO coupon_products (coupon_id, product_id) VALUES (?, ?)").WithArgs(2, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("INSERT INTO coupon_categories (coupon_id, category) VALUES (?, ?)").WithArgs(2, "books").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				_, err := st.CreateCoupon(context.Background(), c)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewMySQLStore(db)
+			tc.test(t, st, mock)
+		})
+	}
+}
+
+func TestGetCouponByCode(t *testing.T) {
+	columns := []string{"id", "code", "type", "value", "min_order_value", "max_uses", "max_uses_per_user", "times_used", "starts_at", "ends_at", "created_at", "updated_at"}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT * FROM coupons WHERE code=?").WithArgs("BOOKS20").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(2, "BOOKS20", CouponPercentage, 20, 0, nil, 1, 3, nil, nil, time.Now(), nil))
+				mock.ExpectQuery("SELECT product_id FROM coupon_products WHERE coupon_id=?").WithArgs(2).
+					WillReturnRows(sqlmock.NewRows([]string{"product_id"}).AddRow(7).AddRow(8))
+				mock.ExpectQuery("SELECT category FROM coupon_categories WHERE coupon_id=?").WithArgs(2).
+					WillReturnRows(sqlmock.NewRows([]string{"category"}))
+
+				c, err := st.GetCouponByCode(context.Background(), "BOOKS20")
+				require.NoError(t, err)
+				require.Equal(t, []int64{7, 8}, c.ProductIDs)
+				require.Empty(t, c.Categories)
+				require.Nil(t, c.MaxUses)
+				require.Equal(t, int64(1), *c.MaxUsesPerUser)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "not found",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT * FROM coupons WHERE code=?").WithArgs("NOPE").WillReturnError(sql.ErrNoRows)
+
+				_, err := st.GetCouponByCode(context.Background(), "NOPE")
+				require.ErrorIs(t, err, sql.ErrNoRows)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewMySQLStore(db)
+			tc.test(t, st, mock)
+		})
+	}
+}
+
+func TestDeleteCoupon(t *testing.T) {
+	query := "SELECT EXISTS (SELECT 1 FROM coupon_redemptions cr WHERE cr.coupon_id = c.id) FROM coupons c WHERE c.id=? FOR UPDATE"
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "never redeemed",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(query).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"redeemed"}).AddRow(false))
+				mock.ExpectExec("DELETE FROM coupons WHERE id=?").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := st.DeleteCoupon(context.Background(), 2)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "redeemed is expired",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(query).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"redeemed"}).AddRow(true))
+				mock.ExpectExec("UPDATE coupons SET ends_at=LEAST(COALESCE(ends_at, NOW()), NOW()), updated_at=NOW() WHERE id=?").WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := st.DeleteCoupon(context.Background(), 2)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "not found",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(query).WithArgs(2).WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+
+				err := st.DeleteCoupon(context.Background(), 2)
+				require.ErrorIs(t, err, sql.ErrNoRows)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewMySQLStore(db)
+			tc.test(t, st, mock)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// CreateIdempotencyKey saves k unless the user already used the key. It
+// reports whether k was saved; if not, the key already stored is returned.
+func (s *MySQLStore) CreateIdempotencyKey(ctx context.Context, k *IdempotencyKey) (*IdempotencyKey, bool, error) {
+	query := `
+		INSERT INTO idempotency_keys (user_id, idem_key, method, path, request_hash, response_body, expires_at)
+		VALUES (:user_id, :idem_key, :method, :path, :request_hash, :response_body, :expires_at)
+		ON DUPLICATE KEY UPDATE id=id
+	`
+	res, err := s.db.NamedExecContext(ctx, query, k)
+	if err != nil {
+		return nil, false, fmt.Errorf("error inserting idempotency key: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		var existing IdempotencyKey
+		query := "SELECT * FROM idempotency_keys WHERE user_id=? AND idem_key=?"
+		if err := s.db.GetContext(ctx, &existing, query, k.UserID, k.Key); err != nil {
+			return nil, false, fmt.Errorf("error getting idempotency key: %w", err)
+		}
+		return &existing, false, nil
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, false, fmt.Errorf("error getting last insert id: %w", err)
+	}
+	k.ID = id
+
+	return k, true, nil
+}
+
+// SaveIdempotentResponse stores the response to the request k was sent
+// with.
+func (s *MySQLStore) SaveIdempotentResponse(ctx context.Context, k *IdempotencyKey) error {
+	query := "UPDATE idempotency_keys SET status_code=:status_code, response_body=:response_body WHERE id=:id"
+	res, err := s.db.NamedExecContext(ctx, query, k)
+	if err != nil {
+		return fmt.Errorf("error updating idempotency key: %w", err)
+	}
+
+	if err := checkRowAffected(res); err != nil {
+		return fmt.Errorf("error updating idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MySQLStore) DeleteIdempotencyKey(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE id=?", id)
+	if err != nil {
+		return fmt.Errorf("error deleting idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeIdempotencyKeys deletes up to limit keys that expired before
+// expiredBefore.
+func (s *MySQLStore) PurgeIdempotencyKeys(ctx context.Context, expiredBefore time.Time, limit int) (int64, error) {
+	query := "DELETE FROM idempotency_keys WHERE expires_at < ? LIMIT ?"
+	res, err := s.db.ExecContext(ctx, query, expiredBefore, limit)
+	if err != nil {
+		return 0, fmt.Errorf("error purging idempotency keys: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateIdempotencyKey(t *testing.T) {
+	insertQuery := `
+		INSERT INTO idempotency_keys (user_id, idem_key, method, path, request_hash, response_body, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE id=id
+	`
+	expiresAt := time.Now().Add(24 * time.Hour)
+	newKey := func() *IdempotencyKey {
+		return &IdempotencyKey{
+			UserID:      1,
+			Key:         "key-1",
+			Method:      "POST",
+			Path:        "/orders/",
+			RequestHash: "abc",
+			ExpiresAt:   expiresAt,
+		}
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "new key",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertQuery).WithArgs(1, "key-1", "POST", "/orders/", "abc", "", expiresAt).WillReturnResult(sqlmock.NewResult(4, 1))
+
+				k, created, err := st.CreateIdempotencyKey(context.Background(), newKey())
+				require.NoError(t, err)
+				require.True(t, created)
+				require.Equal(t, int64(4), k.ID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "retried request",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				columns := []string{"id", "user_id", "idem_key", "method", "path", "request_hash", "status_code", "response_body", "created_at", "expires_at"}
+
+				mock.ExpectExec(insertQuery).WithArgs(1, "key-1", "POST", "/orders/", "abc", "", expiresAt).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT * FROM idempotency_keys WHERE user_id=? AND idem_key=?").WithArgs(1, "key-1").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 1, "key-1", "POST", "/orders/", "abc", 201, `{"id":7}`, time.Now(), expiresAt))
+
+				k, created, err := st.CreateIdempotencyKey(context.Background(), newKey())
+				require.NoError(t, err)
+				require.False(t, created)
+				require.Equal(t, int64(3), k.ID)
+				require.Equal(t, 201, k.StatusCode)
+				require.Equal(t, `{"id":7}`, k.ResponseBody)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewMySQLStore(db)
+			tc.test(t, st, mock)
+		})
+	}
+}
+
+func TestPurgeIdempotencyKeys(t *testing.T) {
+	now := time.Now()
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySQLStore(db)
+		mock.ExpectExec("DELETE FROM idempotency_keys WHERE expires_at < ? LIMIT ?").WithArgs(now, 100).WillReturnResult(sqlmock.NewResult(0, 7))
+
+		n, err := st.PurgeIdempotencyKeys(context.Background(), now, 100)
+		require.NoError(t, err)
+		require.Equal(t, int64(7), n)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
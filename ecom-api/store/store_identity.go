@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func (s *MySQLStore) GetUserIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error) {
+	var i UserIdentity
+	query := "SELECT * FROM user_identities WHERE provider=? AND subject=?"
+	if err := s.db.GetContext(ctx, &i, query, provider, subject); err != nil {
+		return nil, fmt.Errorf("error getting user identity: %w", err)
+	}
+
+	return &i, nil
+}
+
+func (s *MySQLStore) ListUserIdentities(ctx context.Context, userID int64) ([]UserIdentity, error) {
+	var identities []UserIdentity
+	query := "SELECT * FROM user_identities WHERE user_id=? ORDER BY id"
+	if err := s.db.SelectContext(ctx, &identities, query, userID); err != nil {
+		return nil, fmt.Errorf("error listing user identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+func (s *MySQLStore) CreateUserIdentity(ctx context.Context, i *UserIdentity) error {
+	return insertUserIdentity(ctx, s.db, i)
+}
+
+// CreateUserWithIdentity creates a user whose email was verified by the
+// identity provider, linked to that identity.
+func (s *MySQLStore) CreateUserWithIdentity(ctx context.Context, u *User, i *UserIdentity) (*User, error) {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		query := `
+			INSERT INTO users (name, email, password, email_verified_at)
+			VALUES (:name, :email, :password, NOW())
+		`
+		res, err := tx.NamedExecContext(ctx, query, u)
+		if err != nil {
+			return fmt.Errorf("error inserting user: %w", err)
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("error getting last insert ID: %w", err)
+		}
+		u.ID = id
+		u.Version = 1
+		i.UserID = id
+
+		return insertUserIdentity(ctx, tx, i)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating user with identity: %w", err)
+	}
+
+	return u, nil
+}
+
+func insertUserIdentity(ctx context.Context, db sqlx.ExtContext, i *UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES (:user_id, :provider, :subject, :email)
+	`
+	res, err := sqlx.NamedExecContext(ctx, db, query, i)
+	if err != nil {
+		return fmt.Errorf("error inserting user identity: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error getting last insert ID: %w", err)
+	}
+	i.ID = id
+
+	return nil
+}
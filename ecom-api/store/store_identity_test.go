@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateUserWithIdentity(t *testing.T) {
+	userQuery := `
+		INSERT INTO users (name, email, password, email_verified_at)
+		VALUES (?, ?, ?, NOW())
+	`
+	identityQuery := `
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES (?, ?, ?, ?)
+	`
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				u := &User{Name: "john", Email: "john@example.com"}
+				i := &UserIdentity{Provider: "google", Subject: "1234", Email: "john@example.com"}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(userQuery).WithArgs("john", "john@example.com", "").WillReturnResult(sqlmock.NewResult(7, 1))
+				mock.ExpectExec(identityQuery).WithArgs(7, "google", "1234", "john@example.com").WillReturnResult(sqlmock.NewResult(3, 1))
+				mock.ExpectCommit()
+
+				created, err := st.CreateUserWithIdentity(context.Background(), u, i)
+				require.NoError(t, err)
+				require.Equal(t, int64(7), created.ID)
+				require.Equal(t, int64(7), i.UserID)
+				require.Equal(t, int64(3), i.ID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "identity already linked",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				u := &User{Name: "john", Email: "john@example.com"}
+				i := &UserIdentity{Provider: "google", Subject: "1234", Email: "john@example.com"}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(userQuery).WithArgs("john", "john@example.com", "").WillReturnResult(sqlmock.NewResult(7, 1))
+				mock.ExpectExec(identityQuery).WithArgs(7, "google", "1234", "john@example.com").WillReturnError(errors.New("duplicate entry"))
+				mock.ExpectRollback()
+
+				_, err := st.CreateUserWithIdentity(context.Background(), u, i)
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// WithLock runs fn while holding the named MySQL advisory lock, so only one
+// replica does the work at a time. It returns false without calling fn when
+// another connection already holds the lock.
+func (s *MySQLStore) WithLock(ctx context.Context, name string, fn func(context.Context) error) (bool, error) {
+	// GET_LOCK is scoped to the connection, so keep one for the duration
+	conn, err := s.db.Connx(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error getting connection: %w", err)
+	}
+	defer conn.Close()
+
+	var acquired sql.NullInt64
+	if err := conn.GetContext(ctx, &acquired, "SELECT GET_LOCK(?, 0)", name); err != nil {
+		return false, fmt.Errorf("error acquiring lock: %w", err)
+	}
+	if acquired.Int64 != 1 {
+		return false, nil
+	}
+
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "DO RELEASE_LOCK(?)", name); err != nil {
+			log.Printf("error releasing lock %s: %v", name, err)
+		}
+	}()
+
+	return true, fn(ctx)
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	maxMFAFailures = 5
+	mfaLockMinutes = 15
+)
+
+func (s *MySQLStore) GetUserMFA(ctx context.Context, userID int64) (*UserMFA, error) {
+	var m UserMFA
+	if err := s.db.GetContext(ctx, &m, "SELECT * FROM user_mfa WHERE user_id=?", userID); err != nil {
+		return nil, fmt.Errorf("error getting user mfa: %w", err)
+	}
+
+	return &m, nil
+}
+
+// SetPendingMFA stores a new, not yet confirmed, secret for the user,
+// replacing an earlier unconfirmed one. A confirmed secret is left alone.
+func (s *MySQLStore) SetPendingMFA(ctx context.Context, userID int64, secret string) error {
+	query := `
+		INSERT INTO user_mfa (user_id, secret) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE secret=IF(confirmed_at IS NULL, VALUES(secret), secret)
+	`
+	if _, err := s.db.ExecContext(ctx, query, userID, secret); err != nil {
+		return fmt.Errorf("error setting user mfa: %w", err)
+	}
+
+	return nil
+}
+
+// ConfirmMFA enables MFA for the user and replaces their recovery codes.
+// step is the time step of the code used to confirm, so it can't be reused.
+func (s *MySQLStore) ConfirmMFA(ctx context.Context, userID, step int64, recoveryCodeHashes []string) error {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		query := "UPDATE user_mfa SET confirmed_at=NOW(), last_used_step=?, failed_attempts=0 WHERE user_id=?"
+		if _, err := tx.ExecContext(ctx, query, step, userID); err != nil {
+			return fmt.Errorf("error confirming user mfa: %w", err)
+		}
+
+		return replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes)
+	})
+	if err != nil {
+		return fmt.Errorf("error confirming mfa: %w", err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep records a successful code for step. It returns false if a code
+// from this or a later step was already used, which stops replays.
+func (s *MySQLStore) UseTOTPStep(ctx context.Context, userID, step int64) (bool, error) {
+	query := "UPDATE user_mfa SET last_used_step=?, failed_attempts=0 WHERE user_id=? AND last_used_step < ?"
+	res, err := s.db.ExecContext(ctx, query, step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("error using totp step: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// UseRecoveryCode marks the recovery code as used. It returns false if the
+// code doesn't exist or was used before.
+func (s *MySQLStore) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	query := "UPDATE mfa_recovery_codes SET used_at=NOW() WHERE user_id=? AND code_hash=? AND used_at IS NULL"
+	res, err := s.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 1 {
+		_, err = s.db.ExecContext(ctx, "UPDATE user_mfa SET failed_attempts=0 WHERE user_id=?", userID)
+		if err != nil {
+			return false, fmt.Errorf("error resetting mfa failures: %w", err)
+		}
+	}
+
+	return n == 1, nil
+}
+
+// RecordMFAFailure counts a wrong code. After maxMFAFailures in a row the
+// user is locked out of MFA for mfaLockMinutes.
+func (s *MySQLStore) RecordMFAFailure(ctx context.Context, userID int64) error {
+	query := `
+		UPDATE user_mfa
+		SET locked_until=IF(failed_attempts + 1 >= ?, DATE_ADD(NOW(), INTERVAL ? MINUTE), locked_until),
+			failed_attempts=IF(failed_attempts + 1 >= ?, 0, failed_attempts + 1)
+		WHERE user_id=?
+	`
+	if _, err := s.db.ExecContext(ctx, query, maxMFAFailures, mfaLockMinutes, maxMFAFailures, userID); err != nil {
+		return fmt.Errorf("error recording mfa failure: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MySQLStore) DeleteMFA(ctx context.Context, userID int64) error {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id=?", userID); err != nil {
+			return fmt.Errorf("error deleting recovery codes: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM user_mfa WHERE user_id=?", userID); err != nil {
+			return fmt.Errorf("error deleting user mfa: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting mfa: %w", err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sqlx.Tx, userID int64, hashes []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE user_id=?", userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+
+	for _, h := range hashes {
+		query := "INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES (?, ?)"
+		if _, err := tx.ExecContext(ctx, query, userID, h); err != nil {
+			return fmt.Errorf("error inserting recovery code: %w", err)
+		}
+	}
+
+	return nil
+}
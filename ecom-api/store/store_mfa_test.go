@@ -0,0 +1,84 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUseTOTPStep(t *testing.T) {
+	query := "UPDATE user_mfa SET last_used_step=?, failed_attempts=0 WHERE user_id=? AND last_used_step < ?"
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySQLStore(db)
+		mock.ExpectExec(query).WithArgs(1000, 2, 1000).WillReturnResult(sqlmock.NewResult(0, 1))
+		// the row no longer matches once last_used_step is 1000
+		mock.ExpectExec(query).WithArgs(1000, 2, 1000).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(query).WithArgs(999, 2, 999).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		ok, err := st.UseTOTPStep(context.Background(), 2, 1000)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = st.UseTOTPStep(context.Background(), 2, 1000)
+		require.NoError(t, err)
+		require.False(t, ok, "same step replayed")
+
+		ok, err = st.UseTOTPStep(context.Background(), 2, 999)
+		require.NoError(t, err)
+		require.False(t, ok, "earlier step")
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	query := "UPDATE mfa_recovery_codes SET used_at=NOW() WHERE user_id=? AND code_hash=? AND used_at IS NULL"
+	resetQuery := "UPDATE user_mfa SET failed_attempts=0 WHERE user_id=?"
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySQLStore(db)
+		mock.ExpectExec(query).WithArgs(2, "code").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(resetQuery).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+		// used_at is set now, so the second use matches nothing and
+		// failures aren't reset
+		mock.ExpectExec(query).WithArgs(2, "code").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		ok, err := st.UseRecoveryCode(context.Background(), 2, "code")
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		ok, err = st.UseRecoveryCode(context.Background(), 2, "code")
+		require.NoError(t, err)
+		require.False(t, ok)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestRecordMFAFailure(t *testing.T) {
+	query := `
+		UPDATE user_mfa
+		SET locked_until=IF(failed_attempts + 1 >= ?, DATE_ADD(NOW(), INTERVAL ? MINUTE), locked_until),
+			failed_attempts=IF(failed_attempts + 1 >= ?, 0, failed_attempts + 1)
+		WHERE user_id=?
+	`
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySQLStore(db)
+		mock.ExpectExec(query).WithArgs(maxMFAFailures, mfaLockMinutes, maxMFAFailures, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := st.RecordMFAFailure(context.Background(), 2)
+		require.NoError(t, err)
+		require.Equal(t, 5, maxMFAFailures)
+		require.Equal(t, 15, mfaLockMinutes)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
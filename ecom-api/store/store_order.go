@@ -3,12 +3,21 @@ package store
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
+// CreateOrder inserts o and takes its items out of stock, failing with
+// ErrOutOfStock if a product doesn't have enough units left.
 func (s *MySQLStore) CreateOrder(ctx context.Context, o *Order) (*Order, error) {
 	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		if o.Coupon != nil {
+			if err := redeemCoupon(ctx, tx, o.Coupon, o.UserID); err != nil {
+				return err
+			}
+		}
+
 		// insrt order
 		order, err := createOrder(ctx, tx, o)
 		if err != nil {
@@ -17,12 +26,31 @@ func (s *MySQLStore) CreateOrder(ctx context.Context, o *Order) (*Order, error)
 
 		for _, oi := range order.Items {
 			oi.OrderID = order.ID
+			if err := takeStock(ctx, tx, oi); err != nil {
+				return err
+			}
 			// insert order items
 			if err := createOrderItem(ctx, tx, oi); err != nil {
 				return fmt.Errorf("error inserting order items: %w", err)
 			}
 		}
 
+		for _, oa := range []*OrderAddress{order.ShippingAddress, order.BillingAddress} {
+			if oa == nil {
+				continue
+			}
+			oa.OrderID = order.ID
+			if err := createOrderAddress(ctx, tx, oa); err != nil {
+				return fmt.Errorf("error inserting order address: %w", err)
+			}
+		}
+
+		if o.Coupon != nil {
+			if err := createCouponRedemption(ctx, tx, order); err != nil {
+				return err
+			}
+		}
+
 		return nil
 	})
 	if err != nil {
@@ -34,8 +62,8 @@ func (s *MySQLStore) CreateOrder(ctx context.Context, o *Order) (*Order, error)
 
 func createOrder(ctx context.Context, tx *sqlx.Tx, o *Order) (*Order, error) {
 	query := `
-		INSERT INTO orders (payment_method, tax_price, shipping_price, total_price, user_id)
-		VALUES (:payment_method, :tax_price, :shipping_price, :total_price, :user_id)
+		INSERT INTO orders (payment_method, tax_price, shipping_price, total_price, shipping_method, coupon_code, discount_price, user_id, status)
+		VALUES (:payment_method, :tax_price, :shipping_price, :total_price, :shipping_method, :coupon_code, :discount_price, :user_id, :status)
 	`
 	res, err := tx.NamedExecContext(ctx, query, o)
 	if err != nil {
@@ -51,10 +79,32 @@ func createOrder(ctx context.Context, tx *sqlx.Tx, o *Order) (*Order, error) {
 	return o, nil
 }
 
+// takeStock removes oi's quantity from its product's stock. The check and
+// the update are one statement, so concurrent orders can't oversell.
+func takeStock(ctx context.Context, tx *sqlx.Tx, oi OrderItem) error {
+	query := "UPDATE products SET count_in_stock=count_in_stock-? WHERE id=? AND count_in_stock >= ?"
+	res, err := tx.ExecContext(ctx, query, oi.Quantity, oi.ProductID, oi.Quantity)
+	if err != nil {
+		return fmt.Errorf("error updating product stock: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: product %d", ErrOutOfStock, oi.ProductID)
+	}
+
+	return nil
+}
+
 func createOrderItem(ctx context.Context, tx *sqlx.Tx, oi OrderItem) error {
 	query := `
-		INSERT INTO order_items (name, quantity, image, price, product_id, order_id)
-		VALUES (:name, :quantity, :image, :price, :product_id, :order_id)
+		INSERT INTO order_items (name, quantity, image, price, product_id, order_id,
+			tax_category, tax_name, tax_rate, tax_inclusive, net_amount, tax_amount, discount_amount)
+		VALUES (:name, :quantity, :image, :price, :product_id, :order_id,
+			:tax_category, :tax_name, :tax_rate, :tax_inclusive, :net_amount, :tax_amount, :discount_amount)
 	`
 	res, err := tx.NamedExecContext(ctx, query, oi)
 	if err != nil {
@@ -70,9 +120,28 @@ func createOrderItem(ctx context.Context, tx *sqlx.Tx, oi OrderItem) error {
 	return nil
 }
 
+func createOrderAddress(ctx context.Context, tx *sqlx.Tx, oa *OrderAddress) error {
+	query := `
+		INSERT INTO order_addresses (order_id, kind, name, line1, line2, city, state, postal_code, country, phone)
+		VALUES (:order_id, :kind, :name, :line1, :line2, :city, :state, :postal_code, :country, :phone)
+	`
+	res, err := tx.NamedExecContext(ctx, query, oa)
+	if err != nil {
+		return fmt.Errorf("error inserting order address: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error getting last insert id: %w", err)
+	}
+	oa.ID = id
+
+	return nil
+}
+
 func (s *MySQLStore) GetOrder(ctx context.Context, userID int64) (*Order, error) {
 	var o Order
-	err := s.db.GetContext(ctx, &o, "SELECT * FROM orders WHERE user_id=?", userID)
+	err := s.db.GetContext(ctx, &o, "SELECT * FROM orders WHERE user_id=? AND deleted_at IS NULL", userID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting order: %w", err)
 	}
@@ -84,25 +153,94 @@ func (s *MySQLStore) GetOrder(ctx context.Context, userID int64) (*Order, error)
 	}
 	o.Items = items
 
+	if err := s.getOrderAddresses(ctx, &o); err != nil {
+		return nil, err
+	}
+
 	return &o, nil
 }
 
-func (s *MySQLStore) ListOrders(ctx context.Context) ([]Order, error) {
+// GetOrderByID returns the order with its items and addresses.
+func (s *MySQLStore) GetOrderByID(ctx context.Context, id int64) (*Order, error) {
+	var o Order
+	err := s.db.GetContext(ctx, &o, "SELECT * FROM orders WHERE id=? AND deleted_at IS NULL", id)
+	if err != nil {
+		return nil, fmt.Errorf("error getting order: %w", err)
+	}
+
+	orders := []Order{o}
+	if err := s.getOrderItems(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	return &orders[0], nil
+}
+
+func (s *MySQLStore) ListOrders(ctx context.Context, includeDeleted bool) ([]Order, error) {
 	var orders []Order
-	if err := s.db.SelectContext(ctx, &orders, "SELECT * FROM orders"); err != nil {
+	query := "SELECT * FROM orders WHERE deleted_at IS NULL"
+	if includeDeleted {
+		query = "SELECT * FROM orders"
+	}
+	if err := s.db.SelectContext(ctx, &orders, query); err != nil {
 		return nil, fmt.Errorf("error getting orders: %w", err)
 	}
 
+	if err := s.getOrderItems(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+// ListUserOrders returns every order the user placed, including deleted
+// ones, oldest first.
+func (s *MySQLStore) ListUserOrders(ctx context.Context, userID int64) ([]Order, error) {
+	var orders []Order
+	if err := s.db.SelectContext(ctx, &orders, "SELECT * FROM orders WHERE user_id=? ORDER BY id", userID); err != nil {
+		return nil, fmt.Errorf("error getting orders: %w", err)
+	}
+
+	if err := s.getOrderItems(ctx, orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (s *MySQLStore) getOrderItems(ctx context.Context, orders []Order) error {
 	for i := range orders {
 		var items []OrderItem
 
 		if err := s.db.SelectContext(ctx, &items, "SELECT * FROM order_items WHERE order_id=?", orders[i].ID); err != nil {
-			return nil, fmt.Errorf("error getting order items: %w", err)
+			return fmt.Errorf("error getting order items: %w", err)
 		}
 		orders[i].Items = items
+
+		if err := s.getOrderAddresses(ctx, &orders[i]); err != nil {
+			return err
+		}
 	}
 
-	return orders, nil
+	return nil
+}
+
+func (s *MySQLStore) getOrderAddresses(ctx context.Context, o *Order) error {
+	var addresses []OrderAddress
+	if err := s.db.SelectContext(ctx, &addresses, "SELECT * FROM order_addresses WHERE order_id=?", o.ID); err != nil {
+		return fmt.Errorf("error getting order addresses: %w", err)
+	}
+
+	for i := range addresses {
+		switch addresses[i].Kind {
+		case OrderAddressShipping:
+			o.ShippingAddress = &addresses[i]
+		case OrderAddressBilling:
+			o.BillingAddress = &addresses[i]
+		}
+	}
+
+	return nil
 }
 
 func (s *MySQLStore) UpdateOrderStatus(ctx context.Context, o *Order) (*Order, error) {
@@ -115,25 +253,85 @@ func (s *MySQLStore) UpdateOrderStatus(ctx context.Context, o *Order) (*Order, e
 	return o, nil
 }
 
+// DeleteOrder soft deletes the order. Its items are kept until the order is
+// purged.
 func (s *MySQLStore) DeleteOrder(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE orders SET deleted_at=NOW() WHERE id=? AND deleted_at IS NULL", id)
+	if err != nil {
+		return fmt.Errorf("error deleting order: %w", err)
+	}
+
+	if err := checkRowAffected(res); err != nil {
+		return fmt.Errorf("error deleting order: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MySQLStore) RestoreOrder(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE orders SET deleted_at=NULL WHERE id=? AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return fmt.Errorf("error restoring order: %w", err)
+	}
+
+	if err := checkRowAffected(res); err != nil {
+		return fmt.Errorf("error restoring order: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeDeletedOrders removes up to limit orders deleted before the cutoff,
+// together with their items. Orders with payments, refunds or a redeemed
+// coupon are kept, as those records are needed for accounting.
+func (s *MySQLStore) PurgeDeletedOrders(ctx context.Context, deletedBefore time.Time, limit int) (int64, error) {
+	var n int64
 	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
-		_, err := tx.ExecContext(ctx, "DELETE FROM order_items WHERE order_id=?", id)
+		var ids []int64
+		query := `
+			SELECT id FROM orders
+			WHERE deleted_at < ?
+				AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.order_id = orders.id)
+				AND NOT EXISTS (SELECT 1 FROM refunds r WHERE r.order_id = orders.id)
+				AND NOT EXISTS (SELECT 1 FROM coupon_redemptions cr WHERE cr.order_id = orders.id)
+			ORDER BY id LIMIT ? FOR UPDATE
+		`
+		if err := tx.SelectContext(ctx, &ids, query, deletedBefore, limit); err != nil {
+			return fmt.Errorf("error selecting deleted orders: %w", err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		query, args, err := sqlx.In("DELETE FROM order_items WHERE order_id IN (?)", ids)
 		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
 			return fmt.Errorf("error deleting order items: %w", err)
 		}
 
-		_, err = tx.ExecContext(ctx, "DELETE FROM orders WHERE id=?", id)
+		query, args, err = sqlx.In("DELETE FROM orders WHERE id IN (?)", ids)
+		if err != nil {
+			return err
+		}
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("error deleting orders: %w", err)
+		}
+
+		n, err = res.RowsAffected()
 		if err != nil {
-			return fmt.Errorf("error deleting order: %w", err)
+			return fmt.Errorf("error getting rows affected: %w", err)
 		}
 
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("error deleting order: %w", err)
+		return 0, fmt.Errorf("error purging orders: %w", err)
 	}
 
-	return nil
+	return n, nil
 }
 
 func (s *MySQLStore) execTx(ctx context.Context, fn func(*sqlx.Tx) error) error {
@@ -2,14 +2,29 @@ package store
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/require"
 )
 
+const itemQuery = `
+		INSERT INTO order_items (name, quantity, image, price, product_id, order_id,
+			tax_category, tax_name, tax_rate, tax_inclusive, net_amount, tax_amount, discount_amount)
+		VALUES (?, ?, ?, ?, ?, ?,
+			?, ?, ?, ?, ?, ?, ?)
+	`
+
+const stockQuery = "UPDATE products SET count_in_stock=count_in_stock-? WHERE id=? AND count_in_stock >= ?"
+
+const orderQuery = "INSERT INTO orders (payment_method, tax_price, shipping_price, total_price, shipping_method, coupon_code, discount_price, user_id, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+var orderAddressColumns = []string{"id", "order_id", "kind", "name", "line1", "line2", "city", "state", "postal_code", "country", "phone"}
+
 func TestCreateOrder(t *testing.T) {
 	ois := []OrderItem{
 		{
@@ -44,9 +59,11 @@ func TestCreateOrder(t *testing.T) {
 			name: "success",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
-				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price) VALUES (?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectExec(orderQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(stockQuery).WithArgs(1, 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(itemQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(stockQuery).WithArgs(2, 2, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(itemQuery).WillReturnResult(sqlmock.NewResult(2, 1))
 				mock.ExpectCommit()
 
 				co, err := st.CreateOrder(context.Background(), o)
@@ -57,11 +74,109 @@ func TestCreateOrder(t *testing.T) {
 				require.NoError(t, err)
 			},
 		},
+		{
+			name: "with addresses",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				addr := PostalAddress{Name: "John Doe", Line1: "1 Main St", City: "Bangkok", PostalCode: "10110", Country: "TH"}
+				wa := &Order{
+					PaymentMethod:   "test payment method",
+					TotalPrice:      99.99,
+					Items:           ois[:1],
+					ShippingAddress: &OrderAddress{Kind: OrderAddressShipping, PostalAddress: addr},
+					BillingAddress:  &OrderAddress{Kind: OrderAddressBilling, PostalAddress: addr},
+				}
+				addressQuery := "INSERT INTO order_addresses (order_id, kind, name, line1, line2, city, state, postal_code, country, phone) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+				mock.ExpectBegin()
+				mock.ExpectExec(orderQuery).WillReturnResult(sqlmock.NewResult(4, 1))
+				mock.ExpectExec(stockQuery).WithArgs(1, 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(itemQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(addressQuery).WithArgs(4, OrderAddressShipping, "John Doe", "1 Main St", "", "Bangkok", "", "10110", "TH", "").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(addressQuery).WithArgs(4, OrderAddressBilling, "John Doe", "1 Main St", "", "Bangkok", "", "10110", "TH", "").WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+
+				co, err := st.CreateOrder(context.Background(), wa)
+				require.NoError(t, err)
+				require.Equal(t, int64(4), co.ShippingAddress.OrderID)
+				require.Equal(t, int64(2), co.BillingAddress.ID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "with coupon",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				perUser := int64(1)
+				wc := &Order{
+					PaymentMethod: "test payment method",
+					TotalPrice:    89.99,
+					CouponCode:    "SAVE10",
+					DiscountPrice: 10,
+					UserID:        3,
+					Items:         ois[:1],
+					Coupon:        &Coupon{ID: 5, Code: "SAVE10", MaxUsesPerUser: &perUser},
+				}
+
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE coupons SET times_used=times_used+1 WHERE id=? AND (max_uses IS NULL OR times_used < max_uses)").WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id=? AND user_id=?").WithArgs(5, 3).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectExec(orderQuery).WillReturnResult(sqlmock.NewResult(6, 1))
+				mock.ExpectExec(stockQuery).WithArgs(1, 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(itemQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec("INSERT INTO coupon_redemptions (coupon_id, user_id, order_id, amount) VALUES (?, ?, ?, ?)").WithArgs(5, 3, 6, float32(10)).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				_, err := st.CreateOrder(context.Background(), wc)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "coupon used up by user",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				perUser := int64(1)
+				wc := &Order{
+					UserID: 3,
+					Items:  ois[:1],
+					Coupon: &Coupon{ID: 5, Code: "SAVE10", MaxUsesPerUser: &perUser},
+				}
+
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE coupons SET times_used=times_used+1 WHERE id=? AND (max_uses IS NULL OR times_used < max_uses)").WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery("SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id=? AND user_id=?").WithArgs(5, 3).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+				mock.ExpectRollback()
+
+				_, err := st.CreateOrder(context.Background(), wc)
+				require.ErrorIs(t, err, ErrCouponUsedUp)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "coupon used up",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				wc := &Order{UserID: 3, Items: ois[:1], Coupon: &Coupon{ID: 5, Code: "SAVE10"}}
+
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE coupons SET times_used=times_used+1 WHERE id=? AND (max_uses IS NULL OR times_used < max_uses)").WithArgs(5).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				_, err := st.CreateOrder(context.Background(), wc)
+				require.ErrorIs(t, err, ErrCouponUsedUp)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
 		{
 			name: "failed creating order",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
-				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price) VALUES (?, ?, ?, ?)").WillReturnError(fmt.Errorf("error creating order"))
+				mock.ExpectExec(orderQuery).WillReturnError(fmt.Errorf("error creating order"))
 				mock.ExpectRollback()
 
 				_, err := st.CreateOrder(context.Background(), o)
@@ -71,12 +186,30 @@ func TestCreateOrder(t *testing.T) {
 				require.NoError(t, err)
 			},
 		},
+		{
+			name: "out of stock",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(orderQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(stockQuery).WithArgs(1, 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(itemQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(stockQuery).WithArgs(2, 2, 2).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				_, err := st.CreateOrder(context.Background(), o)
+				require.ErrorIs(t, err, ErrOutOfStock)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
 		{
 			name: "failed creating order item",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
-				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price) VALUES (?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnError(fmt.Errorf("error creating order item"))
+				mock.ExpectExec(orderQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(stockQuery).WithArgs(1, 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(itemQuery).WillReturnError(fmt.Errorf("error creating order item"))
 				mock.ExpectRollback()
 
 				_, err := st.CreateOrder(context.Background(), o)
@@ -132,7 +265,7 @@ func TestGetOrder(t *testing.T) {
 				orows := sqlmock.NewRows([]string{"id", "payment_method", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}).
 					AddRow(1, o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt)
 
-				mock.ExpectQuery("SELECT * FROM orders WHERE id=?").WithArgs(1).WillReturnRows(orows)
+				mock.ExpectQuery("SELECT * FROM orders WHERE user_id=? AND deleted_at IS NULL").WithArgs(1).WillReturnRows(orows)
 
 				oirows := sqlmock.NewRows([]string{"id", "name", "quantity", "image", "price", "product_id", "order_id"}).
 					AddRow(1, ois[0].Name, ois[0].Quantity, ois[0].Image, ois[0].Price, ois[0].ProductID, 1).
@@ -140,9 +273,17 @@ func TestGetOrder(t *testing.T) {
 
 				mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=?").WithArgs(1).WillReturnRows(oirows)
 
+				oarows := sqlmock.NewRows(orderAddressColumns).
+					AddRow(1, 1, OrderAddressShipping, "John Doe", "1 Main St", "", "Bangkok", "", "10110", "TH", "")
+
+				mock.ExpectQuery("SELECT * FROM order_addresses WHERE order_id=?").WithArgs(1).WillReturnRows(oarows)
+
 				mo, err := st.GetOrder(context.Background(), 1)
 				require.NoError(t, err)
 				require.Equal(t, int64(1), mo.ID)
+				require.NotNil(t, mo.ShippingAddress)
+				require.Equal(t, "Bangkok", mo.ShippingAddress.City)
+				require.Nil(t, mo.BillingAddress)
 
 				for i, oi := range mo.Items {
 					require.Equal(t, ois[i].Name, oi.Name)
@@ -159,7 +300,7 @@ func TestGetOrder(t *testing.T) {
 		{
 			name: "failed getting order",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT * FROM orders WHERE id=?").WithArgs(1).WillReturnError(fmt.Errorf("error getting order"))
+				mock.ExpectQuery("SELECT * FROM orders WHERE user_id=? AND deleted_at IS NULL").WithArgs(1).WillReturnError(fmt.Errorf("error getting order"))
 
 				_, err := st.GetOrder(context.Background(), 1)
 				require.Error(t, err)
@@ -174,7 +315,7 @@ func TestGetOrder(t *testing.T) {
 				orows := sqlmock.NewRows([]string{"id", "payment_method", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}).
 					AddRow(1, o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt)
 
-				mock.ExpectQuery("SELECT * FROM orders WHERE id=?").WithArgs(1).WillReturnRows(orows)
+				mock.ExpectQuery("SELECT * FROM orders WHERE user_id=? AND deleted_at IS NULL").WithArgs(1).WillReturnRows(orows)
 
 				mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=?").WithArgs(1).WillReturnError(fmt.Errorf("error getting order items"))
 
@@ -189,9 +330,11 @@ func TestGetOrder(t *testing.T) {
 			name: "failed committing transaction",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
 				mock.ExpectBegin()
-				mock.ExpectExec("INSERT INTO orders (payment_method, tax_price, shipping_price, total_price) VALUES (?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("INSERT INTO order_items (name, quantity, image, price, product_id, order_id) VALUES (?, ?, ?, ?, ?, ?)").WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectExec(orderQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(stockQuery).WithArgs(1, 1, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(itemQuery).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(stockQuery).WithArgs(2, 2, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(itemQuery).WillReturnResult(sqlmock.NewResult(2, 1))
 				mock.ExpectCommit().WillReturnError(fmt.Errorf("error committing transaction"))
 
 				_, err := st.CreateOrder(context.Background(), o)
@@ -247,15 +390,16 @@ func TestListOrders(t *testing.T) {
 				orows := sqlmock.NewRows([]string{"id", "payment_method", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}).
 					AddRow(1, o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt)
 
-				mock.ExpectQuery("SELECT * FROM orders").WillReturnRows(orows)
+				mock.ExpectQuery("SELECT * FROM orders WHERE deleted_at IS NULL").WillReturnRows(orows)
 
 				oirows := sqlmock.NewRows([]string{"id", "name", "quantity", "image", "price", "product_id", "order_id"}).
 					AddRow(1, ois[0].Name, ois[0].Quantity, ois[0].Image, ois[0].Price, ois[0].ProductID, 1).
 					AddRow(2, ois[1].Name, ois[1].Quantity, ois[1].Image, ois[1].Price, ois[1].ProductID, 1)
 
 				mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=?").WithArgs(1).WillReturnRows(oirows)
+				mock.ExpectQuery("SELECT * FROM order_addresses WHERE order_id=?").WithArgs(1).WillReturnRows(sqlmock.NewRows(orderAddressColumns))
 
-				mo, err := st.ListOrders(context.Background())
+				mo, err := st.ListOrders(context.Background(), false)
 				require.NoError(t, err)
 				require.Len(t, mo, 1)
 
@@ -266,9 +410,9 @@ func TestListOrders(t *testing.T) {
 		{
 			name: "failed querying orders",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT * FROM orders").WillReturnError(fmt.Errorf("error querying orders"))
+				mock.ExpectQuery("SELECT * FROM orders WHERE deleted_at IS NULL").WillReturnError(fmt.Errorf("error querying orders"))
 
-				_, err := st.ListOrders(context.Background())
+				_, err := st.ListOrders(context.Background(), false)
 				require.Error(t, err)
 
 				err = mock.ExpectationsWereMet()
@@ -281,11 +425,11 @@ func TestListOrders(t *testing.T) {
 				orows := sqlmock.NewRows([]string{"id", "payment_method", "tax_price", "shipping_price", "total_price", "created_at", "updated_at"}).
 					AddRow(1, o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt)
 
-				mock.ExpectQuery("SELECT * FROM orders").WillReturnRows(orows)
+				mock.ExpectQuery("SELECT * FROM orders WHERE deleted_at IS NULL").WillReturnRows(orows)
 
 				mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=?").WithArgs(1).WillReturnError(fmt.Errorf("error querying order items"))
 
-				_, err := st.ListOrders(context.Background())
+				_, err := st.ListOrders(context.Background(), false)
 				require.Error(t, err)
 
 				err = mock.ExpectationsWereMet()
@@ -303,6 +447,8 @@ func TestListOrders(t *testing.T) {
 }
 
 func TestDeleteOrder(t *testing.T) {
+	query := "UPDATE orders SET deleted_at=NOW() WHERE id=? AND deleted_at IS NULL"
+
 	tcs := []struct {
 		name string
 		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
@@ -310,10 +456,7 @@ func TestDeleteOrder(t *testing.T) {
 		{
 			name: "success",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
-				mock.ExpectBegin()
-				mock.ExpectExec("DELETE FROM order_items WHERE order_id=?").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("DELETE FROM orders WHERE id=?").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectCommit()
+				mock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
 
 				err := st.DeleteOrder(context.Background(), 1)
 				require.NoError(t, err)
@@ -323,14 +466,12 @@ func TestDeleteOrder(t *testing.T) {
 			},
 		},
 		{
-			name: "failed deleting order item",
+			name: "not found",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
-				mock.ExpectBegin()
-				mock.ExpectExec("DELETE FROM order_items WHERE order_id=?").WithArgs(1).WillReturnError(fmt.Errorf("error deleting order item"))
-				mock.ExpectRollback()
+				mock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
 
 				err := st.DeleteOrder(context.Background(), 1)
-				require.Error(t, err)
+				require.ErrorIs(t, err, sql.ErrNoRows)
 
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
@@ -339,10 +480,7 @@ func TestDeleteOrder(t *testing.T) {
 		{
 			name: "failed deleting order",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
-				mock.ExpectBegin()
-				mock.ExpectExec("DELETE FROM order_items WHERE order_id=?").WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
-				mock.ExpectExec("DELETE FROM orders WHERE id=?").WithArgs(1).WillReturnError(fmt.Errorf("error deleting order"))
-				mock.ExpectRollback()
+				mock.ExpectExec(query).WithArgs(1).WillReturnError(fmt.Errorf("error deleting order"))
 
 				err := st.DeleteOrder(context.Background(), 1)
 				require.Error(t, err)
@@ -360,3 +498,33 @@ func TestDeleteOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestPurgeDeletedOrders(t *testing.T) {
+	cutoff := time.Now()
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySQLStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`
+			SELECT id FROM orders
+			WHERE deleted_at < ?
+				AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.order_id = orders.id)
+				AND NOT EXISTS (SELECT 1 FROM refunds r WHERE r.order_id = orders.id)
+				AND NOT EXISTS (SELECT 1 FROM coupon_redemptions cr WHERE cr.order_id = orders.id)
+			ORDER BY id LIMIT ? FOR UPDATE
+		`).
+			WithArgs(cutoff, 100).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(5))
+		mock.ExpectExec("DELETE FROM order_items WHERE order_id IN (?, ?)").WithArgs(3, 5).WillReturnResult(sqlmock.NewResult(0, 4))
+		mock.ExpectExec("DELETE FROM orders WHERE id IN (?, ?)").WithArgs(3, 5).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		n, err := st.PurgeDeletedOrders(context.Background(), cutoff, 100)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), n)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,78 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func (s *MySQLStore) CreatePasswordReset(ctx context.Context, r *PasswordReset) error {
+	query := `
+		INSERT INTO password_resets (token_hash, user_id, expires_at)
+		VALUES (:token_hash, :user_id, :expires_at)
+	`
+	if _, err := s.db.NamedExecContext(ctx, query, r); err != nil {
+		return fmt.Errorf("error inserting password reset: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MySQLStore) GetLatestPasswordReset(ctx context.Context, userID int64) (*PasswordReset, error) {
+	var r PasswordReset
+	query := "SELECT * FROM password_resets WHERE user_id=? ORDER BY created_at DESC LIMIT 1"
+	if err := s.db.GetContext(ctx, &r, query, userID); err != nil {
+		return nil, fmt.Errorf("error getting password reset: %w", err)
+	}
+
+	return &r, nil
+}
+
+// ConsumePasswordReset sets the password of the token's owner and returns
+// their ID. Every outstanding reset token for the user is used up with it.
+// Receiving the email proves the address, so it is marked verified too.
+func (s *MySQLStore) ConsumePasswordReset(ctx context.Context, tokenHash, passwordHash string) (int64, error) {
+	var userID int64
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		var r PasswordReset
+		query := "SELECT * FROM password_resets WHERE token_hash=? FOR UPDATE"
+		if err := tx.GetContext(ctx, &r, query, tokenHash); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInvalidToken
+			}
+			return fmt.Errorf("error getting password reset: %w", err)
+		}
+
+		if r.UsedAt != nil {
+			return ErrInvalidToken
+		}
+		if time.Now().After(r.ExpiresAt) {
+			return ErrTokenExpired
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE password_resets SET used_at=NOW() WHERE user_id=? AND used_at IS NULL", r.UserID); err != nil {
+			return fmt.Errorf("error using password reset: %w", err)
+		}
+
+		query = `
+			UPDATE users
+			SET password=?, email_verified_at=COALESCE(email_verified_at, NOW()), updated_at=NOW()
+			WHERE id=?
+		`
+		if _, err := tx.ExecContext(ctx, query, passwordHash, r.UserID); err != nil {
+			return fmt.Errorf("error updating password: %w", err)
+		}
+		userID = r.UserID
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error consuming password reset: %w", err)
+	}
+
+	return userID, nil
+}
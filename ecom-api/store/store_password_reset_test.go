@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumePasswordReset(t *testing.T) {
+	columns := []string{"token_hash", "user_id", "expires_at", "used_at", "created_at"}
+	selectQuery := "SELECT * FROM password_resets WHERE token_hash=? FOR UPDATE"
+	useQuery := "UPDATE password_resets SET used_at=NOW() WHERE user_id=? AND used_at IS NULL"
+	passwordQuery := `
+		UPDATE users
+		SET password=?, email_verified_at=COALESCE(email_verified_at, NOW()), updated_at=NOW()
+		WHERE id=?
+	`
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			// the update uses up the user's other outstanding tokens too
+			name: "success",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("hash", 2, time.Now().Add(time.Hour), nil, time.Now()))
+				mock.ExpectExec(useQuery).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 3))
+				mock.ExpectExec(passwordQuery).WithArgs("new-hash", 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				userID, err := st.ConsumePasswordReset(context.Background(), "hash", "new-hash")
+				require.NoError(t, err)
+				require.Equal(t, int64(2), userID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "already used",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("hash", 2, time.Now().Add(time.Hour), time.Now(), time.Now()))
+				mock.ExpectRollback()
+
+				_, err := st.ConsumePasswordReset(context.Background(), "hash", "new-hash")
+				require.ErrorIs(t, err, ErrInvalidToken)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "expired",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow("hash", 2, time.Now().Add(-time.Minute), nil, time.Now().Add(-time.Hour)))
+				mock.ExpectRollback()
+
+				_, err := st.ConsumePasswordReset(context.Background(), "hash", "new-hash")
+				require.ErrorIs(t, err, ErrTokenExpired)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
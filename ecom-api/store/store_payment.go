@@ -0,0 +1,90 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func (s *MySQLStore) CreatePayment(ctx context.Context, p *Payment) (*Payment, error) {
+	query := `
+		INSERT INTO payments (order_id, provider, reference, status, amount, error)
+		VALUES (:order_id, :provider, :reference, :status, :amount, :error)
+	`
+	res, err := s.db.NamedExecContext(ctx, query, p)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting payment: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error getting last insert id: %w", err)
+	}
+	p.ID = id
+
+	return p, nil
+}
+
+func (s *MySQLStore) UpdatePayment(ctx context.Context, p *Payment) error {
+	query := "UPDATE payments SET reference=:reference, status=:status, error=:error, updated_at=NOW() WHERE id=:id"
+	res, err := s.db.NamedExecContext(ctx, query, p)
+	if err != nil {
+		return fmt.Errorf("error updating payment: %w", err)
+	}
+
+	if err := checkRowAffected(res); err != nil {
+		return fmt.Errorf("error updating payment: %w", err)
+	}
+
+	return nil
+}
+
+// GetPaymentByReference finds the payment a provider refers to.
+func (s *MySQLStore) GetPaymentByReference(ctx context.Context, provider, reference string) (*Payment, error) {
+	var p Payment
+	query := "SELECT * FROM payments WHERE provider=? AND reference=?"
+	if err := s.db.GetContext(ctx, &p, query, provider, reference); err != nil {
+		return nil, fmt.Errorf("error getting payment: %w", err)
+	}
+
+	return &p, nil
+}
+
+func (s *MySQLStore) ListOrderPayments(ctx context.Context, orderID int64) ([]Payment, error) {
+	var payments []Payment
+	if err := s.db.SelectContext(ctx, &payments, "SELECT * FROM payments WHERE order_id=? ORDER BY id", orderID); err != nil {
+		return nil, fmt.Errorf("error listing payments: %w", err)
+	}
+
+	return payments, nil
+}
+
+// CapturePayment records p as captured and marks its order paid. It
+// returns ErrConflict if the order is no longer pending, e.g. because
+// another payment got there first.
+func (s *MySQLStore) CapturePayment(ctx context.Context, p *Payment) error {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		query := "UPDATE orders SET status=?, paid_at=NOW(), updated_at=NOW() WHERE id=? AND status=?"
+		res, err := tx.ExecContext(ctx, query, OrderPaid, p.OrderID, OrderPending)
+		if err != nil {
+			return fmt.Errorf("error updating order status: %w", err)
+		}
+		if err := checkVersionedUpdate(res); err != nil {
+			return err
+		}
+
+		p.Status = PaymentCaptured
+		query = "UPDATE payments SET status=:status, updated_at=NOW() WHERE id=:id"
+		if _, err := tx.NamedExecContext(ctx, query, p); err != nil {
+			return fmt.Errorf("error updating payment: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error capturing payment: %w", err)
+	}
+
+	return nil
+}
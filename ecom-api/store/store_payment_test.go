@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapturePayment(t *testing.T) {
+	orderQuery := "UPDATE orders SET status=?, paid_at=NOW(), updated_at=NOW() WHERE id=? AND status=?"
+	paymentQuery := "UPDATE payments SET status=?, updated_at=NOW() WHERE id=?"
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				p := &Payment{ID: 2, OrderID: 9, Status: PaymentAuthorized}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(orderQuery).WithArgs(OrderPaid, 9, OrderPending).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(paymentQuery).WithArgs(PaymentCaptured, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := st.CapturePayment(context.Background(), p)
+				require.NoError(t, err)
+				require.Equal(t, PaymentCaptured, p.Status)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "order already paid",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				p := &Payment{ID: 3, OrderID: 9, Status: PaymentAuthorized}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(orderQuery).WithArgs(OrderPaid, 9, OrderPending).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := st.CapturePayment(context.Background(), p)
+				require.ErrorIs(t, err, ErrConflict)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewMySQLStore(db)
+			tc.test(t, st, mock)
+		})
+	}
+}
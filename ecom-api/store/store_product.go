@@ -2,7 +2,9 @@ package store
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -17,8 +19,8 @@ func NewMySQLStore(db *sqlx.DB) *MySQLStore {
 
 func (s *MySQLStore) CreateProduct(ctx context.Context, p *Product) (*Product, error) {
 	query := `
-		INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock) 
-		VALUES (:name, :image, :category, :description, :rating, :num_reviews, :price, :count_in_stock)
+		INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock, weight_grams, length_mm, width_mm, height_mm, tax_category) 
+		VALUES (:name, :image, :category, :description, :rating, :num_reviews, :price, :count_in_stock, :weight_grams, :length_mm, :width_mm, :height_mm, :tax_category)
 	`
 	res, err := s.db.NamedExecContext(ctx, query, p)
 	if err != nil {
@@ -30,13 +32,14 @@ func (s *MySQLStore) CreateProduct(ctx context.Context, p *Product) (*Product, e
 		return nil, fmt.Errorf("error getting last insert id: %w", err)
 	}
 	p.ID = id
+	p.Version = 1
 
 	return p, nil
 }
 
 func (s *MySQLStore) GetProduct(ctx context.Context, id int64) (*Product, error) {
 	var p Product
-	query := `SELECT * FROM products WHERE id=?`
+	query := `SELECT * FROM products WHERE id=? AND deleted_at IS NULL`
 	if err := s.db.GetContext(ctx, &p, query, id); err != nil {
 		return nil, fmt.Errorf("error getting product: %w", err)
 	}
@@ -44,9 +47,12 @@ func (s *MySQLStore) GetProduct(ctx context.Context, id int64) (*Product, error)
 	return &p, nil
 }
 
-func (s *MySQLStore) ListProducts(ctx context.Context) ([]Product, error) {
+func (s *MySQLStore) ListProducts(ctx context.Context, includeDeleted bool) ([]Product, error) {
 	var products []Product
-	query := `SELECT * FROM products`
+	query := `SELECT * FROM products WHERE deleted_at IS NULL`
+	if includeDeleted {
+		query = `SELECT * FROM products`
+	}
 	if err := s.db.SelectContext(ctx, &products, query); err != nil {
 		return nil, fmt.Errorf("error listing products: %w", err)
 	}
@@ -54,24 +60,101 @@ func (s *MySQLStore) ListProducts(ctx context.Context) ([]Product, error) {
 	return products, nil
 }
 
+// UpdateProduct saves p if it is still at p.Version and returns
+// ErrConflict if someone else updated it first.
 func (s *MySQLStore) UpdateProduct(ctx context.Context, p *Product) (*Product, error) {
 	query := `
 		UPDATE products 
-		SET name=:name, image=:image, category=:category, description=:description, rating=:rating, num_reviews=:num_reviews, price=:price, count_in_stock=:count_in_stock, updated_at=:updated_at
-		WHERE id=:id
+		SET name=:name, image=:image, category=:category, description=:description, rating=:rating, num_reviews=:num_reviews, price=:price, count_in_stock=:count_in_stock, weight_grams=:weight_grams, length_mm=:length_mm, width_mm=:width_mm, height_mm=:height_mm, tax_category=:tax_category, updated_at=:updated_at, version=version+1
+		WHERE id=:id AND version=:version AND deleted_at IS NULL
 	`
-	if _, err := s.db.NamedExecContext(ctx, query, p); err != nil {
+	res, err := s.db.NamedExecContext(ctx, query, p)
+	if err != nil {
 		return nil, fmt.Errorf("error updating product: %w", err)
 	}
 
+	if err := checkVersionedUpdate(res); err != nil {
+		return nil, err
+	}
+	p.Version++
+
 	return p, nil
 }
 
+// DeleteProduct soft deletes the product so existing order items can still
+// refer to it.
 func (s *MySQLStore) DeleteProduct(ctx context.Context, id int64) error {
-	query := `DELETE FROM products WHERE id=?`
-	if _, err := s.db.ExecContext(ctx, query, id); err != nil {
+	query := `UPDATE products SET deleted_at=NOW() WHERE id=? AND deleted_at IS NULL`
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
 		return fmt.Errorf("error deleting product: %w", err)
 	}
 
+	if err := checkRowAffected(res); err != nil {
+		return fmt.Errorf("error deleting product: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MySQLStore) RestoreProduct(ctx context.Context, id int64) error {
+	query := `UPDATE products SET deleted_at=NULL WHERE id=? AND deleted_at IS NOT NULL`
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("error restoring product: %w", err)
+	}
+
+	if err := checkRowAffected(res); err != nil {
+		return fmt.Errorf("error restoring product: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeDeletedProducts removes up to limit products deleted before the
+// cutoff that no order item refers to.
+func (s *MySQLStore) PurgeDeletedProducts(ctx context.Context, deletedBefore time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM products
+		WHERE deleted_at < ? AND NOT EXISTS (SELECT 1 FROM order_items oi WHERE oi.product_id = products.id)
+		LIMIT ?
+	`
+	res, err := s.db.ExecContext(ctx, query, deletedBefore, limit)
+	if err != nil {
+		return 0, fmt.Errorf("error purging products: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n, nil
+}
+
+// checkVersionedUpdate turns an update that matched no row at the expected
+// version into ErrConflict.
+func checkVersionedUpdate(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// checkRowAffected returns sql.ErrNoRows if the statement matched nothing.
+func checkRowAffected(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
 	return nil
-}
\ No newline at end of file
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"testing"
 
@@ -41,8 +42,8 @@ func TestCreateProduct(t *testing.T) {
 			name: "success",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
 				query := `
-					INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock) 
-					VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+					INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock, weight_grams, length_mm, width_mm, height_mm, tax_category) 
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 				`
 				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(1, 1))
 				cp, err := st.CreateProduct(context.Background(), p)
@@ -58,8 +59,8 @@ func TestCreateProduct(t *testing.T) {
 			name: "failed inserting product",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
 				query := `
-					INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock) 
-					VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+					INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock, weight_grams, length_mm, width_mm, height_mm, tax_category) 
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 				`
 				mock.ExpectExec(query).WillReturnError(fmt.Errorf("error inserting product"))
 				_, err := st.CreateProduct(context.Background(), p)
@@ -74,8 +75,8 @@ func TestCreateProduct(t *testing.T) {
 			name: "failed getting last insert id",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
 				query := `
-					INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock) 
-					VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+					INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock, weight_grams, length_mm, width_mm, height_mm, tax_category) 
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 				`
 				mock.ExpectExec(query).WillReturnResult(sqlmock.NewErrorResult(fmt.Errorf("error getting last insert id")))
 				_, err := st.CreateProduct(context.Background(), p)
@@ -120,7 +121,7 @@ func TestGetProduct(t *testing.T) {
 				rows := sqlmock.NewRows([]string{"id", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}).
 					AddRow(1, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, p.CreatedAt, p.UpdatedAt)
 
-				mock.ExpectQuery("SELECT * FROM products WHERE id=?").WithArgs(1).WillReturnRows(rows)
+				mock.ExpectQuery("SELECT * FROM products WHERE id=? AND deleted_at IS NULL").WithArgs(1).WillReturnRows(rows)
 
 				gp, err := st.GetProduct(context.Background(), 1)
 				require.NoError(t, err)
@@ -133,7 +134,7 @@ func TestGetProduct(t *testing.T) {
 		{
 			name: "failed getting product",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT * FROM products WHERE id=?").WithArgs(1).WillReturnError(fmt.Errorf("error getting product"))
+				mock.ExpectQuery("SELECT * FROM products WHERE id=? AND deleted_at IS NULL").WithArgs(1).WillReturnError(fmt.Errorf("error getting product"))
 
 				_, err := st.GetProduct(context.Background(), 1)
 				require.Error(t, err)
@@ -176,9 +177,9 @@ func TestListProducts(t *testing.T) {
 				rows := sqlmock.NewRows([]string{"id", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock", "created_at", "updated_at"}).
 					AddRow(1, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews, p.Price, p.CountInStock, p.CreatedAt, p.UpdatedAt)
 
-				mock.ExpectQuery("SELECT * FROM products").WillReturnRows(rows)
+				mock.ExpectQuery("SELECT * FROM products WHERE deleted_at IS NULL").WillReturnRows(rows)
 
-				products, err := st.ListProducts(context.Background())
+				products, err := st.ListProducts(context.Background(), false)
 				require.NoError(t, err)
 				require.Len(t, products, 1)
 
@@ -189,9 +190,9 @@ func TestListProducts(t *testing.T) {
 		{
 			name: "failed listing products",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
-				mock.ExpectQuery("SELECT * FROM products").WillReturnError(fmt.Errorf("error listing products"))
+				mock.ExpectQuery("SELECT * FROM products WHERE deleted_at IS NULL").WillReturnError(fmt.Errorf("error listing products"))
 
-				_, err := st.ListProducts(context.Background())
+				_, err := st.ListProducts(context.Background(), false)
 				require.Error(t, err)
 
 				err = mock.ExpectationsWereMet()
@@ -243,8 +244,8 @@ func TestUpdateProduct(t *testing.T) {
 			name: "success",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
 				queryCreate := `
-					INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock) 
-					VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+					INSERT INTO products (name, image, category, description, rating, num_reviews, price, count_in_stock, weight_grams, length_mm, width_mm, height_mm, tax_category) 
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 				`
 				mock.ExpectExec(queryCreate).WillReturnResult(sqlmock.NewResult(1, 1))
 				cp, err := st.CreateProduct(context.Background(), p)
@@ -253,14 +254,15 @@ func TestUpdateProduct(t *testing.T) {
 
 				queryUpdate := `
 					UPDATE products 
-					SET name=?, image=?, category=?, description=?, rating=?, num_reviews=?, price=?, count_in_stock=?, updated_at=?
-					WHERE id=?
+					SET name=?, image=?, category=?, description=?, rating=?, num_reviews=?, price=?, count_in_stock=?, weight_grams=?, length_mm=?, width_mm=?, height_mm=?, tax_category=?, updated_at=?, version=version+1
+					WHERE id=? AND version=? AND deleted_at IS NULL
 				`
 				mock.ExpectExec(queryUpdate).WillReturnResult(sqlmock.NewResult(1, 1))
 
 				up, err := st.UpdateProduct(context.Background(), np)
 				require.NoError(t, err)
 				require.Equal(t, int64(1), up.ID)
+				require.Equal(t, int64(1), up.Version)
 
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
@@ -271,14 +273,31 @@ func TestUpdateProduct(t *testing.T) {
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
 				query := `
 					UPDATE products 
-					SET name=?, image=?, category=?, description=?, rating=?, num_reviews=?, price=?, count_in_stock=?, updated_at=?
-					WHERE id=?
+					SET name=?, image=?, category=?, description=?, rating=?, num_reviews=?, price=?, count_in_stock=?, weight_grams=?, length_mm=?, width_mm=?, height_mm=?, tax_category=?, updated_at=?, version=version+1
+					WHERE id=? AND version=? AND deleted_at IS NULL
 				`
 				mock.ExpectExec(query).WillReturnError(fmt.Errorf("error updating product"))
 
 				_, err := st.UpdateProduct(context.Background(), np)
 				require.Error(t, err)
 
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "stale version",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				query := `
+					UPDATE products 
+					SET name=?, image=?, category=?, description=?, rating=?, num_reviews=?, price=?, count_in_stock=?, weight_grams=?, length_mm=?, width_mm=?, height_mm=?, tax_category=?, updated_at=?, version=version+1
+					WHERE id=? AND version=? AND deleted_at IS NULL
+				`
+				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(0, 0))
+
+				_, err := st.UpdateProduct(context.Background(), np)
+				require.ErrorIs(t, err, ErrConflict)
+
 				err = mock.ExpectationsWereMet()
 				require.NoError(t, err)
 			},
@@ -303,8 +322,8 @@ func TestDeleteProduct(t *testing.T) {
 		{
 			name: "success",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
-				query := `DELETE FROM products WHERE id=?`
-				mock.ExpectExec(query).WillReturnResult(sqlmock.NewResult(1, 1))
+				query := `UPDATE products SET deleted_at=NOW() WHERE id=? AND deleted_at IS NULL`
+				mock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
 
 				err := st.DeleteProduct(context.Background(), 1)
 				require.NoError(t, err)
@@ -313,10 +332,23 @@ func TestDeleteProduct(t *testing.T) {
 				require.NoError(t, err)
 			},
 		},
+		{
+			name: "already deleted",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				query := `UPDATE products SET deleted_at=NOW() WHERE id=? AND deleted_at IS NULL`
+				mock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+
+				err := st.DeleteProduct(context.Background(), 1)
+				require.ErrorIs(t, err, sql.ErrNoRows)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
 		{
 			name: "failed deleting product",
 			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
-				query := `DELETE FROM products WHERE id=?`
+				query := `UPDATE products SET deleted_at=NOW() WHERE id=? AND deleted_at IS NULL`
 				mock.ExpectExec(query).WillReturnError(fmt.Errorf("error deleting product"))
 
 				err := st.DeleteProduct(context.Background(), 1)
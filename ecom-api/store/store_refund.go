@@ -0,0 +1,185 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateRefund records r against o, marks the returned quantities as
+// refunded and adds r.Amount to the order's refunded total. o.Status is
+// saved as the order's new status. The returned quantities are restocked
+// if asked to once r is completed; a pending r holds the amount and
+// quantities until CompleteRefund or CancelRefund.
+//
+// o.RefundedPrice must be the total as it was read; ErrConflict is
+// returned if another refund changed the order since.
+func (s *MySQLStore) CreateRefund(ctx context.Context, o *Order, r *Refund) error {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		query := `
+			INSERT INTO refunds (order_id, payment_id, amount, reason, reference, status, restock, created_by)
+			VALUES (:order_id, :payment_id, :amount, :reason, :reference, :status, :restock, :created_by)
+		`
+		res, err := tx.NamedExecContext(ctx, query, r)
+		if err != nil {
+			return fmt.Errorf("error inserting refund: %w", err)
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("error getting last insert id: %w", err)
+		}
+		r.ID = id
+
+		for i := range r.Items {
+			if err := createRefundItem(ctx, tx, r, &r.Items[i]); err != nil {
+				return err
+			}
+		}
+		if r.Status == RefundCompleted {
+			if err := restockRefund(ctx, tx, r); err != nil {
+				return err
+			}
+		}
+
+		query = "UPDATE orders SET refunded_price=refunded_price+?, status=?, updated_at=NOW() WHERE id=? AND refunded_price=?"
+		res, err = tx.ExecContext(ctx, query, r.Amount, o.Status, o.ID, o.RefundedPrice)
+		if err != nil {
+			return fmt.Errorf("error updating order: %w", err)
+		}
+
+		return checkVersionedUpdate(res)
+	})
+	if err != nil {
+		return fmt.Errorf("error creating refund: %w", err)
+	}
+	o.RefundedPrice += r.Amount
+
+	return nil
+}
+
+func createRefundItem(ctx context.Context, tx *sqlx.Tx, r *Refund, ri *RefundItem) error {
+	ri.RefundID = r.ID
+	query := `
+		INSERT INTO refund_items (refund_id, order_item_id, product_id, quantity, amount)
+		VALUES (:refund_id, :order_item_id, :product_id, :quantity, :amount)
+	`
+	res, err := tx.NamedExecContext(ctx, query, ri)
+	if err != nil {
+		return fmt.Errorf("error inserting refund item: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("error getting last insert id: %w", err)
+	}
+	ri.ID = id
+
+	// never refund more units than were ordered
+	query = `
+		UPDATE order_items SET refunded_quantity=refunded_quantity+?
+		WHERE id=? AND order_id=? AND refunded_quantity+? <= quantity
+	`
+	res, err = tx.ExecContext(ctx, query, ri.Quantity, ri.OrderItemID, r.OrderID, ri.Quantity)
+	if err != nil {
+		return fmt.Errorf("error updating order item: %w", err)
+	}
+	return checkVersionedUpdate(res)
+}
+
+// CompleteRefund records the provider's reference for the pending r and
+// restocks its items if asked to.
+func (s *MySQLStore) CompleteRefund(ctx context.Context, r *Refund) error {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		query := "UPDATE refunds SET status=?, reference=? WHERE id=? AND status=?"
+		res, err := tx.ExecContext(ctx, query, RefundCompleted, r.Reference, r.ID, RefundPending)
+		if err != nil {
+			return fmt.Errorf("error updating refund: %w", err)
+		}
+		if err := checkVersionedUpdate(res); err != nil {
+			return err
+		}
+
+		return restockRefund(ctx, tx, r)
+	})
+	if err != nil {
+		return fmt.Errorf("error completing refund: %w", err)
+	}
+	r.Status = RefundCompleted
+
+	return nil
+}
+
+// CancelRefund marks the pending r failed and gives back the amount and
+// quantities it held. The order goes back to paid if nothing else of it
+// was refunded.
+func (s *MySQLStore) CancelRefund(ctx context.Context, r *Refund) error {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		query := "UPDATE refunds SET status=? WHERE id=? AND status=?"
+		res, err := tx.ExecContext(ctx, query, RefundFailed, r.ID, RefundPending)
+		if err != nil {
+			return fmt.Errorf("error updating refund: %w", err)
+		}
+		if err := checkVersionedUpdate(res); err != nil {
+			return err
+		}
+
+		for _, ri := range r.Items {
+			query = "UPDATE order_items SET refunded_quantity=refunded_quantity-? WHERE id=? AND order_id=?"
+			if _, err := tx.ExecContext(ctx, query, ri.Quantity, ri.OrderItemID, r.OrderID); err != nil {
+				return fmt.Errorf("error updating order item: %w", err)
+			}
+		}
+
+		// refunded_price in the status check is already the reduced total
+		query = `
+			UPDATE orders SET refunded_price=refunded_price-?,
+				status=IF(refunded_price=0 AND NOT EXISTS (SELECT 1 FROM order_items WHERE order_id=? AND refunded_quantity>0), ?, ?),
+				updated_at=NOW()
+			WHERE id=?
+		`
+		if _, err := tx.ExecContext(ctx, query, r.Amount, r.OrderID, OrderPaid, OrderPartiallyRefunded, r.OrderID); err != nil {
+			return fmt.Errorf("error updating order: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error cancelling refund: %w", err)
+	}
+	r.Status = RefundFailed
+
+	return nil
+}
+
+func restockRefund(ctx context.Context, tx *sqlx.Tx, r *Refund) error {
+	if !r.Restock {
+		return nil
+	}
+
+	for _, ri := range r.Items {
+		query := "UPDATE products SET count_in_stock=count_in_stock+? WHERE id=?"
+		if _, err := tx.ExecContext(ctx, query, ri.Quantity, ri.ProductID); err != nil {
+			return fmt.Errorf("error restocking product: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *MySQLStore) ListOrderRefunds(ctx context.Context, orderID int64) ([]Refund, error) {
+	var refunds []Refund
+	if err := s.db.SelectContext(ctx, &refunds, "SELECT * FROM refunds WHERE order_id=? ORDER BY id", orderID); err != nil {
+		return nil, fmt.Errorf("error listing refunds: %w", err)
+	}
+
+	for i := range refunds {
+		query := "SELECT * FROM refund_items WHERE refund_id=? ORDER BY id"
+		if err := s.db.SelectContext(ctx, &refunds[i].Items, query, refunds[i].ID); err != nil {
+			return nil, fmt.Errorf("error listing refund items: %w", err)
+		}
+	}
+
+	return refunds, nil
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateRefund(t *testing.T) {
+	refundQuery := `
+			INSERT INTO refunds (order_id, payment_id, amount, reason, reference, status, restock, created_by)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`
+	itemQuery := `
+		INSERT INTO refund_items (refund_id, order_item_id, product_id, quantity, amount)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	quantityQuery := `
+		UPDATE order_items SET refunded_quantity=refunded_quantity+?
+		WHERE id=? AND order_id=? AND refunded_quantity+? <= quantity
+	`
+	orderQuery := "UPDATE orders SET refunded_price=refunded_price+?, status=?, updated_at=NOW() WHERE id=? AND refunded_price=?"
+	newRefund := func(status string, restock bool) *Refund {
+		return &Refund{
+			OrderID:   9,
+			PaymentID: 2,
+			Amount:    50,
+			Reason:    "damaged",
+			Status:    status,
+			Restock:   restock,
+			CreatedBy: 1,
+			Items:     []RefundItem{{OrderItemID: 11, ProductID: 4, Quantity: 1, Amount: 50}},
+		}
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "restocked",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				o := &Order{ID: 9, Status: OrderPartiallyRefunded, RefundedPrice: 10}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(refundQuery).WithArgs(9, 2, 50.0, "damaged", "", RefundCompleted, true, 1).WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectExec(itemQuery).WithArgs(5, 11, 4, 1, 50.0).WillReturnResult(sqlmock.NewResult(6, 1))
+				mock.ExpectExec(quantityQuery).WithArgs(1, 11, 9, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec("UPDATE products SET count_in_stock=count_in_stock+? WHERE id=?").WithArgs(1, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(orderQuery).WithArgs(50.0, OrderPartiallyRefunded, 9, 10.0).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				r := newRefund(RefundCompleted, true)
+				err := st.CreateRefund(context.Background(), o, r)
+				require.NoError(t, err)
+				require.Equal(t, int64(5), r.ID)
+				require.Equal(t, int64(5), r.Items[0].RefundID)
+				require.Equal(t, 60.0, o.RefundedPrice)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "pending isn't restocked yet",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				o := &Order{ID: 9, Status: OrderPartiallyRefunded}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(refundQuery).WithArgs(9, 2, 50.0, "damaged", "", RefundPending, true, 1).WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectExec(itemQuery).WithArgs(5, 11, 4, 1, 50.0).WillReturnResult(sqlmock.NewResult(6, 1))
+				mock.ExpectExec(quantityQuery).WithArgs(1, 11, 9, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(orderQuery).WithArgs(50.0, OrderPartiallyRefunded, 9, 0.0).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := st.CreateRefund(context.Background(), o, newRefund(RefundPending, true))
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "order changed",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				o := &Order{ID: 9, Status: OrderPartiallyRefunded}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(refundQuery).WithArgs(9, 2, 50.0, "damaged", "", RefundPending, false, 1).WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectExec(itemQuery).WithArgs(5, 11, 4, 1, 50.0).WillReturnResult(sqlmock.NewResult(6, 1))
+				mock.ExpectExec(quantityQuery).WithArgs(1, 11, 9, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(orderQuery).WithArgs(50.0, OrderPartiallyRefunded, 9, 0.0).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := st.CreateRefund(context.Background(), o, newRefund(RefundPending, false))
+				require.ErrorIs(t, err, ErrConflict)
+				require.Zero(t, o.RefundedPrice)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "item already refunded",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				o := &Order{ID: 9, Status: OrderRefunded}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(refundQuery).WithArgs(9, 2, 50.0, "damaged", "", RefundCompleted, false, 1).WillReturnResult(sqlmock.NewResult(5, 1))
+				mock.ExpectExec(itemQuery).WithArgs(5, 11, 4, 1, 50.0).WillReturnResult(sqlmock.NewResult(6, 1))
+				mock.ExpectExec(quantityQuery).WithArgs(1, 11, 9, 1).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := st.CreateRefund(context.Background(), o, newRefund(RefundCompleted, false))
+				require.ErrorIs(t, err, ErrConflict)
+				require.Zero(t, o.RefundedPrice)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewMySQLStore(db)
+			tc.test(t, st, mock)
+		})
+	}
+}
+
+func TestCompleteRefund(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySQLStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE refunds SET status=?, reference=? WHERE id=? AND status=?").
+			WithArgs(RefundCompleted, "fake_refund_3", 5, RefundPending).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE products SET count_in_stock=count_in_stock+? WHERE id=?").WithArgs(1, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		r := &Refund{ID: 5, OrderID: 9, Reference: "fake_refund_3", Status: RefundPending, Restock: true, Items: []RefundItem{{OrderItemID: 11, ProductID: 4, Quantity: 1}}}
+		err := st.CompleteRefund(context.Background(), r)
+		require.NoError(t, err)
+		require.Equal(t, RefundCompleted, r.Status)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestCancelRefund(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewMySQLStore(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE refunds SET status=? WHERE id=? AND status=?").
+			WithArgs(RefundFailed, 5, RefundPending).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE order_items SET refunded_quantity=refunded_quantity-? WHERE id=? AND order_id=?").
+			WithArgs(1, 11, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`
+			UPDATE orders SET refunded_price=refunded_price-?,
+				status=IF(refunded_price=0 AND NOT EXISTS (SELECT 1 FROM order_items WHERE order_id=? AND refunded_quantity>0), ?, ?),
+				updated_at=NOW()
+			WHERE id=?
+		`).WithArgs(50.0, 9, OrderPaid, OrderPartiallyRefunded, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		r := &Refund{ID: 5, OrderID: 9, Amount: 50, Status: RefundPending, Restock: true, Items: []RefundItem{{OrderItemID: 11, ProductID: 4, Quantity: 1}}}
+		err := st.CancelRefund(context.Background(), r)
+		require.NoError(t, err)
+		require.Equal(t, RefundFailed, r.Status)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
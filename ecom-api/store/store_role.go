@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func (s *MySQLStore) GetUserRoles(ctx context.Context, userID int64) ([]string, error) {
+	var roles []string
+	query := `
+		SELECT r.name FROM roles r
+		JOIN user_roles ur ON ur.role_id = r.id
+		WHERE ur.user_id=?
+		ORDER BY r.name
+	`
+	if err := s.db.SelectContext(ctx, &roles, query, userID); err != nil {
+		return nil, fmt.Errorf("error getting user roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+func (s *MySQLStore) GetUserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	var permissions []string
+	query := `
+		SELECT DISTINCT p.name FROM permissions p
+		JOIN role_permissions rp ON rp.permission_id = p.id
+		JOIN user_roles ur ON ur.role_id = rp.role_id
+		WHERE ur.user_id=?
+		ORDER BY p.name
+	`
+	if err := s.db.SelectContext(ctx, &permissions, query, userID); err != nil {
+		return nil, fmt.Errorf("error getting user permissions: %w", err)
+	}
+
+	return permissions, nil
+}
+
+// SetUserRoles replaces the user's roles with roles and records every grant
+// and revocation made by actorID in privilege_audit. It reports whether any
+// role was taken away.
+func (s *MySQLStore) SetUserRoles(ctx context.Context, userID int64, roles []string, actorID int64) (bool, error) {
+	revoked := false
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		var current []string
+		query := `
+			SELECT r.name FROM roles r
+			JOIN user_roles ur ON ur.role_id = r.id
+			WHERE ur.user_id=?
+			FOR UPDATE
+		`
+		if err := tx.SelectContext(ctx, &current, query, userID); err != nil {
+			return fmt.Errorf("error getting user roles: %w", err)
+		}
+
+		granted, removed := diffRoles(current, roles)
+		for _, role := range granted {
+			res, err := tx.ExecContext(ctx, `
+				INSERT INTO user_roles (user_id, role_id)
+				SELECT ?, id FROM roles WHERE name=?
+			`, userID, role)
+			if err != nil {
+				return fmt.Errorf("error granting role: %w", err)
+			}
+			if n, err := res.RowsAffected(); err != nil || n == 0 {
+				return fmt.Errorf("%w: %s", ErrUnknownRole, role)
+			}
+
+			if err := auditPrivilege(ctx, tx, actorID, userID, AuditRoleGranted, role); err != nil {
+				return err
+			}
+		}
+
+		for _, role := range removed {
+			_, err := tx.ExecContext(ctx, `
+				DELETE ur FROM user_roles ur
+				JOIN roles r ON r.id = ur.role_id
+				WHERE ur.user_id=? AND r.name=?
+			`, userID, role)
+			if err != nil {
+				return fmt.Errorf("error revoking role: %w", err)
+			}
+
+			if err := auditPrivilege(ctx, tx, actorID, userID, AuditRoleRevoked, role); err != nil {
+				return err
+			}
+		}
+		revoked = len(removed) > 0
+
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("error setting user roles: %w", err)
+	}
+
+	return revoked, nil
+}
+
+func (s *MySQLStore) ListPrivilegeAudit(ctx context.Context, targetUserID int64) ([]PrivilegeAudit, error) {
+	var entries []PrivilegeAudit
+	query := "SELECT * FROM privilege_audit WHERE target_user_id=? ORDER BY id DESC"
+	if err := s.db.SelectContext(ctx, &entries, query, targetUserID); err != nil {
+		return nil, fmt.Errorf("error listing privilege audit: %w", err)
+	}
+
+	return entries, nil
+}
+
+func auditPrivilege(ctx context.Context, tx *sqlx.Tx, actorID, targetID int64, action, role string) error {
+	query := `
+		INSERT INTO privilege_audit (actor_user_id, target_user_id, action, role)
+		VALUES (?, ?, ?, ?)
+	`
+	if _, err := tx.ExecContext(ctx, query, actorID, targetID, action, role); err != nil {
+		return fmt.Errorf("error recording privilege audit: %w", err)
+	}
+
+	return nil
+}
+
+// diffRoles returns the roles in want but not in have, and in have but not
+// in want.
+func diffRoles(have, want []string) (granted, removed []string) {
+	haveSet := make(map[string]bool, len(have))
+	for _, r := range have {
+		haveSet[r] = true
+	}
+	wantSet := make(map[string]bool, len(want))
+	for _, r := range want {
+		if !wantSet[r] && !haveSet[r] {
+			granted = append(granted, r)
+		}
+		wantSet[r] = true
+	}
+	for _, r := range have {
+		if !wantSet[r] {
+			removed = append(removed, r)
+		}
+	}
+
+	return granted, removed
+}
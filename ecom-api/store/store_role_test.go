@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetUserRoles(t *testing.T) {
+	selectQuery := `
+		SELECT r.name FROM roles r
+		JOIN user_roles ur ON ur.role_id = r.id
+		WHERE ur.user_id=?
+		FOR UPDATE
+	`
+	grantQuery := `
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT ?, id FROM roles WHERE name=?
+	`
+	revokeQuery := `
+		DELETE ur FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id=? AND r.name=?
+	`
+	auditQuery := `
+		INSERT INTO privilege_audit (actor_user_id, target_user_id, action, role)
+		VALUES (?, ?, ?, ?)
+	`
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "grant and revoke",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("support"))
+				mock.ExpectExec(grantQuery).WithArgs(2, "catalog-manager").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(auditQuery).WithArgs(1, 2, AuditRoleGranted, "catalog-manager").WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(revokeQuery).WithArgs(2, "support").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(auditQuery).WithArgs(1, 2, AuditRoleRevoked, "support").WillReturnResult(sqlmock.NewResult(2, 1))
+				mock.ExpectCommit()
+
+				revoked, err := st.SetUserRoles(context.Background(), 2, []string{"catalog-manager"}, 1)
+				require.NoError(t, err)
+				require.True(t, revoked)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unchanged",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("support"))
+				mock.ExpectCommit()
+
+				revoked, err := st.SetUserRoles(context.Background(), 2, []string{"support"}, 1)
+				require.NoError(t, err)
+				require.False(t, revoked)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unknown role",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"name"}))
+				mock.ExpectExec(grantQuery).WithArgs(2, "root").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				_, err := st.SetUserRoles(context.Background(), 2, []string{"root"}, 1)
+				require.ErrorIs(t, err, ErrUnknownRole)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
@@ -3,12 +3,13 @@ package store
 import (
 	"context"
 	"fmt"
+	"time"
 )
 
 func (s *MySQLStore) CreateSession(ctx context.Context, sess *Session) (*Session, error) {
 	query := `
-		INSERT INTO sessions (id, user_email, refresh_token, is_revoked, expires_at)
-		VALUES (:id, :user_email, :refresh_token, :is_revoked, :expires_at)	
+		INSERT INTO sessions (id, user_email, refresh_token, is_revoked, expires_at, user_agent, client_ip)
+		VALUES (:id, :user_email, :refresh_token, :is_revoked, :expires_at, :user_agent, :client_ip)
 	`
 	_, err := s.db.NamedExecContext(ctx, query, sess)
 	if err != nil {
@@ -28,8 +29,36 @@ func (s *MySQLStore) GetSession(ctx context.Context, id string) (*Session, error
 	return &session, nil
 }
 
+// ListSessions returns the user's sessions that are neither revoked nor
+// expired, newest first.
+func (s *MySQLStore) ListSessions(ctx context.Context, email string) ([]Session, error) {
+	var sessions []Session
+	query := `
+		SELECT * FROM sessions
+		WHERE user_email=? AND is_revoked=0 AND expires_at > NOW()
+		ORDER BY created_at DESC
+	`
+	if err := s.db.SelectContext(ctx, &sessions, query, email); err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// ListSessionHistory returns all of the user's sessions, including revoked
+// and expired ones that were not purged yet, newest first.
+func (s *MySQLStore) ListSessionHistory(ctx context.Context, email string) ([]Session, error) {
+	var sessions []Session
+	query := "SELECT * FROM sessions WHERE user_email=? ORDER BY created_at DESC"
+	if err := s.db.SelectContext(ctx, &sessions, query, email); err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
 func (s *MySQLStore) RevokeSession(ctx context.Context, id string) error {
-	query := "UPDATE sessions SET is_revoked=1 WHERE id=:id"
+	query := "UPDATE sessions SET is_revoked=1, revoked_at=NOW() WHERE id=:id"
 	_, err := s.db.NamedExecContext(ctx, query, map[string]any{"id": id})
 	if err != nil {
 		return err
@@ -46,3 +75,43 @@ func (s *MySQLStore) DeleteSession(ctx context.Context, id string) error {
 
 	return nil
 }
+
+func (s *MySQLStore) RevokeUserSessions(ctx context.Context, email string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE sessions SET is_revoked=1, revoked_at=NOW() WHERE user_email=? AND is_revoked=0", email)
+	if err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of the user except keepID.
+func (s *MySQLStore) RevokeOtherSessions(ctx context.Context, email, keepID string) error {
+	query := "UPDATE sessions SET is_revoked=1, revoked_at=NOW() WHERE user_email=? AND id<>? AND is_revoked=0"
+	if _, err := s.db.ExecContext(ctx, query, email, keepID); err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeSessions deletes up to limit sessions that expired before
+// expiredBefore or were revoked before revokedBefore.
+func (s *MySQLStore) PurgeSessions(ctx context.Context, expiredBefore, revokedBefore time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM sessions
+		WHERE expires_at < ? OR (is_revoked=1 AND revoked_at < ?)
+		LIMIT ?
+	`
+	res, err := s.db.ExecContext(ctx, query, expiredBefore, revokedBefore, limit)
+	if err != nil {
+		return 0, fmt.Errorf("error purging sessions: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListSessions(t *testing.T) {
+	query := `
+		SELECT * FROM sessions
+		WHERE user_email=? AND is_revoked=0 AND expires_at > NOW()
+		ORDER BY created_at DESC
+	`
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows([]string{"id", "user_email", "refresh_token", "is_revoked", "created_at", "expires_at", "user_agent", "client_ip", "revoked_at"}).
+					AddRow("s1", "test@example.com", "token", false, time.Now(), time.Now().Add(time.Hour), "curl/8.0", "127.0.0.1", nil)
+
+				mock.ExpectQuery(query).WithArgs("test@example.com").WillReturnRows(rows)
+
+				sessions, err := st.ListSessions(context.Background(), "test@example.com")
+				require.NoError(t, err)
+				require.Len(t, sessions, 1)
+				require.Equal(t, "curl/8.0", sessions[0].UserAgent)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed listing sessions",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).WithArgs("test@example.com").WillReturnError(fmt.Errorf("error listing sessions"))
+
+				_, err := st.ListSessions(context.Background(), "test@example.com")
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	query := "UPDATE sessions SET is_revoked=1, revoked_at=NOW() WHERE user_email=? AND is_revoked=0"
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs("test@example.com").WillReturnResult(sqlmock.NewResult(0, 2))
+
+				err := st.RevokeUserSessions(context.Background(), "test@example.com")
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed revoking sessions",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs("test@example.com").WillReturnError(fmt.Errorf("error revoking sessions"))
+
+				err := st.RevokeUserSessions(context.Background(), "test@example.com")
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestPurgeSessions(t *testing.T) {
+	query := `
+		DELETE FROM sessions
+		WHERE expires_at < ? OR (is_revoked=1 AND revoked_at < ?)
+		LIMIT ?
+	`
+	now := time.Now()
+	retention := now.Add(-24 * time.Hour)
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs(now, retention, 100).WillReturnResult(sqlmock.NewResult(0, 42))
+
+				n, err := st.PurgeSessions(context.Background(), now, retention, 100)
+				require.NoError(t, err)
+				require.Equal(t, int64(42), n)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "failed purging sessions",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs(now, retention, 100).WillReturnError(fmt.Errorf("error purging sessions"))
+
+				_, err := st.PurgeSessions(context.Background(), now, retention, 100)
+				require.Error(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
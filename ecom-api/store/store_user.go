@@ -3,12 +3,16 @@ package store
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
 func (s *MySQLStore) CreateUser(ctx context.Context, u *User) (*User, error) {
 	query := `
-		INSERT INTO users (name, email, password, is_admin)
-		VALUES (:name, :email, :password, :is_admin)
+		INSERT INTO users (name, email, password)
+		VALUES (:name, :email, :password)
 	`
 	res, err := s.db.NamedExecContext(ctx, query, u)
 	if err != nil {
@@ -20,6 +24,7 @@ func (s *MySQLStore) CreateUser(ctx context.Context, u *User) (*User, error) {
 		return nil, fmt.Errorf("error getting last insert ID: %w", err)
 	}
 	u.ID = id
+	u.Version = 1
 
 	return u, nil
 }
@@ -27,38 +32,258 @@ func (s *MySQLStore) CreateUser(ctx context.Context, u *User) (*User, error) {
 func (s *MySQLStore) GetUser(ctx context.Context, email string) (*User, error) {
 	var u User
 
-	if err := s.db.GetContext(ctx, &u, "SELECT * FROM users WHERE email=?", email); err != nil {
+	if err := s.db.GetContext(ctx, &u, "SELECT * FROM users WHERE email=? AND deleted_at IS NULL", email); err != nil {
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	return &u, nil
+}
+
+func (s *MySQLStore) GetUserByID(ctx context.Context, id int64) (*User, error) {
+	var u User
+
+	if err := s.db.GetContext(ctx, &u, "SELECT * FROM users WHERE id=? AND deleted_at IS NULL", id); err != nil {
 		return nil, fmt.Errorf("error getting user: %w", err)
 	}
 
 	return &u, nil
 }
 
-func (s *MySQLStore) ListUsers(ctx context.Context) ([]User, error) {
-	var users []User
+// ListUsers returns a page of users ordered by ID and the number of users
+// matching the filter across all pages.
+func (s *MySQLStore) ListUsers(ctx context.Context, params ListUsersParams) ([]User, int64, error) {
+	var (
+		conds []string
+		args  []any
+	)
+	if !params.IncludeDeleted {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+	if params.Query != "" {
+		pattern := "%" + escapeLike(params.Query) + "%"
+		conds = append(conds, "(name LIKE ? OR email LIKE ?)")
+		args = append(args, pattern, pattern)
+	}
 
-	if err := s.db.SelectContext(ctx, &users, "SELECT * FROM users"); err != nil {
-		return nil, fmt.Errorf("error getting users: %w", err)
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
 	}
 
-	return users, nil
+	var total int64
+	if err := s.db.GetContext(ctx, &total, "SELECT COUNT(*) FROM users"+where, args...); err != nil {
+		return nil, 0, fmt.Errorf("error counting users: %w", err)
+	}
+
+	users := []User{}
+	query := "SELECT * FROM users" + where + " ORDER BY id LIMIT ? OFFSET ?"
+	args = append(args, params.Limit, params.Offset)
+	if err := s.db.SelectContext(ctx, &users, query, args...); err != nil {
+		return nil, 0, fmt.Errorf("error getting users: %w", err)
+	}
+
+	return users, total, nil
 }
 
+// UpdateUser saves u's profile if it is still at u.Version and returns
+// ErrConflict if someone else updated it first. Passwords are changed with
+// UpdateUserPassword.
 func (s *MySQLStore) UpdateUser(ctx context.Context, u *User) (*User, error) {
-	query := `UPDATE users SET name=:name, email=:email, password=:password, is_admin=:is_admin, updated_at=:updated_at`
-	_, err := s.db.NamedExecContext(ctx, query, u)
+	query := `
+		UPDATE users SET name=:name, email=:email, phone=:phone, default_address=:default_address,
+			updated_at=:updated_at, version=version+1
+		WHERE id=:id AND version=:version AND deleted_at IS NULL
+	`
+	res, err := s.db.NamedExecContext(ctx, query, u)
 	if err != nil {
 		return nil, fmt.Errorf("error updating user: %w", err)
 	}
 
+	if err := checkVersionedUpdate(res); err != nil {
+		return nil, err
+	}
+	u.Version++
+
 	return u, nil
 }
 
+// ChangeUserEmail saves u with a new email address, which has to be verified
+// again. Verification and password reset links still outstanding are
+// cancelled and the sessions of oldEmail are revoked, since sessions are
+// tied to the email address.
+func (s *MySQLStore) ChangeUserEmail(ctx context.Context, u *User, oldEmail string) (*User, error) {
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		query := `
+			UPDATE users SET name=:name, email=:email, phone=:phone, default_address=:default_address,
+				email_verified_at=NULL, updated_at=:updated_at, version=version+1
+			WHERE id=:id AND version=:version AND deleted_at IS NULL
+		`
+		res, err := tx.NamedExecContext(ctx, query, u)
+		if err != nil {
+			return fmt.Errorf("error updating user: %w", err)
+		}
+		if err := checkVersionedUpdate(res); err != nil {
+			return err
+		}
+
+		query = "UPDATE email_verifications SET used_at=NOW() WHERE user_id=? AND used_at IS NULL"
+		if _, err := tx.ExecContext(ctx, query, u.ID); err != nil {
+			return fmt.Errorf("error cancelling email verifications: %w", err)
+		}
+		// a reset link proves the address it was sent to
+		query = "UPDATE password_resets SET used_at=NOW() WHERE user_id=? AND used_at IS NULL"
+		if _, err := tx.ExecContext(ctx, query, u.ID); err != nil {
+			return fmt.Errorf("error cancelling password resets: %w", err)
+		}
+
+		query = "UPDATE sessions SET is_revoked=1, revoked_at=NOW() WHERE user_email=? AND is_revoked=0"
+		if _, err := tx.ExecContext(ctx, query, oldEmail); err != nil {
+			return fmt.Errorf("error revoking sessions: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error changing email: %w", err)
+	}
+	u.Version++
+	u.EmailVerifiedAt = nil
+
+	return u, nil
+}
+
+func (s *MySQLStore) UpdateUserPassword(ctx context.Context, id int64, passwordHash string) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE users SET password=?, updated_at=NOW() WHERE id=?", passwordHash, id)
+	if err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUser soft deletes the user. The row is kept, with its orders, until
+// PurgeDeletedUsers removes it after the retention period.
 func (s *MySQLStore) DeleteUser(ctx context.Context, id int64) error {
-	_, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE id=?", id)
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET deleted_at=NOW() WHERE id=? AND deleted_at IS NULL", id)
 	if err != nil {
 		return fmt.Errorf("erorr deleting user: %w", err)
 	}
 
+	if err := checkRowAffected(res); err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MySQLStore) RestoreUser(ctx context.Context, id int64) error {
+	query := "UPDATE users SET deleted_at=NULL WHERE id=? AND deleted_at IS NOT NULL AND anonymized_at IS NULL"
+	res, err := s.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("error restoring user: %w", err)
+	}
+
+	if err := checkRowAffected(res); err != nil {
+		return fmt.Errorf("error restoring user: %w", err)
+	}
+
 	return nil
 }
+
+// AnonymizedEmail is the placeholder address an erased user is left with.
+// It keeps the email column unique and can never receive mail.
+func AnonymizedEmail(id int64) string {
+	return fmt.Sprintf("deleted-%d@anonymized.invalid", id)
+}
+
+// AnonymizeUser erases u's personal data and deletes the account. The user
+// row is kept with placeholder values so their orders, and the amounts in
+// them, stay intact for accounting; the addresses on those orders are
+// blanked. Their sessions are revoked and stripped
+// of the email, client and token, and everything only used to sign in is
+// removed.
+func (s *MySQLStore) AnonymizeUser(ctx context.Context, u *User) error {
+	email := AnonymizedEmail(u.ID)
+
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		query := `
+			UPDATE users SET name='Deleted user', email=?, password='', phone=NULL, default_address=NULL,
+				email_verified_at=NULL, updated_at=NOW(), deleted_at=COALESCE(deleted_at, NOW()),
+				anonymized_at=NOW(), version=version+1
+			WHERE id=? AND anonymized_at IS NULL
+		`
+		res, err := tx.ExecContext(ctx, query, email, u.ID)
+		if err != nil {
+			return fmt.Errorf("error anonymizing user: %w", err)
+		}
+		if err := checkRowAffected(res); err != nil {
+			return err
+		}
+
+		query = `
+			UPDATE sessions SET user_email=?, refresh_token='', user_agent='', client_ip='',
+				is_revoked=1, revoked_at=COALESCE(revoked_at, NOW())
+			WHERE user_email=?
+		`
+		if _, err := tx.ExecContext(ctx, query, email, u.Email); err != nil {
+			return fmt.Errorf("error anonymizing sessions: %w", err)
+		}
+
+		// keep the country and state for tax records
+		query = `
+			UPDATE order_addresses oa JOIN orders o ON o.id = oa.order_id
+			SET oa.name='', oa.line1='', oa.line2='', oa.city='', oa.postal_code='', oa.phone=''
+			WHERE o.user_id=?
+		`
+		if _, err := tx.ExecContext(ctx, query, u.ID); err != nil {
+			return fmt.Errorf("error anonymizing order addresses: %w", err)
+		}
+
+		for _, table := range []string{
+			"addresses",
+			"user_identities",
+			"user_mfa",
+			"mfa_recovery_codes",
+			"email_verifications",
+			"password_resets",
+			"user_roles",
+		} {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id=?", u.ID); err != nil {
+				return fmt.Errorf("error deleting %s: %w", table, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error erasing user: %w", err)
+	}
+
+	return nil
+}
+
+// PurgeDeletedUsers removes up to limit users deleted before the cutoff.
+// Users who still have orders are kept so order history stays intact.
+func (s *MySQLStore) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time, limit int) (int64, error) {
+	query := `
+		DELETE FROM users
+		WHERE deleted_at < ? AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.user_id = users.id)
+		LIMIT ?
+	`
+	res, err := s.db.ExecContext(ctx, query, deletedBefore, limit)
+	if err != nil {
+		return 0, fmt.Errorf("error purging users: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error getting rows affected: %w", err)
+	}
+
+	return n, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,253 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+var userColumns = []string{"id", "name", "email", "password", "created_at", "updated_at", "email_verified_at", "phone", "default_address", "version", "deleted_at", "anonymized_at"}
+
+func TestListUsers(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "first page",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT COUNT(*) FROM users WHERE deleted_at IS NULL").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+				rows := sqlmock.NewRows(userColumns).
+					AddRow(1, "john", "john@example.com", "hash", time.Now(), nil, nil, nil, nil, 1, nil, nil).
+					AddRow(2, "jane", "jane@example.com", "hash", time.Now(), nil, nil, "+66 81 234 5678", nil, 1, nil, nil)
+				mock.ExpectQuery("SELECT * FROM users WHERE deleted_at IS NULL ORDER BY id LIMIT ? OFFSET ?").WithArgs(2, 0).WillReturnRows(rows)
+
+				users, total, err := st.ListUsers(context.Background(), ListUsersParams{Limit: 2})
+				require.NoError(t, err)
+				require.Equal(t, int64(3), total)
+				require.Len(t, users, 2)
+				require.Equal(t, "+66 81 234 5678", *users[1].Phone)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "search escapes wildcards",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				pattern := `%50\%\_off%`
+				mock.ExpectQuery("SELECT COUNT(*) FROM users WHERE deleted_at IS NULL AND (name LIKE ? OR email LIKE ?)").WithArgs(pattern, pattern).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+				mock.ExpectQuery("SELECT * FROM users WHERE deleted_at IS NULL AND (name LIKE ? OR email LIKE ?) ORDER BY id LIMIT ? OFFSET ?").WithArgs(pattern, pattern, 20, 40).WillReturnRows(sqlmock.NewRows(userColumns))
+
+				users, total, err := st.ListUsers(context.Background(), ListUsersParams{Query: "50%_off", Limit: 20, Offset: 40})
+				require.NoError(t, err)
+				require.Zero(t, total)
+				require.Empty(t, users)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	query := `
+		UPDATE users SET name=?, email=?, phone=?, default_address=?,
+			updated_at=?, version=version+1
+		WHERE id=? AND version=? AND deleted_at IS NULL
+	`
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				u := &User{ID: 2, Name: "jane", Email: "jane@example.com", Version: 3}
+				mock.ExpectExec(query).WithArgs("jane", "jane@example.com", nil, nil, nil, 2, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				updated, err := st.UpdateUser(context.Background(), u)
+				require.NoError(t, err)
+				require.Equal(t, int64(4), updated.Version)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "stale version",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				u := &User{ID: 2, Name: "jane", Email: "jane@example.com", Version: 3}
+				mock.ExpectExec(query).WithArgs("jane", "jane@example.com", nil, nil, nil, 2, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+
+				_, err := st.UpdateUser(context.Background(), u)
+				require.ErrorIs(t, err, ErrConflict)
+				require.Equal(t, int64(3), u.Version)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestChangeUserEmail(t *testing.T) {
+	userQuery := `
+		UPDATE users SET name=?, email=?, phone=?, default_address=?,
+			email_verified_at=NULL, updated_at=?, version=version+1
+		WHERE id=? AND version=? AND deleted_at IS NULL
+	`
+	verificationsQuery := "UPDATE email_verifications SET used_at=NOW() WHERE user_id=? AND used_at IS NULL"
+	resetsQuery := "UPDATE password_resets SET used_at=NOW() WHERE user_id=? AND used_at IS NULL"
+	sessionsQuery := "UPDATE sessions SET is_revoked=1, revoked_at=NOW() WHERE user_email=? AND is_revoked=0"
+	verifiedAt := time.Now()
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				u := &User{ID: 2, Name: "jane", Email: "new@example.com", EmailVerifiedAt: &verifiedAt, Version: 3}
+				mock.ExpectBegin()
+				mock.ExpectExec(userQuery).WithArgs("jane", "new@example.com", nil, nil, nil, 2, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(verificationsQuery).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(resetsQuery).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(sessionsQuery).WithArgs("jane@example.com").WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectCommit()
+
+				updated, err := st.ChangeUserEmail(context.Background(), u, "jane@example.com")
+				require.NoError(t, err)
+				require.Equal(t, int64(4), updated.Version)
+				require.Nil(t, updated.EmailVerifiedAt)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "stale version",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				u := &User{ID: 2, Name: "jane", Email: "new@example.com", EmailVerifiedAt: &verifiedAt, Version: 3}
+				mock.ExpectBegin()
+				mock.ExpectExec(userQuery).WithArgs("jane", "new@example.com", nil, nil, nil, 2, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				_, err := st.ChangeUserEmail(context.Background(), u, "jane@example.com")
+				require.ErrorIs(t, err, ErrConflict)
+				require.Equal(t, int64(3), u.Version)
+				require.NotNil(t, u.EmailVerifiedAt)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestAnonymizeUser(t *testing.T) {
+	userQuery := `
+			UPDATE users SET name='Deleted user', email=?, password='', phone=NULL, default_address=NULL,
+				email_verified_at=NULL, updated_at=NOW(), deleted_at=COALESCE(deleted_at, NOW()),
+				anonymized_at=NOW(), version=version+1
+			WHERE id=? AND anonymized_at IS NULL
+		`
+	sessionQuery := `
+			UPDATE sessions SET user_email=?, refresh_token='', user_agent='', client_ip='',
+				is_revoked=1, revoked_at=COALESCE(revoked_at, NOW())
+			WHERE user_email=?
+		`
+	orderAddressQuery := `
+			UPDATE order_addresses oa JOIN orders o ON o.id = oa.order_id
+			SET oa.name='', oa.line1='', oa.line2='', oa.city='', oa.postal_code='', oa.phone=''
+			WHERE o.user_id=?
+		`
+	tables := []string{"addresses", "user_identities", "user_mfa", "mfa_recovery_codes", "email_verifications", "password_resets", "user_roles"}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				u := &User{ID: 7, Email: "john@example.com"}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(userQuery).WithArgs("deleted-7@anonymized.invalid", 7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(sessionQuery).WithArgs("deleted-7@anonymized.invalid", "john@example.com").WillReturnResult(sqlmock.NewResult(0, 2))
+				mock.ExpectExec(orderAddressQuery).WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 2))
+				for _, table := range tables {
+					mock.ExpectExec("DELETE FROM " + table + " WHERE user_id=?").WithArgs(7).WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectCommit()
+
+				err := st.AnonymizeUser(context.Background(), u)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "already anonymized",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				u := &User{ID: 7, Email: "deleted-7@anonymized.invalid"}
+
+				mock.ExpectBegin()
+				mock.ExpectExec(userQuery).WithArgs("deleted-7@anonymized.invalid", 7).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := st.AnonymizeUser(context.Background(), u)
+				require.ErrorIs(t, err, sql.ErrNoRows)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func (s *MySQLStore) CreateEmailVerification(ctx context.Context, v *EmailVerification) error {
+	query := `
+		INSERT INTO email_verifications (token_hash, user_id, expires_at)
+		VALUES (:token_hash, :user_id, :expires_at)
+	`
+	if _, err := s.db.NamedExecContext(ctx, query, v); err != nil {
+		return fmt.Errorf("error inserting email verification: %w", err)
+	}
+
+	return nil
+}
+
+func (s *MySQLStore) GetLatestEmailVerification(ctx context.Context, userID int64) (*EmailVerification, error) {
+	var v EmailVerification
+	query := "SELECT * FROM email_verifications WHERE user_id=? ORDER BY created_at DESC LIMIT 1"
+	if err := s.db.GetContext(ctx, &v, query, userID); err != nil {
+		return nil, fmt.Errorf("error getting email verification: %w", err)
+	}
+
+	return &v, nil
+}
+
+// ConsumeEmailVerification marks the token as used and the owner's email as
+// verified, returning the user ID. A token can only be consumed once.
+func (s *MySQLStore) ConsumeEmailVerification(ctx context.Context, tokenHash string) (int64, error) {
+	var userID int64
+	err := s.execTx(ctx, func(tx *sqlx.Tx) error {
+		var v EmailVerification
+		query := "SELECT * FROM email_verifications WHERE token_hash=? FOR UPDATE"
+		if err := tx.GetContext(ctx, &v, query, tokenHash); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrInvalidToken
+			}
+			return fmt.Errorf("error getting email verification: %w", err)
+		}
+
+		if v.UsedAt != nil {
+			return ErrInvalidToken
+		}
+		if time.Now().After(v.ExpiresAt) {
+			return ErrTokenExpired
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE email_verifications SET used_at=NOW() WHERE token_hash=?", tokenHash); err != nil {
+			return fmt.Errorf("error using email verification: %w", err)
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET email_verified_at=NOW() WHERE id=? AND email_verified_at IS NULL", v.UserID); err != nil {
+			return fmt.Errorf("error verifying email: %w", err)
+		}
+		userID = v.UserID
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error consuming email verification: %w", err)
+	}
+
+	return userID, nil
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+var verificationColumns = []string{"token_hash", "user_id", "expires_at", "used_at", "created_at"}
+
+func TestConsumeEmailVerification(t *testing.T) {
+	selectQuery := "SELECT * FROM email_verifications WHERE token_hash=? FOR UPDATE"
+	useQuery := "UPDATE email_verifications SET used_at=NOW() WHERE token_hash=?"
+	verifyQuery := "UPDATE users SET email_verified_at=NOW() WHERE id=? AND email_verified_at IS NULL"
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows(verificationColumns).AddRow("hash", 2, time.Now().Add(time.Hour), nil, time.Now()))
+				mock.ExpectExec(useQuery).WithArgs("hash").WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(verifyQuery).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				userID, err := st.ConsumeEmailVerification(context.Background(), "hash")
+				require.NoError(t, err)
+				require.Equal(t, int64(2), userID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "already used",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows(verificationColumns).AddRow("hash", 2, time.Now().Add(time.Hour), time.Now(), time.Now()))
+				mock.ExpectRollback()
+
+				_, err := st.ConsumeEmailVerification(context.Background(), "hash")
+				require.ErrorIs(t, err, ErrInvalidToken)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "expired",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs("hash").
+					WillReturnRows(sqlmock.NewRows(verificationColumns).AddRow("hash", 2, time.Now().Add(-time.Minute), nil, time.Now().Add(-25*time.Hour)))
+				mock.ExpectRollback()
+
+				_, err := st.ConsumeEmailVerification(context.Background(), "hash")
+				require.ErrorIs(t, err, ErrTokenExpired)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "unknown token",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(selectQuery).WithArgs("hash").WillReturnError(sql.ErrNoRows)
+				mock.ExpectRollback()
+
+				_, err := st.ConsumeEmailVerification(context.Background(), "hash")
+				require.ErrorIs(t, err, ErrInvalidToken)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+// The resend throttle waits on the latest verification sent to the user.
+func TestGetLatestEmailVerification(t *testing.T) {
+	query := "SELECT * FROM email_verifications WHERE user_id=? ORDER BY created_at DESC LIMIT 1"
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "sent recently",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				sentAt := time.Now().Add(-10 * time.Second)
+				mock.ExpectQuery(query).WithArgs(2).
+					WillReturnRows(sqlmock.NewRows(verificationColumns).AddRow("hash", 2, sentAt.Add(24*time.Hour), nil, sentAt))
+
+				v, err := st.GetLatestEmailVerification(context.Background(), 2)
+				require.NoError(t, err)
+				require.Equal(t, sentAt, v.CreatedAt)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "never sent",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).WithArgs(2).WillReturnRows(sqlmock.NewRows(verificationColumns))
+
+				_, err := st.GetLatestEmailVerification(context.Background(), 2)
+				require.ErrorIs(t, err, sql.ErrNoRows)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewMySQLStore(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// CreateWebhookEvent records e unless the provider already sent an event
+// with the same ID, in which case the recorded event is returned instead.
+func (s *MySQLStore) CreateWebhookEvent(ctx context.Context, e *WebhookEvent) (*WebhookEvent, error) {
+	query := `
+		INSERT INTO webhook_events (provider, event_id, type, reference, amount, payload, status)
+		VALUES (:provider, :event_id, :type, :reference, :amount, :payload, :status)
+		ON DUPLICATE KEY UPDATE id=id
+	`
+	res, err := s.db.NamedExecContext(ctx, query, e)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting webhook event: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if n == 0 {
+		var existing WebhookEvent
+		query := "SELECT * FROM webhook_events WHERE provider=? AND event_id=?"
+		if err := s.db.GetContext(ctx, &existing, query, e.Provider, e.EventID); err != nil {
+			return nil, fmt.Errorf("error getting webhook event: %w", err)
+		}
+		return &existing, nil
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("error getting last insert id: %w", err)
+	}
+	e.ID = id
+
+	return e, nil
+}
+
+func (s *MySQLStore) GetWebhookEvent(ctx context.Context, id int64) (*WebhookEvent, error) {
+	var e WebhookEvent
+	if err := s.db.GetContext(ctx, &e, "SELECT * FROM webhook_events WHERE id=?", id); err != nil {
+		return nil, fmt.Errorf("error getting webhook event: %w", err)
+	}
+
+	return &e, nil
+}
+
+// ListWebhookEvents returns events newest first, optionally only those with
+// the given status.
+func (s *MySQLStore) ListWebhookEvents(ctx context.Context, status string, limit, offset int) ([]WebhookEvent, error) {
+	var events []WebhookEvent
+	query := "SELECT * FROM webhook_events ORDER BY id DESC LIMIT ? OFFSET ?"
+	args := []any{limit, offset}
+	if status != "" {
+		query = "SELECT * FROM webhook_events WHERE status=? ORDER BY id DESC LIMIT ? OFFSET ?"
+		args = append([]any{status}, args...)
+	}
+	if err := s.db.SelectContext(ctx, &events, query, args...); err != nil {
+		return nil, fmt.Errorf("error listing webhook events: %w", err)
+	}
+
+	return events, nil
+}
+
+// ClaimWebhookEvent marks e as being processed, so concurrent deliveries or
+// replays of it aren't applied twice. It returns ErrConflict if e is being
+// or was processed already.
+func (s *MySQLStore) ClaimWebhookEvent(ctx context.Context, e *WebhookEvent) error {
+	query := "UPDATE webhook_events SET status=? WHERE id=? AND status IN (?, ?)"
+	res, err := s.db.ExecContext(ctx, query, WebhookProcessing, e.ID, WebhookReceived, WebhookFailed)
+	if err != nil {
+		return fmt.Errorf("error claiming webhook event: %w", err)
+	}
+	if err := checkVersionedUpdate(res); err != nil {
+		return err
+	}
+	e.Status = WebhookProcessing
+
+	return nil
+}
+
+// UpdateWebhookEvent saves the outcome of processing e.
+func (s *MySQLStore) UpdateWebhookEvent(ctx context.Context, e *WebhookEvent) error {
+	query := "UPDATE webhook_events SET status=:status, error=:error, attempts=:attempts, processed_at=:processed_at WHERE id=:id"
+	if _, err := s.db.NamedExecContext(ctx, query, e); err != nil {
+		return fmt.Errorf("error updating webhook event: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateWebhookEvent(t *testing.T) {
+	insertQuery := `
+		INSERT INTO webhook_events (provider, event_id, type, reference, amount, payload, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE id=id
+	`
+	newEvent := func() *WebhookEvent {
+		return &WebhookEvent{
+			Provider:  "fake",
+			EventID:   "evt_1",
+			Type:      "payment.captured",
+			Reference: "fake_auth_1",
+			Amount:    100,
+			Payload:   "{}",
+			Status:    WebhookReceived,
+		}
+	}
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "new event",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(insertQuery).WithArgs("fake", "evt_1", "payment.captured", "fake_auth_1", 100.0, "{}", WebhookReceived).WillReturnResult(sqlmock.NewResult(4, 1))
+
+				e, err := st.CreateWebhookEvent(context.Background(), newEvent())
+				require.NoError(t, err)
+				require.Equal(t, int64(4), e.ID)
+				require.Equal(t, WebhookReceived, e.Status)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "repeated delivery",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				columns := []string{"id", "provider", "event_id", "type", "reference", "amount", "payload", "status", "error", "attempts", "created_at", "processed_at"}
+
+				mock.ExpectExec(insertQuery).WithArgs("fake", "evt_1", "payment.captured", "fake_auth_1", 100.0, "{}", WebhookReceived).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT * FROM webhook_events WHERE provider=? AND event_id=?").WithArgs("fake", "evt_1").
+					WillReturnRows(sqlmock.NewRows(columns).AddRow(3, "fake", "evt_1", "payment.captured", "fake_auth_1", 100, "{}", WebhookProcessed, "", 1, time.Now(), time.Now()))
+
+				e, err := st.CreateWebhookEvent(context.Background(), newEvent())
+				require.NoError(t, err)
+				require.Equal(t, int64(3), e.ID)
+				require.Equal(t, WebhookProcessed, e.Status)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewMySQLStore(db)
+			tc.test(t, st, mock)
+		})
+	}
+}
+
+func TestClaimWebhookEvent(t *testing.T) {
+	query := "UPDATE webhook_events SET status=? WHERE id=? AND status IN (?, ?)"
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *MySQLStore, sqlmock.Sqlmock)
+	}{
+		{
+			name: "claimed",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs(WebhookProcessing, 4, WebhookReceived, WebhookFailed).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				e := &WebhookEvent{ID: 4, Status: WebhookReceived}
+				err := st.ClaimWebhookEvent(context.Background(), e)
+				require.NoError(t, err)
+				require.Equal(t, WebhookProcessing, e.Status)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "claimed by another request",
+			test: func(t *testing.T, st *MySQLStore, mock sqlmock.Sqlmock) {
+				mock.ExpectExec(query).WithArgs(WebhookProcessing, 4, WebhookReceived, WebhookFailed).WillReturnResult(sqlmock.NewResult(0, 0))
+
+				e := &WebhookEvent{ID: 4, Status: WebhookReceived}
+				err := st.ClaimWebhookEvent(context.Background(), e)
+				require.ErrorIs(t, err, ErrConflict)
+				require.Equal(t, WebhookReceived, e.Status)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewMySQLStore(db)
+			tc.test(t, st, mock)
+		})
+	}
+}
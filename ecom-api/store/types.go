@@ -14,18 +14,56 @@ type Product struct {
 	CountInStock int64      `db:"count_in_stock"`
 	CreatedAt    time.Time  `db:"created_at"`
 	UpdatedAt    *time.Time `db:"updated_at"`
+	// Version is bumped on every update so stale writes can be detected.
+	Version   int64      `db:"version"`
+	DeletedAt *time.Time `db:"deleted_at"`
+	// The packed size and weight, used to price shipping.
+	WeightGrams int64 `db:"weight_grams"`
+	LengthMM    int64 `db:"length_mm"`
+	WidthMM     int64 `db:"width_mm"`
+	HeightMM    int64 `db:"height_mm"`
+	// TaxCategory picks the tax rules that apply, e.g. "food". Empty uses
+	// the standard rate.
+	TaxCategory string `db:"tax_category"`
 }
 
+const (
+	OrderPending           = "pending"
+	OrderPaid              = "paid"
+	OrderPartiallyRefunded = "partially_refunded"
+	OrderRefunded          = "refunded"
+)
+
 type Order struct {
-	ID            int64      `db:"id"`
-	PaymentMethod string     `db:"payment_method"`
-	TaxPrice      float32    `db:"tax_price"`
-	ShippingPrice float32    `db:"shipping_price"`
-	TotalPrice    float32    `db:"total_price"`
-	UserID        int64     `db:"user_id"`
+	ID int64 `db:"id"`
+	// PaymentMethod is the name of the payment provider the order is paid
+	// through.
+	PaymentMethod string  `db:"payment_method"`
+	TaxPrice      float32 `db:"tax_price"`
+	ShippingPrice float32 `db:"shipping_price"`
+	TotalPrice    float32 `db:"total_price"`
+	// ShippingMethod is the code of the shipping method that was priced.
+	ShippingMethod string `db:"shipping_method"`
+	// CouponCode is the discount code the order was placed with, if any,
+	// and DiscountPrice what it took off the total.
+	CouponCode    string     `db:"coupon_code"`
+	DiscountPrice float32    `db:"discount_price"`
+	UserID        int64      `db:"user_id"`
+	Status        string     `db:"status"`
+	PaidAt        *time.Time `db:"paid_at"`
+	// RefundedPrice is the total refunded so far.
+	RefundedPrice float64    `db:"refunded_price"`
 	CreatedAt     time.Time  `db:"created_at"`
 	UpdatedAt     *time.Time `db:"updated_at"`
+	DeletedAt     *time.Time `db:"deleted_at"`
 	Items         []OrderItem
+	// ShippingAddress and BillingAddress are copies of the addresses as
+	// they were when the order was placed.
+	ShippingAddress *OrderAddress
+	BillingAddress  *OrderAddress
+	// Coupon is redeemed when the order is created. It is not loaded when
+	// reading orders back.
+	Coupon *Coupon
 }
 
 type OrderItem struct {
@@ -36,23 +74,274 @@ type OrderItem struct {
 	Price     float64 `db:"price"`
 	ProductID int64   `db:"product_id"`
 	OrderID   int64   `db:"order_id"`
+	// The tax charged on the line, as worked out when the order was placed.
+	TaxCategory  string  `db:"tax_category"`
+	TaxName      string  `db:"tax_name"`
+	TaxRate      float64 `db:"tax_rate"`
+	TaxInclusive bool    `db:"tax_inclusive"`
+	NetAmount    float64 `db:"net_amount"`
+	TaxAmount    float64 `db:"tax_amount"`
+	// DiscountAmount is the line's share of the coupon discount. NetAmount
+	// and TaxAmount are worked out after it is taken off.
+	DiscountAmount float64 `db:"discount_amount"`
+	// RefundedQuantity is how many units were returned and refunded.
+	RefundedQuantity int64 `db:"refunded_quantity"`
 }
 
-type User struct {
-	ID        int64      `db:"id"`
-	Name      string     `db:"name"`
-	Email     string     `db:"email"`
-	Password  string     `db:"password"`
-	IsAdmin   bool       `db:"is_admin"`
+// PostalAddress is the part of an address a parcel or invoice is sent to.
+type PostalAddress struct {
+	Name       string `db:"name"`
+	Line1      string `db:"line1"`
+	Line2      string `db:"line2"`
+	City       string `db:"city"`
+	State      string `db:"state"`
+	PostalCode string `db:"postal_code"`
+	// Country is an ISO 3166-1 alpha-2 code.
+	Country string `db:"country"`
+	Phone   string `db:"phone"`
+}
+
+// Address is an entry in a user's address book.
+type Address struct {
+	ID     int64 `db:"id"`
+	UserID int64 `db:"user_id"`
+	PostalAddress
+	IsDefault bool       `db:"is_default"`
 	CreatedAt time.Time  `db:"created_at"`
 	UpdatedAt *time.Time `db:"updated_at"`
 }
 
-type Session struct {
-	ID           string    `db:"id"`
-	UserEmail    string    `db:"user_email"`
-	RefreshToken string    `db:"refresh_token"`
-	IsRevoked    bool      `db:"is_revoked"`
+const (
+	OrderAddressShipping = "shipping"
+	OrderAddressBilling  = "billing"
+)
+
+type OrderAddress struct {
+	ID      int64  `db:"id"`
+	OrderID int64  `db:"order_id"`
+	Kind    string `db:"kind"`
+	PostalAddress
+}
+
+const (
+	PaymentPending    = "pending"
+	PaymentAuthorized = "authorized"
+	PaymentCaptured   = "captured"
+	PaymentVoided     = "voided"
+	PaymentFailed     = "failed"
+)
+
+// Payment is one attempt to pay an order through a payment provider.
+type Payment struct {
+	ID       int64  `db:"id"`
+	OrderID  int64  `db:"order_id"`
+	Provider string `db:"provider"`
+	// Reference is the provider's ID for the authorization.
+	Reference string  `db:"reference"`
+	Status    string  `db:"status"`
+	Amount    float64 `db:"amount"`
+	// Error says why the attempt failed.
+	Error     string     `db:"error"`
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt *time.Time `db:"updated_at"`
+}
+
+const (
+	RefundPending   = "pending"
+	RefundCompleted = "completed"
+	RefundFailed    = "failed"
+)
+
+// Refund gives back part or all of what was paid for an order. Items are
+// the order lines returned with it, if any.
+type Refund struct {
+	ID        int64   `db:"id"`
+	OrderID   int64   `db:"order_id"`
+	PaymentID int64   `db:"payment_id"`
+	Amount    float64 `db:"amount"`
+	Reason    string  `db:"reason"`
+	// Reference is the payment provider's ID for the refund.
+	Reference string `db:"reference"`
+	// Status is pending while the provider is being asked for the refund.
+	Status string `db:"status"`
+	// Restock means the returned quantities were put back in stock.
+	Restock   bool      `db:"restock"`
+	CreatedBy int64     `db:"created_by"`
+	CreatedAt time.Time `db:"created_at"`
+	Items     []RefundItem
+}
+
+type RefundItem struct {
+	ID          int64   `db:"id"`
+	RefundID    int64   `db:"refund_id"`
+	OrderItemID int64   `db:"order_item_id"`
+	ProductID   int64   `db:"product_id"`
+	Quantity    int64   `db:"quantity"`
+	Amount      float64 `db:"amount"`
+}
+
+const (
+	WebhookReceived = "received"
+	// WebhookProcessing marks an event claimed by the request applying it.
+	WebhookProcessing = "processing"
+	WebhookProcessed  = "processed"
+	WebhookFailed     = "failed"
+)
+
+// WebhookEvent is a payment event reported by a provider. EventID is the
+// provider's ID for it.
+type WebhookEvent struct {
+	ID        int64   `db:"id"`
+	Provider  string  `db:"provider"`
+	EventID   string  `db:"event_id"`
+	Type      string  `db:"type"`
+	Reference string  `db:"reference"`
+	Amount    float64 `db:"amount"`
+	// Payload is the request body as received.
+	Payload     string     `db:"payload"`
+	Status      string     `db:"status"`
+	Error       string     `db:"error"`
+	Attempts    int64      `db:"attempts"`
+	CreatedAt   time.Time  `db:"created_at"`
+	ProcessedAt *time.Time `db:"processed_at"`
+}
+
+const (
+	CouponPercentage   = "percentage"
+	CouponFixed        = "fixed"
+	CouponFreeShipping = "free_shipping"
+)
+
+// Coupon is a discount code. Nil limits and dates mean no limit.
+type Coupon struct {
+	ID   int64  `db:"id"`
+	Code string `db:"code"`
+	Type string `db:"type"`
+	// Value is the percentage taken off for CouponPercentage and the amount
+	// taken off for CouponFixed.
+	Value          float64    `db:"value"`
+	MinOrderValue  float64    `db:"min_order_value"`
+	MaxUses        *int64     `db:"max_uses"`
+	MaxUsesPerUser *int64     `db:"max_uses_per_user"`
+	TimesUsed      int64      `db:"times_used"`
+	StartsAt       *time.Time `db:"starts_at"`
+	EndsAt         *time.Time `db:"ends_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      *time.Time `db:"updated_at"`
+	// ProductIDs and Categories limit the discount to matching items. When
+	// both are empty it applies to the whole order.
+	ProductIDs []int64
+	Categories []string
+}
+
+// IdempotencyKey is a request a user sent with an Idempotency-Key header and
+// the response it got. StatusCode is 0 while the request is being handled.
+type IdempotencyKey struct {
+	ID     int64  `db:"id"`
+	UserID int64  `db:"user_id"`
+	Key    string `db:"idem_key"`
+	Method string `db:"method"`
+	Path   string `db:"path"`
+	// RequestHash is the SHA-256 of the request body, in hex.
+	RequestHash  string    `db:"request_hash"`
+	StatusCode   int       `db:"status_code"`
+	ResponseBody string    `db:"response_body"`
 	CreatedAt    time.Time `db:"created_at"`
 	ExpiresAt    time.Time `db:"expires_at"`
 }
+
+type User struct {
+	ID              int64      `db:"id"`
+	Name            string     `db:"name"`
+	Email           string     `db:"email"`
+	Password        string     `db:"password"`
+	CreatedAt       time.Time  `db:"created_at"`
+	UpdatedAt       *time.Time `db:"updated_at"`
+	EmailVerifiedAt *time.Time `db:"email_verified_at"`
+	Phone           *string    `db:"phone"`
+	DefaultAddress  *string    `db:"default_address"`
+	// Version is bumped on every update so stale writes can be detected.
+	Version   int64      `db:"version"`
+	DeletedAt *time.Time `db:"deleted_at"`
+	// AnonymizedAt is set once the user's personal data was erased at their
+	// request. Such accounts cannot be restored.
+	AnonymizedAt *time.Time `db:"anonymized_at"`
+}
+
+// ListUsersParams filters and pages ListUsers. Query matches part of a
+// user's name or email.
+type ListUsersParams struct {
+	Query          string
+	Limit          int
+	Offset         int
+	IncludeDeleted bool
+}
+
+type Session struct {
+	ID        string `db:"id"`
+	UserEmail string `db:"user_email"`
+	// RefreshTokenHash is the SHA-256 of the session's refresh token.
+	RefreshTokenHash string     `db:"refresh_token"`
+	IsRevoked        bool       `db:"is_revoked"`
+	CreatedAt        time.Time  `db:"created_at"`
+	ExpiresAt        time.Time  `db:"expires_at"`
+	UserAgent        string     `db:"user_agent"`
+	ClientIP         string     `db:"client_ip"`
+	RevokedAt        *time.Time `db:"revoked_at"`
+}
+
+const (
+	AuditRoleGranted = "role_granted"
+	AuditRoleRevoked = "role_revoked"
+)
+
+type PrivilegeAudit struct {
+	ID           int64     `db:"id"`
+	ActorUserID  int64     `db:"actor_user_id"`
+	TargetUserID int64     `db:"target_user_id"`
+	Action       string    `db:"action"`
+	Role         string    `db:"role"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+type EmailVerification struct {
+	TokenHash string     `db:"token_hash"`
+	UserID    int64      `db:"user_id"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+type PasswordReset struct {
+	TokenHash string     `db:"token_hash"`
+	UserID    int64      `db:"user_id"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
+
+type UserMFA struct {
+	UserID         int64      `db:"user_id"`
+	Secret         string     `db:"secret"`
+	ConfirmedAt    *time.Time `db:"confirmed_at"`
+	LastUsedStep   int64      `db:"last_used_step"`
+	FailedAttempts int64      `db:"failed_attempts"`
+	LockedUntil    *time.Time `db:"locked_until"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
+
+// Enabled reports whether enrolment was confirmed with a valid code.
+func (m *UserMFA) Enabled() bool {
+	return m.ConfirmedAt != nil
+}
+
+// UserIdentity links a user to their account at an external OpenID Connect
+// provider.
+type UserIdentity struct {
+	ID        int64     `db:"id"`
+	UserID    int64     `db:"user_id"`
+	Provider  string    `db:"provider"`
+	Subject   string    `db:"subject"`
+	Email     string    `db:"email"`
+	CreatedAt time.Time `db:"created_at"`
+}
@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+)
+
+const IdempotencyPurgeName = "idempotency_purge"
+
+// NewIdempotencyPurge returns a job that deletes expired idempotency keys,
+// batchSize rows at a time.
+func NewIdempotencyPurge(st *store.MySQLStore, batchSize int) JobFunc {
+	return func(ctx context.Context) (int64, error) {
+		now := time.Now()
+
+		var total int64
+		for {
+			n, err := st.PurgeIdempotencyKeys(ctx, now, batchSize)
+			total += n
+			if err != nil {
+				return total, err
+			}
+			if n < int64(batchSize) {
+				return total, nil
+			}
+
+			if err := ctx.Err(); err != nil {
+				return total, err
+			}
+		}
+	}
+}
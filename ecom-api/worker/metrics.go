@@ -0,0 +1,7 @@
+package worker
+
+import "expvar"
+
+// metrics counts runs, skipped rounds, errors and affected rows per job,
+// e.g. "session_gc.rows". They are published through expvar.
+var metrics = expvar.NewMap("worker")
@@ -0,0 +1,35 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+)
+
+const SessionGCName = "session_gc"
+
+// NewSessionGC returns a job that deletes expired sessions and sessions
+// revoked more than retention ago, batchSize rows at a time so a large
+// backlog doesn't hold locks on the sessions table for long.
+func NewSessionGC(st *store.MySQLStore, retention time.Duration, batchSize int) JobFunc {
+	return func(ctx context.Context) (int64, error) {
+		now := time.Now()
+
+		var total int64
+		for {
+			n, err := st.PurgeSessions(ctx, now, now.Add(-retention), batchSize)
+			total += n
+			if err != nil {
+				return total, err
+			}
+			if n < int64(batchSize) {
+				return total, nil
+			}
+
+			if err := ctx.Err(); err != nil {
+				return total, err
+			}
+		}
+	}
+}
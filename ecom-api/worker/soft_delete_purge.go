@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/ecom-api/store"
+)
+
+const SoftDeletePurgeName = "soft_delete_purge"
+
+// NewSoftDeletePurge returns a job that permanently removes orders, products
+// and users soft deleted more than retention ago. Orders go first so the
+// products and users they held on to can be purged in the same round.
+func NewSoftDeletePurge(st *store.MySQLStore, retention time.Duration, batchSize int) JobFunc {
+	purges := []func(context.Context, time.Time, int) (int64, error){
+		st.PurgeDeletedOrders,
+		st.PurgeDeletedProducts,
+		st.PurgeDeletedUsers,
+	}
+
+	return func(ctx context.Context) (int64, error) {
+		cutoff := time.Now().Add(-retention)
+
+		var total int64
+		for _, purge := range purges {
+			for {
+				n, err := purge(ctx, cutoff, batchSize)
+				total += n
+				if err != nil {
+					return total, err
+				}
+				if n < int64(batchSize) {
+					break
+				}
+
+				if err := ctx.Err(); err != nil {
+					return total, err
+				}
+			}
+		}
+
+		return total, nil
+	}
+}
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Locker serialises a job across replicas. *store.MySQLStore implements it
+// with MySQL advisory locks.
+type Locker interface {
+	WithLock(ctx context.Context, name string, fn func(context.Context) error) (bool, error)
+}
+
+// JobFunc does one round of work and reports how many rows it affected.
+type JobFunc func(ctx context.Context) (int64, error)
+
+// Periodic runs a job every interval. Each round first takes a lock named
+// after the job, so when several replicas run the same schedule only the one
+// that gets the lock does the work and the others skip that round.
+type Periodic struct {
+	name     string
+	interval time.Duration
+	locker   Locker
+	job      JobFunc
+}
+
+func NewPeriodic(name string, interval time.Duration, locker Locker, job JobFunc) *Periodic {
+	return &Periodic{
+		name:     name,
+		interval: interval,
+		locker:   locker,
+		job:      job,
+	}
+}
+
+// Run blocks until ctx is cancelled, running the job once at start and then
+// on every tick.
+func (p *Periodic) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Periodic) runOnce(ctx context.Context) {
+	var affected int64
+	acquired, err := p.locker.WithLock(ctx, lockPrefix+p.name, func(ctx context.Context) error {
+		n, err := p.job(ctx)
+		affected = n
+		return err
+	})
+	if err != nil {
+		metrics.Add(p.name+".errors", 1)
+		log.Printf("worker %s: %v", p.name, err)
+	}
+	if !acquired {
+		metrics.Add(p.name+".skipped", 1)
+		return
+	}
+
+	metrics.Add(p.name+".runs", 1)
+	metrics.Add(p.name+".rows", affected)
+}
+
+const lockPrefix = "ecom-api:"
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLocker struct {
+	held bool
+}
+
+func (l *fakeLocker) WithLock(ctx context.Context, name string, fn func(context.Context) error) (bool, error) {
+	if l.held {
+		return false, nil
+	}
+	return true, fn(ctx)
+}
+
+func TestPeriodicRunOnce(t *testing.T) {
+	tcs := []struct {
+		name    string
+		held    bool
+		err     error
+		runs    int64
+		skipped int64
+		errors  int64
+		rows    int64
+	}{
+		{name: "success", runs: 1, rows: 5},
+		{name: "lock held by another replica", held: true, skipped: 1},
+		{name: "job failed", err: fmt.Errorf("error purging"), runs: 1, errors: 1, rows: 5},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			name := "test_" + tc.name
+			called := false
+			p := NewPeriodic(name, time.Minute, &fakeLocker{held: tc.held}, func(ctx context.Context) (int64, error) {
+				called = true
+				return 5, tc.err
+			})
+
+			p.runOnce(context.Background())
+
+			require.Equal(t, !tc.held, called)
+			require.Equal(t, tc.runs, counter(name+".runs"))
+			require.Equal(t, tc.skipped, counter(name+".skipped"))
+			require.Equal(t, tc.errors, counter(name+".errors"))
+			require.Equal(t, tc.rows, counter(name+".rows"))
+		})
+	}
+}
+
+func counter(key string) int64 {
+	v := metrics.Get(key)
+	if v == nil {
+		return 0
+	}
+	return v.(interface{ Value() int64 }).Value()
+}
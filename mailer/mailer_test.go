@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutboxMailer(t *testing.T) {
+	tcs := []struct {
+		name string
+		test func(*testing.T, *OutboxMailer, string)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T, m *OutboxMailer, path string) {
+				err := m.Send(context.Background(), Message{To: "test@example.com", Subject: "Hello", Body: "line 1\nline 2"})
+				require.NoError(t, err)
+
+				data, err := os.ReadFile(path)
+				require.NoError(t, err)
+				require.Contains(t, string(data), "To: test@example.com\r\n")
+				require.Contains(t, string(data), "Subject: Hello\r\n")
+				require.Contains(t, string(data), "line 1\r\nline 2")
+			},
+		},
+		{
+			name: "header injection",
+			test: func(t *testing.T, m *OutboxMailer, path string) {
+				err := m.Send(context.Background(), Message{To: "test@example.com\r\nBcc: other@example.com", Subject: "Hello"})
+				require.ErrorIs(t, err, ErrInvalidHeader)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "outbox.eml")
+			tc.test(t, NewOutboxMailer(path, "no-reply@example.com"), path)
+		})
+	}
+}
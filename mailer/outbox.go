@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// OutboxMailer doesn't deliver anything. It appends each message to a file,
+// or logs it when no path is set, so links can be picked up in local runs.
+type OutboxMailer struct {
+	mu   sync.Mutex
+	path string
+	from string
+}
+
+func NewOutboxMailer(path, from string) *OutboxMailer {
+	return &OutboxMailer{path: path, from: from}
+}
+
+func (m *OutboxMailer) Send(ctx context.Context, msg Message) error {
+	data, err := format(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	if m.path == "" {
+		log.Printf("outbox mail:\n%s", data)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening outbox: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "%s\r\n", data); err != nil {
+		return fmt.Errorf("error writing outbox: %w", err)
+	}
+
+	return nil
+}
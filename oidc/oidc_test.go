@@ -0,0 +1,151 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/codepnw/microservice-ecommerce/oidc"
+	"github.com/codepnw/microservice-ecommerce/oidc/oidctest"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURL = "http://localhost:8080/auth/oidc/test/callback"
+
+func TestLogin(t *testing.T) {
+	mock, err := oidctest.NewProvider("test-client", "test-secret")
+	require.NoError(t, err)
+	defer mock.Close()
+
+	ctx := context.Background()
+	newProvider := func(t *testing.T, clientID, clientSecret string) *oidc.Provider {
+		p, err := oidc.NewProvider(ctx, oidc.Config{
+			Name:         "test",
+			Issuer:       mock.Issuer(),
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+		})
+		require.NoError(t, err)
+		return p
+	}
+	provider := newProvider(t, "test-client", "test-secret")
+
+	tcs := []struct {
+		name string
+		test func(*testing.T)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T) {
+				code, verifier := authorize(t, provider, "state-1", "nonce-1")
+
+				tokens, err := provider.Exchange(ctx, code, verifier)
+				require.NoError(t, err)
+
+				claims, err := provider.VerifyIDToken(ctx, tokens.IDToken, "nonce-1")
+				require.NoError(t, err)
+				require.Equal(t, "oidctest-user", claims.Subject)
+				require.Equal(t, "oidc@example.com", claims.Email)
+				require.True(t, claims.EmailVerified)
+			},
+		},
+		{
+			name: "wrong code verifier",
+			test: func(t *testing.T) {
+				code, _ := authorize(t, provider, "state-2", "nonce-2")
+
+				_, err := provider.Exchange(ctx, code, "not-the-verifier")
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "code used twice",
+			test: func(t *testing.T) {
+				code, verifier := authorize(t, provider, "state-3", "nonce-3")
+
+				_, err := provider.Exchange(ctx, code, verifier)
+				require.NoError(t, err)
+
+				_, err = provider.Exchange(ctx, code, verifier)
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "wrong nonce",
+			test: func(t *testing.T) {
+				code, verifier := authorize(t, provider, "state-4", "nonce-4")
+
+				tokens, err := provider.Exchange(ctx, code, verifier)
+				require.NoError(t, err)
+
+				_, err = provider.VerifyIDToken(ctx, tokens.IDToken, "other-nonce")
+				require.ErrorIs(t, err, oidc.ErrNonceMismatch)
+			},
+		},
+		{
+			name: "token for another client",
+			test: func(t *testing.T) {
+				code, verifier := authorize(t, provider, "state-5", "nonce-5")
+
+				tokens, err := provider.Exchange(ctx, code, verifier)
+				require.NoError(t, err)
+
+				other := newProvider(t, "other-client", "test-secret")
+				_, err = other.VerifyIDToken(ctx, tokens.IDToken, "nonce-5")
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "wrong client secret",
+			test: func(t *testing.T) {
+				code, verifier := authorize(t, provider, "state-6", "nonce-6")
+
+				other := newProvider(t, "test-client", "wrong-secret")
+				_, err := other.Exchange(ctx, code, verifier)
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, tc.test)
+	}
+}
+
+func TestNewProviderIssuerMismatch(t *testing.T) {
+	mock, err := oidctest.NewProvider("test-client", "test-secret")
+	require.NoError(t, err)
+	defer mock.Close()
+
+	_, err = oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:   mock.Issuer() + "/",
+		ClientID: "test-client",
+	})
+	require.ErrorIs(t, err, oidc.ErrIssuerMismatch)
+}
+
+// authorize follows the provider's authorization redirect and returns the
+// code it sends back along with the PKCE verifier used.
+func authorize(t *testing.T, p *oidc.Provider, state, nonce string) (code, verifier string) {
+	verifier, err := oidc.RandomString()
+	require.NoError(t, err)
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	res, err := client.Get(p.AuthCodeURL(state, nonce, oidc.CodeChallenge(verifier)))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusFound, res.StatusCode)
+
+	location, err := url.Parse(res.Header.Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, state, location.Query().Get("state"))
+
+	return location.Query().Get("code"), verifier
+}
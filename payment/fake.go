@@ -0,0 +1,154 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Tokens that make the fake provider fail. Any other token succeeds.
+const (
+	FakeTokenDeclined        = "tok_declined"
+	FakeTokenCaptureDeclined = "tok_capture_declined"
+)
+
+// Fake is an in-process provider for development and tests. It never
+// talks to a network and its outcome depends only on the token, so
+// checkouts can be run offline and repeatably. Its webhooks are Event
+// encoded as JSON and signed with the webhook secret.
+type Fake struct {
+	webhookSecret string
+
+	mu             sync.Mutex
+	next           int
+	authorizations map[string]*fakeAuthorization
+}
+
+type fakeAuthorization struct {
+	token    string
+	amount   float64
+	captured float64
+	refunded float64
+	voided   bool
+}
+
+// NewFake returns a fake provider whose webhooks are signed with
+// webhookSecret. Without a secret every webhook is rejected.
+func NewFake(webhookSecret string) *Fake {
+	return &Fake{
+		webhookSecret:  webhookSecret,
+		authorizations: make(map[string]*fakeAuthorization),
+	}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Authorize(_ context.Context, req AuthorizeRequest) (string, error) {
+	if req.Token == FakeTokenDeclined {
+		return "", ErrDeclined
+	}
+	if req.Amount <= 0 {
+		return "", fmt.Errorf("invalid amount %.2f", req.Amount)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ref := f.reference("auth")
+	f.authorizations[ref] = &fakeAuthorization{token: req.Token, amount: req.Amount}
+	return ref, nil
+}
+
+func (f *Fake) Capture(_ context.Context, reference string, amount float64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	a, err := f.get(reference)
+	if err != nil {
+		return err
+	}
+	if a.token == FakeTokenCaptureDeclined {
+		return ErrDeclined
+	}
+	if a.voided || a.captured > 0 {
+		return fmt.Errorf("%w: %s was already captured or voided", ErrInvalidState, reference)
+	}
+	if amount <= 0 || cents(amount) > cents(a.amount) {
+		return fmt.Errorf("%w: can't capture %.2f of %.2f", ErrInvalidState, amount, a.amount)
+	}
+
+	a.captured = amount
+	return nil
+}
+
+func (f *Fake) Refund(_ context.Context, reference string, amount float64) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	a, err := f.get(reference)
+	if err != nil {
+		return "", err
+	}
+	if amount <= 0 || cents(a.refunded+amount) > cents(a.captured) {
+		return "", fmt.Errorf("%w: can't refund %.2f of %.2f captured", ErrInvalidState, amount, a.captured-a.refunded)
+	}
+
+	a.refunded += amount
+	return f.reference("refund"), nil
+}
+
+func (f *Fake) Void(_ context.Context, reference string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	a, err := f.get(reference)
+	if err != nil {
+		return err
+	}
+	if a.captured > 0 {
+		return fmt.Errorf("%w: %s was already captured", ErrInvalidState, reference)
+	}
+
+	a.voided = true
+	return nil
+}
+
+func (f *Fake) ParseWebhook(header http.Header, body []byte) (Event, error) {
+	if err := VerifyWebhook(f.webhookSecret, header.Get(SignatureHeader), body, time.Now()); err != nil {
+		return Event{}, err
+	}
+
+	var ev Event
+	if err := json.Unmarshal(body, &ev); err != nil {
+		return Event{}, fmt.Errorf("error decoding webhook: %w", err)
+	}
+	if ev.ID == "" || ev.Reference == "" {
+		return Event{}, fmt.Errorf("webhook needs an id and a reference")
+	}
+
+	return ev, nil
+}
+
+func (f *Fake) get(reference string) (*fakeAuthorization, error) {
+	a, ok := f.authorizations[reference]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown reference %s", ErrInvalidState, reference)
+	}
+	return a, nil
+}
+
+// reference returns the next reference, numbered from 1.
+func (f *Fake) reference(kind string) string {
+	f.next++
+	return fmt.Sprintf("fake_%s_%d", kind, f.next)
+}
+
+func cents(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
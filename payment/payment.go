@@ -0,0 +1,55 @@
+// Package payment takes payments through payment gateways. Each gateway is
+// a Provider and the gateways a shop accepts are combined in Providers.
+//
+// A payment is first authorized, which reserves the amount, and then
+// captured, which takes it. An authorization that won't be captured is
+// voided; a captured payment is given back with a refund.
+package payment
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown payment provider")
+	// ErrDeclined is returned when the gateway refuses the payment, e.g.
+	// for insufficient funds.
+	ErrDeclined = errors.New("payment declined")
+	// ErrInvalidState is returned for an operation that doesn't fit the
+	// payment's state, such as capturing a voided authorization.
+	ErrInvalidState = errors.New("invalid payment state")
+)
+
+// AuthorizeRequest asks for Amount to be reserved for an order. Token is
+// the payment method collected by the client, e.g. a tokenized card.
+type AuthorizeRequest struct {
+	OrderID int64
+	Amount  float64
+	Token   string
+}
+
+// Provider is a payment gateway. References are the gateway's IDs for
+// authorizations and refunds.
+type Provider interface {
+	// Name is what orders pick the provider by.
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (reference string, err error)
+	Capture(ctx context.Context, reference string, amount float64) error
+	Refund(ctx context.Context, reference string, amount float64) (refundReference string, err error)
+	Void(ctx context.Context, reference string) error
+}
+
+// Providers are the payment gateways on offer. The first is the default.
+type Providers []Provider
+
+// Get returns the named provider. An empty name picks the default.
+func (p Providers) Get(name string) (Provider, error) {
+	for _, provider := range p {
+		if name == "" || provider.Name() == name {
+			return provider, nil
+		}
+	}
+
+	return nil, ErrUnknownProvider
+}
@@ -0,0 +1,87 @@
+package payment
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+
+	tcs := []struct {
+		name string
+		test func(*testing.T, *Fake)
+	}{
+		{
+			name: "capture and refund",
+			test: func(t *testing.T, f *Fake) {
+				ref, err := f.Authorize(ctx, AuthorizeRequest{OrderID: 1, Amount: 100, Token: "tok_visa"})
+				require.NoError(t, err)
+				require.Equal(t, "fake_auth_1", ref)
+
+				require.NoError(t, f.Capture(ctx, ref, 100))
+				require.ErrorIs(t, f.Void(ctx, ref), ErrInvalidState)
+
+				refundRef, err := f.Refund(ctx, ref, 60)
+				require.NoError(t, err)
+				require.Equal(t, "fake_refund_2", refundRef)
+
+				_, err = f.Refund(ctx, ref, 40.01)
+				require.ErrorIs(t, err, ErrInvalidState)
+			},
+		},
+		{
+			name: "declined",
+			test: func(t *testing.T, f *Fake) {
+				_, err := f.Authorize(ctx, AuthorizeRequest{OrderID: 1, Amount: 100, Token: FakeTokenDeclined})
+				require.ErrorIs(t, err, ErrDeclined)
+
+				ref, err := f.Authorize(ctx, AuthorizeRequest{OrderID: 1, Amount: 100, Token: FakeTokenCaptureDeclined})
+				require.NoError(t, err)
+				require.ErrorIs(t, f.Capture(ctx, ref, 100), ErrDeclined)
+				require.NoError(t, f.Void(ctx, ref))
+			},
+		},
+		{
+			name: "voided",
+			test: func(t *testing.T, f *Fake) {
+				ref, err := f.Authorize(ctx, AuthorizeRequest{OrderID: 1, Amount: 100, Token: "tok_visa"})
+				require.NoError(t, err)
+				require.NoError(t, f.Void(ctx, ref))
+				require.ErrorIs(t, f.Capture(ctx, ref, 100), ErrInvalidState)
+			},
+		},
+		{
+			name: "capture over authorized amount",
+			test: func(t *testing.T, f *Fake) {
+				ref, err := f.Authorize(ctx, AuthorizeRequest{OrderID: 1, Amount: 100, Token: "tok_visa"})
+				require.NoError(t, err)
+				require.ErrorIs(t, f.Capture(ctx, ref, 100.01), ErrInvalidState)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, NewFake(""))
+		})
+	}
+}
+
+func TestProviders(t *testing.T) {
+	fake := NewFake("")
+	providers := Providers{fake}
+
+	p, err := providers.Get("")
+	require.NoError(t, err)
+	require.Equal(t, fake, p)
+
+	p, err = providers.Get("fake")
+	require.NoError(t, err)
+	require.Equal(t, fake, p)
+
+	_, err = providers.Get("cash")
+	require.ErrorIs(t, err, ErrUnknownProvider)
+}
@@ -0,0 +1,57 @@
+package payment
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1","type":"payment.captured","reference":"fake_auth_1","amount":100}`)
+	sig := SignWebhook("secret", now, body)
+
+	tcs := []struct {
+		name      string
+		secret    string
+		signature string
+		body      []byte
+		now       time.Time
+		ok        bool
+	}{
+		{name: "valid", secret: "secret", signature: sig, body: body, now: now.Add(time.Minute), ok: true},
+		{name: "wrong secret", secret: "other", signature: sig, body: body, now: now},
+		{name: "tampered body", secret: "secret", signature: sig, body: append([]byte(" "), body...), now: now},
+		{name: "too old", secret: "secret", signature: sig, body: body, now: now.Add(SignatureTolerance + time.Second)},
+		{name: "no secret", signature: SignWebhook("", now, body), body: body, now: now},
+		{name: "malformed", secret: "secret", signature: "v1=abc", body: body, now: now},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := VerifyWebhook(tc.secret, tc.signature, tc.body, tc.now)
+			if tc.ok {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, ErrInvalidSignature)
+		})
+	}
+}
+
+func TestFakeParseWebhook(t *testing.T) {
+	f := NewFake("secret")
+	body := []byte(`{"id":"evt_1","type":"payment.captured","reference":"fake_auth_1","amount":100}`)
+	header := http.Header{}
+	header.Set(SignatureHeader, SignWebhook("secret", time.Now(), body))
+
+	ev, err := f.ParseWebhook(header, body)
+	require.NoError(t, err)
+	require.Equal(t, Event{ID: "evt_1", Type: EventCaptured, Reference: "fake_auth_1", Amount: 100}, ev)
+
+	header.Set(SignatureHeader, SignWebhook("wrong", time.Now(), body))
+	_, err = f.ParseWebhook(header, body)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+}
@@ -0,0 +1,17 @@
+package rbac
+
+// Permission is a fine-grained right granted to users through their roles.
+// Roles and their permissions live in the roles, permissions and
+// role_permissions tables; the constants here are the ones routes check.
+type Permission string
+
+const (
+	ProductsWrite Permission = "products:write"
+	OrdersRead    Permission = "orders:read"
+	OrdersWrite   Permission = "orders:write"
+	OrdersRefund  Permission = "orders:refund"
+	UsersRead     Permission = "users:read"
+	UsersWrite    Permission = "users:write"
+	RolesWrite    Permission = "roles:write"
+	CouponsWrite  Permission = "coupons:write"
+)
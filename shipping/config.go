@@ -0,0 +1,103 @@
+package shipping
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	typeFlatRate    = "flat_rate"
+	typeWeightTable = "weight_table"
+)
+
+type methodConfig struct {
+	Code      string   `json:"code"`
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Countries []string `json:"countries"`
+	// FreeOver makes the method free from this order subtotal up.
+	FreeOver float64 `json:"free_over"`
+
+	Price float64 `json:"price"`
+
+	Rates []struct {
+		UpToGrams int64   `json:"up_to_grams"`
+		Price     float64 `json:"price"`
+	} `json:"rates"`
+	VolumetricDivisor int64 `json:"volumetric_divisor"`
+}
+
+// LoadMethods reads the shipping methods from a JSON file holding a list
+// like
+//
+//	[
+//	  {"code": "standard", "name": "Standard", "type": "flat_rate", "price": 50, "free_over": 1500},
+//	  {"code": "express", "name": "Express", "type": "weight_table", "countries": ["TH"],
+//	   "volumetric_divisor": 5000, "rates": [{"up_to_grams": 1000, "price": 120}, {"up_to_grams": 5000, "price": 250}]}
+//	]
+func LoadMethods(path string) (Methods, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading shipping methods: %w", err)
+	}
+
+	var configs []methodConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("error parsing shipping methods: %w", err)
+	}
+
+	return newMethods(configs)
+}
+
+func newMethods(configs []methodConfig) (Methods, error) {
+	var methods Methods
+	seen := make(map[string]bool)
+	for _, cfg := range configs {
+		if cfg.Code == "" {
+			return nil, errors.New("shipping method without a code")
+		}
+		if seen[cfg.Code] {
+			return nil, fmt.Errorf("duplicate shipping method %q", cfg.Code)
+		}
+		seen[cfg.Code] = true
+
+		countries := make([]string, len(cfg.Countries))
+		for i, c := range cfg.Countries {
+			countries[i] = strings.ToUpper(c)
+		}
+
+		var c Calculator
+		switch cfg.Type {
+		case typeFlatRate:
+			c = &FlatRate{Code: cfg.Code, Name: cfg.Name, Price: cfg.Price, Countries: countries}
+		case typeWeightTable:
+			w := &WeightTable{Code: cfg.Code, Name: cfg.Name, VolumetricDivisor: cfg.VolumetricDivisor, Countries: countries}
+			for i, r := range cfg.Rates {
+				if i > 0 && r.UpToGrams <= cfg.Rates[i-1].UpToGrams {
+					return nil, fmt.Errorf("shipping method %q: rates must be sorted by weight", cfg.Code)
+				}
+				w.Rates = append(w.Rates, WeightRate{UpToGrams: r.UpToGrams, Price: r.Price})
+			}
+			if len(w.Rates) == 0 {
+				return nil, fmt.Errorf("shipping method %q has no rates", cfg.Code)
+			}
+			c = w
+		default:
+			return nil, fmt.Errorf("shipping method %q has unknown type %q", cfg.Code, cfg.Type)
+		}
+
+		if cfg.FreeOver > 0 {
+			c = &FreeOver{Calculator: c, Threshold: cfg.FreeOver}
+		}
+		methods = append(methods, c)
+	}
+
+	if len(methods) == 0 {
+		return nil, errors.New("no shipping methods configured")
+	}
+
+	return methods, nil
+}
@@ -0,0 +1,201 @@
+// Package shipping prices the delivery of an order. Each shipping method is
+// a Calculator and the methods a shop offers are combined in Methods.
+package shipping
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrUnknownMethod = errors.New("unknown shipping method")
+	// ErrUnavailable is returned by a Calculator that can't ship the items
+	// to the destination, e.g. because they are too heavy.
+	ErrUnavailable = errors.New("shipping method is not available for this order")
+)
+
+// Item is an order line as far as shipping is concerned.
+type Item struct {
+	Quantity    int64
+	UnitPrice   float64
+	WeightGrams int64
+	LengthMM    int64
+	WidthMM     int64
+	HeightMM    int64
+}
+
+// Destination is where the order is shipped to.
+type Destination struct {
+	// Country is an ISO 3166-1 alpha-2 code.
+	Country    string
+	State      string
+	PostalCode string
+}
+
+// Quote is the price of shipping with one method.
+type Quote struct {
+	Method string
+	Name   string
+	Price  float64
+}
+
+// Calculator prices one shipping method.
+type Calculator interface {
+	// Method is the code clients pick the method by.
+	Method() string
+	Quote(items []Item, dest Destination) (Quote, error)
+}
+
+// Methods are the shipping methods on offer, in the order they are shown.
+type Methods []Calculator
+
+// Quotes prices every method that can ship the items to dest.
+func (m Methods) Quotes(items []Item, dest Destination) ([]Quote, error) {
+	quotes := []Quote{}
+	for _, c := range m {
+		q, err := c.Quote(items, dest)
+		if errors.Is(err, ErrUnavailable) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error quoting %s: %w", c.Method(), err)
+		}
+		quotes = append(quotes, q)
+	}
+
+	return quotes, nil
+}
+
+// Quote prices the named method. An empty method picks the first one that
+// is available.
+func (m Methods) Quote(method string, items []Item, dest Destination) (Quote, error) {
+	if method == "" {
+		quotes, err := m.Quotes(items, dest)
+		if err != nil {
+			return Quote{}, err
+		}
+		if len(quotes) == 0 {
+			return Quote{}, ErrUnavailable
+		}
+		return quotes[0], nil
+	}
+
+	for _, c := range m {
+		if c.Method() == method {
+			return c.Quote(items, dest)
+		}
+	}
+
+	return Quote{}, ErrUnknownMethod
+}
+
+// FlatRate charges the same price for any order.
+type FlatRate struct {
+	Code  string
+	Name  string
+	Price float64
+	// Countries limits the method to these destinations. Empty means
+	// anywhere.
+	Countries []string
+}
+
+func (f *FlatRate) Method() string {
+	return f.Code
+}
+
+func (f *FlatRate) Quote(items []Item, dest Destination) (Quote, error) {
+	if !shipsTo(f.Countries, dest) {
+		return Quote{}, ErrUnavailable
+	}
+
+	return Quote{Method: f.Code, Name: f.Name, Price: f.Price}, nil
+}
+
+// WeightRate is the price of parcels up to a weight.
+type WeightRate struct {
+	UpToGrams int64
+	Price     float64
+}
+
+// WeightTable charges by the parcel's chargeable weight, which is the larger
+// of its actual and volumetric weight. Parcels heavier than the last rate
+// can't be shipped with it.
+type WeightTable struct {
+	Code string
+	Name string
+	// Rates must be sorted by weight.
+	Rates []WeightRate
+	// VolumetricDivisor converts an item's size to a weight: grams are
+	// length × width × height in millimetres divided by it. It is the
+	// carrier's cm³ per kg figure, commonly 5000. Zero ignores size.
+	VolumetricDivisor int64
+	Countries         []string
+}
+
+func (w *WeightTable) Method() string {
+	return w.Code
+}
+
+func (w *WeightTable) Quote(items []Item, dest Destination) (Quote, error) {
+	if !shipsTo(w.Countries, dest) {
+		return Quote{}, ErrUnavailable
+	}
+
+	weight := w.chargeableWeight(items)
+	for _, r := range w.Rates {
+		if weight <= r.UpToGrams {
+			return Quote{Method: w.Code, Name: w.Name, Price: r.Price}, nil
+		}
+	}
+
+	return Quote{}, ErrUnavailable
+}
+
+func (w *WeightTable) chargeableWeight(items []Item) int64 {
+	var total int64
+	for _, i := range items {
+		weight := i.WeightGrams
+		if w.VolumetricDivisor > 0 {
+			volumetric := (i.LengthMM*i.WidthMM*i.HeightMM + w.VolumetricDivisor - 1) / w.VolumetricDivisor
+			weight = max(weight, volumetric)
+		}
+		total += weight * i.Quantity
+	}
+
+	return total
+}
+
+// FreeOver makes a method free for orders whose items cost at least
+// Threshold.
+type FreeOver struct {
+	Calculator
+	Threshold float64
+}
+
+func (f *FreeOver) Quote(items []Item, dest Destination) (Quote, error) {
+	q, err := f.Calculator.Quote(items, dest)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	if Subtotal(items) >= f.Threshold {
+		q.Price = 0
+	}
+	return q, nil
+}
+
+// Subtotal is what the items cost before shipping and tax.
+func Subtotal(items []Item) float64 {
+	var total float64
+	for _, i := range items {
+		total += i.UnitPrice * float64(i.Quantity)
+	}
+
+	return total
+}
+
+func shipsTo(countries []string, dest Destination) bool {
+	return len(countries) == 0 || slices.Contains(countries, strings.ToUpper(dest.Country))
+}
@@ -0,0 +1,120 @@
+package shipping
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeightTable(t *testing.T) {
+	w := &WeightTable{
+		Code:              "parcel",
+		Rates:             []WeightRate{{UpToGrams: 1000, Price: 50}, {UpToGrams: 5000, Price: 120}},
+		VolumetricDivisor: 5000,
+	}
+	th := Destination{Country: "TH"}
+
+	tcs := []struct {
+		name  string
+		items []Item
+		price float64
+		err   error
+	}{
+		{
+			name:  "light",
+			items: []Item{{Quantity: 2, WeightGrams: 400}},
+			price: 50,
+		},
+		{
+			name:  "quantity counts",
+			items: []Item{{Quantity: 3, WeightGrams: 400}},
+			price: 120,
+		},
+		{
+			// 300 × 200 × 100 mm is 1200 g volumetric
+			name:  "bulky but light",
+			items: []Item{{Quantity: 1, WeightGrams: 200, LengthMM: 300, WidthMM: 200, HeightMM: 100}},
+			price: 120,
+		},
+		{
+			name:  "too heavy",
+			items: []Item{{Quantity: 1, WeightGrams: 6000}},
+			err:   ErrUnavailable,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := w.Quote(tc.items, th)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.price, q.Price)
+		})
+	}
+}
+
+func TestMethods(t *testing.T) {
+	methods := Methods{
+		&FreeOver{
+			Calculator: &FlatRate{Code: "standard", Name: "Standard", Price: 50},
+			Threshold:  1000,
+		},
+		&FlatRate{Code: "express", Name: "Express", Price: 150, Countries: []string{"TH"}},
+	}
+	cheap := []Item{{Quantity: 1, UnitPrice: 200}}
+	expensive := []Item{{Quantity: 2, UnitPrice: 600}}
+
+	quotes, err := methods.Quotes(cheap, Destination{Country: "th"})
+	require.NoError(t, err)
+	require.Equal(t, []Quote{
+		{Method: "standard", Name: "Standard", Price: 50},
+		{Method: "express", Name: "Express", Price: 150},
+	}, quotes)
+
+	quotes, err = methods.Quotes(expensive, Destination{Country: "US"})
+	require.NoError(t, err)
+	require.Equal(t, []Quote{{Method: "standard", Name: "Standard", Price: 0}}, quotes)
+
+	q, err := methods.Quote("", cheap, Destination{Country: "US"})
+	require.NoError(t, err)
+	require.Equal(t, "standard", q.Method)
+
+	_, err = methods.Quote("express", cheap, Destination{Country: "US"})
+	require.ErrorIs(t, err, ErrUnavailable)
+
+	_, err = methods.Quote("overnight", cheap, Destination{Country: "TH"})
+	require.ErrorIs(t, err, ErrUnknownMethod)
+}
+
+func TestLoadMethods(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shipping.json")
+	err := os.WriteFile(path, []byte(`[
+		{"code": "standard", "name": "Standard", "type": "flat_rate", "price": 50, "free_over": 1500},
+		{"code": "express", "name": "Express", "type": "weight_table", "countries": ["th"],
+		 "rates": [{"up_to_grams": 1000, "price": 120}, {"up_to_grams": 5000, "price": 250}]}
+	]`), 0o600)
+	require.NoError(t, err)
+
+	methods, err := LoadMethods(path)
+	require.NoError(t, err)
+	require.Len(t, methods, 2)
+
+	q, err := methods.Quote("express", []Item{{Quantity: 1, WeightGrams: 2000}}, Destination{Country: "TH"})
+	require.NoError(t, err)
+	require.Equal(t, 250.0, q.Price)
+
+	q, err = methods.Quote("standard", []Item{{Quantity: 1, UnitPrice: 1500}}, Destination{Country: "TH"})
+	require.NoError(t, err)
+	require.Zero(t, q.Price)
+
+	_, err = newMethods([]methodConfig{{Code: "a", Type: "carrier_pigeon"}})
+	require.Error(t, err)
+
+	_, err = newMethods([]methodConfig{{Code: "a", Type: typeFlatRate}, {Code: "a", Type: typeFlatRate}})
+	require.Error(t, err)
+}
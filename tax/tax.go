@@ -0,0 +1,215 @@
+// Package tax works out the tax on order lines from rules keyed by the
+// destination and the product's tax category.
+//
+// Rules are read from a JSON file so rates can change without a deploy:
+//
+//	[
+//	  {"country": "TH", "name": "VAT", "rate": 0.07, "inclusive": true},
+//	  {"country": "US", "region": "CA", "name": "Sales tax", "rate": 0.0725},
+//	  {"country": "US", "region": "CA", "category": "food", "name": "Sales tax", "rate": 0}
+//	]
+//
+// The most specific rule wins: a rule for the region beats one for the
+// whole country, and at the same level a rule for the category beats one
+// without. Lines no rule matches are not taxed.
+package tax
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Rule is the tax rate for a destination and, optionally, a category.
+type Rule struct {
+	// Country is an ISO 3166-1 alpha-2 code.
+	Country string `json:"country"`
+	// Region narrows the rule to a state or province. Empty matches the
+	// whole country.
+	Region string `json:"region"`
+	// Category narrows the rule to products of a tax category. Empty
+	// matches any category.
+	Category string  `json:"category"`
+	Name     string  `json:"name"`
+	Rate     float64 `json:"rate"`
+	// Inclusive means catalog prices already include the tax, as is usual
+	// for VAT. Otherwise it is added on top.
+	Inclusive bool `json:"inclusive"`
+}
+
+// Destination is where the order is shipped to.
+type Destination struct {
+	Country string
+	Region  string
+}
+
+// Line is an order line to tax.
+type Line struct {
+	Category  string
+	UnitPrice float64
+	Quantity  int64
+	// Discount is taken off the line's price before it is taxed.
+	Discount float64
+}
+
+// LineTax is the tax on one line. Net is the line's price without tax and
+// Gross with it, so Net + Tax = Gross.
+type LineTax struct {
+	Name      string
+	Rate      float64
+	Inclusive bool
+	Net       float64
+	Tax       float64
+	Gross     float64
+}
+
+type ruleKey struct {
+	country  string
+	region   string
+	category string
+}
+
+// Engine applies the rules loaded from a file. It is safe for concurrent
+// use and can be reloaded while in use.
+type Engine struct {
+	path string
+
+	mu    sync.RWMutex
+	rules map[ruleKey]Rule
+}
+
+// NewEngine loads the rules in path. Without a path nothing is taxed.
+func NewEngine(path string) (*Engine, error) {
+	e := &Engine{path: path, rules: make(map[ruleKey]Rule)}
+	if path == "" {
+		return e, nil
+	}
+
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// NewEngineFromRules builds an engine from rules instead of a file.
+func NewEngineFromRules(rules []Rule) (*Engine, error) {
+	m, err := indexRules(rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Engine{rules: m}, nil
+}
+
+// Reload re-reads the rules file. The previous rules stay in place if
+// reloading fails.
+func (e *Engine) Reload() error {
+	if e.path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return fmt.Errorf("error reading tax rules: %w", err)
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("error parsing tax rules: %w", err)
+	}
+
+	m, err := indexRules(rules)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = m
+
+	return nil
+}
+
+func indexRules(rules []Rule) (map[ruleKey]Rule, error) {
+	m := make(map[ruleKey]Rule, len(rules))
+	for _, r := range rules {
+		if len(r.Country) != 2 {
+			return nil, fmt.Errorf("tax rule %q: country must be a two letter code", r.Name)
+		}
+		if r.Rate < 0 || r.Rate >= 1 {
+			return nil, fmt.Errorf("tax rule %q: rate must be a fraction such as 0.07", r.Name)
+		}
+
+		k := newRuleKey(r.Country, r.Region, r.Category)
+		if _, ok := m[k]; ok {
+			return nil, fmt.Errorf("duplicate tax rule for %s %s %s", r.Country, r.Region, r.Category)
+		}
+		m[k] = r
+	}
+
+	return m, nil
+}
+
+// Calculate works out the tax on each line shipped to dest.
+func (e *Engine) Calculate(dest Destination, lines []Line) []LineTax {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	taxes := make([]LineTax, len(lines))
+	for i, l := range lines {
+		r, _ := e.match(dest, l.Category)
+		taxes[i] = apply(r, l)
+	}
+
+	return taxes
+}
+
+func (e *Engine) match(dest Destination, category string) (Rule, bool) {
+	candidates := []ruleKey{
+		newRuleKey(dest.Country, dest.Region, category),
+		newRuleKey(dest.Country, dest.Region, ""),
+		newRuleKey(dest.Country, "", category),
+		newRuleKey(dest.Country, "", ""),
+	}
+	for _, k := range candidates {
+		if r, ok := e.rules[k]; ok {
+			return r, true
+		}
+	}
+
+	return Rule{}, false
+}
+
+func apply(r Rule, l Line) LineTax {
+	amount := l.UnitPrice*float64(l.Quantity) - l.Discount
+	t := LineTax{Name: r.Name, Rate: r.Rate, Inclusive: r.Inclusive}
+
+	if r.Inclusive {
+		t.Gross = round(amount)
+		t.Net = round(amount / (1 + r.Rate))
+		t.Tax = round(t.Gross - t.Net)
+	} else {
+		t.Net = round(amount)
+		t.Tax = round(amount * r.Rate)
+		t.Gross = round(t.Net + t.Tax)
+	}
+
+	return t
+}
+
+func newRuleKey(country, region, category string) ruleKey {
+	return ruleKey{
+		country:  strings.ToUpper(country),
+		region:   strings.ToUpper(region),
+		category: strings.ToLower(category),
+	}
+}
+
+// round rounds to whole cents, halves away from zero.
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,93 @@
+package tax
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalculate(t *testing.T) {
+	e, err := NewEngineFromRules([]Rule{
+		{Country: "TH", Name: "VAT", Rate: 0.07, Inclusive: true},
+		{Country: "US", Region: "CA", Name: "Sales tax", Rate: 0.0725},
+		{Country: "US", Region: "CA", Category: "food", Name: "Sales tax", Rate: 0},
+		{Country: "US", Category: "digital", Name: "Digital tax", Rate: 0.05},
+	})
+	require.NoError(t, err)
+
+	tcs := []struct {
+		name string
+		dest Destination
+		line Line
+		want LineTax
+	}{
+		{
+			name: "inclusive",
+			dest: Destination{Country: "TH"},
+			line: Line{UnitPrice: 107, Quantity: 2},
+			want: LineTax{Name: "VAT", Rate: 0.07, Inclusive: true, Net: 200, Tax: 14, Gross: 214},
+		},
+		{
+			name: "exclusive",
+			dest: Destination{Country: "US", Region: "ca"},
+			line: Line{UnitPrice: 19.99, Quantity: 3},
+			want: LineTax{Name: "Sales tax", Rate: 0.0725, Net: 59.97, Tax: 4.35, Gross: 64.32},
+		},
+		{
+			name: "category in region",
+			dest: Destination{Country: "US", Region: "CA"},
+			line: Line{Category: "Food", UnitPrice: 10, Quantity: 1},
+			want: LineTax{Name: "Sales tax", Net: 10, Gross: 10},
+		},
+		{
+			name: "category in country",
+			dest: Destination{Country: "US", Region: "NY"},
+			line: Line{Category: "digital", UnitPrice: 10, Quantity: 1},
+			want: LineTax{Name: "Digital tax", Rate: 0.05, Net: 10, Tax: 0.5, Gross: 10.5},
+		},
+		{
+			name: "discounted",
+			dest: Destination{Country: "US", Region: "CA"},
+			line: Line{UnitPrice: 20, Quantity: 5, Discount: 20},
+			want: LineTax{Name: "Sales tax", Rate: 0.0725, Net: 80, Tax: 5.8, Gross: 85.8},
+		},
+		{
+			name: "no rule",
+			dest: Destination{Country: "JP"},
+			line: Line{UnitPrice: 10, Quantity: 1},
+			want: LineTax{Net: 10, Gross: 10},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got := e.Calculate(tc.dest, []Line{tc.line})
+			require.Equal(t, []LineTax{tc.want}, got)
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tax.json")
+	write := func(s string) {
+		require.NoError(t, os.WriteFile(path, []byte(s), 0o600))
+	}
+	th := Destination{Country: "TH"}
+	line := []Line{{UnitPrice: 100, Quantity: 1}}
+
+	write(`[{"country": "TH", "name": "VAT", "rate": 0.07}]`)
+	e, err := NewEngine(path)
+	require.NoError(t, err)
+	require.Equal(t, 7.0, e.Calculate(th, line)[0].Tax)
+
+	write(`[{"country": "TH", "name": "VAT", "rate": 0.1}]`)
+	require.NoError(t, e.Reload())
+	require.Equal(t, 10.0, e.Calculate(th, line)[0].Tax)
+
+	// a broken file keeps the rules that were loaded
+	write(`[{"country": "TH", "name": "VAT", "rate": 7}]`)
+	require.Error(t, e.Reload())
+	require.Equal(t, 10.0, e.Calculate(th, line)[0].Tax)
+}
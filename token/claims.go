@@ -4,32 +4,85 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/codepnw/microservice-ecommerce/rbac"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// TokenType distinguishes what a token may be used for. An access token is
+// only accepted as a bearer credential and a refresh token only by the
+// renew endpoint.
+type TokenType string
+
+const (
+	AccessToken  TokenType = "access"
+	RefreshToken TokenType = "refresh"
+	// MFAChallenge is issued after a correct password when a second factor
+	// is still needed. It can only be exchanged for a session at the MFA
+	// login endpoint.
+	MFAChallenge TokenType = "mfa_challenge"
+)
+
+// Subject describes who a token is issued to, what they may do and the
+// session it belongs to.
+type Subject struct {
+	UserID      int64
+	Email       string
+	Roles       []string
+	Permissions []rbac.Permission
+	SessionID   string
+	// MFA is set when the session was started with a second factor.
+	MFA bool
+}
+
 type UserClaims struct {
-	ID      int64  `json:"id"`
-	Email   string `json:"email"`
-	IsAdmin bool   `json:"is_admin"`
+	ID          int64             `json:"id"`
+	Email       string            `json:"email"`
+	Roles       []string          `json:"roles,omitempty"`
+	Permissions []rbac.Permission `json:"permissions,omitempty"`
+	Type        TokenType         `json:"token_type"`
+	SessionID   string            `json:"sid"`
+	MFA         bool              `json:"mfa,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func NewUserClaims(id int64, email string, isAdmin bool, duration time.Duration) (*UserClaims, error) {
+// NewUserClaims returns the claims for a token issued to sub. Refresh
+// tokens leave out roles and permissions; they are looked up again when
+// the token is renewed, and would make the token too long to store.
+func NewUserClaims(sub Subject, tokenType TokenType, duration time.Duration) (*UserClaims, error) {
 	tokenID, err := uuid.NewRandom()
 	if err != nil {
 		return nil, fmt.Errorf("error generating token ID: %w", err)
 	}
 
+	if tokenType == RefreshToken {
+		sub.Roles, sub.Permissions = nil, nil
+	}
+
+	now := time.Now()
 	return &UserClaims{
-		Email:   email,
-		ID:      id,
-		IsAdmin: isAdmin,
+		Email:       sub.Email,
+		ID:          sub.UserID,
+		Roles:       sub.Roles,
+		Permissions: sub.Permissions,
+		Type:        tokenType,
+		SessionID:   sub.SessionID,
+		MFA:         sub.MFA,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        tokenID.String(),
-			Subject:   email,
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
+			Subject:   sub.Email,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
 		},
 	}, nil
 }
+
+func (c *UserClaims) HasPermission(p rbac.Permission) bool {
+	for _, granted := range c.Permissions {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
@@ -1,46 +1,51 @@
 package token
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+var ErrInvalidTokenType = errors.New("invalid token type")
+
 type JWTMaker struct {
-	secretKey string
+	keys     *KeySet
+	issuer   string
+	audience string
 }
 
-func NewJWTMaker(secretKey string) *JWTMaker {
-	return &JWTMaker{secretKey: secretKey}
+func NewJWTMaker(keys *KeySet, issuer, audience string) *JWTMaker {
+	return &JWTMaker{
+		keys:     keys,
+		issuer:   issuer,
+		audience: audience,
+	}
 }
 
-func (maker *JWTMaker) CreateToken(id int64, email string, isAdmin bool, duration time.Duration) (string, *UserClaims, error) {
-	claims, err := NewUserClaims(id, email, isAdmin, duration)
+func (maker *JWTMaker) CreateToken(sub Subject, tokenType TokenType, duration time.Duration) (string, *UserClaims, error) {
+	claims, err := NewUserClaims(sub, tokenType, duration)
 	if err != nil {
 		return "", nil, err
 	}
+	claims.Issuer = maker.issuer
+	claims.Audience = jwt.ClaimStrings{maker.audience}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenStr, err := token.SignedString([]byte(maker.secretKey))
+	tokenStr, err := maker.sign(claims)
 	if err != nil {
-		return "", nil, fmt.Errorf("error signing token: %w", err)
+		return "", nil, err
 	}
 
 	return tokenStr, claims, nil
 }
 
-func (maker *JWTMaker) VerifyToken(tokenStr string) (*UserClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &UserClaims{}, func(t *jwt.Token) (interface{}, error) {
-		_, ok := t.Method.(*jwt.SigningMethodHMAC)
-		if !ok {
-			return nil, fmt.Errorf("invalid token signing method")
-		}
-
-		return []byte(maker.secretKey), nil
-	})
+// VerifyToken parses tokenStr and checks its signature, issuer, audience,
+// validity window and that it was issued as tokenType.
+func (maker *JWTMaker) VerifyToken(tokenStr string, tokenType TokenType) (*UserClaims, error) {
+	token, err := maker.parse(tokenStr, &UserClaims{})
 	if err != nil {
-		return nil, fmt.Errorf("error parsing token: %w", err)
+		return nil, err
 	}
 
 	claims, ok := token.Claims.(*UserClaims)
@@ -48,5 +53,53 @@ func (maker *JWTMaker) VerifyToken(tokenStr string) (*UserClaims, error) {
 		return nil, fmt.Errorf("invalid token claims")
 	}
 
+	if claims.Type != tokenType {
+		return nil, ErrInvalidTokenType
+	}
+
 	return claims, nil
-}
\ No newline at end of file
+}
+
+func (maker *JWTMaker) sign(claims jwt.Claims) (string, error) {
+	key := maker.keys.signingKey()
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	tokenStr, err := token.SignedString(key.signingKey)
+	if err != nil {
+		return "", fmt.Errorf("error signing token: %w", err)
+	}
+
+	return tokenStr, nil
+}
+
+// parse checks the signature, issuer, audience and validity window of
+// tokenStr and decodes it into claims.
+func (maker *JWTMaker) parse(tokenStr string, claims jwt.Claims) (*jwt.Token, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := maker.keys.lookup(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("invalid token signing method")
+		}
+
+		return key.verifyKey, nil
+	},
+		jwt.WithIssuer(maker.issuer),
+		jwt.WithAudience(maker.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing token: %w", err)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,216 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codepnw/microservice-ecommerce/rbac"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyToken(t *testing.T) {
+	maker := newHMACMaker(t, "ecom-api", "ecom-api")
+
+	tcs := []struct {
+		name string
+		test func(*testing.T)
+	}{
+		{
+			name: "success",
+			test: func(t *testing.T) {
+				tokenStr, _, err := maker.CreateToken(testSubject, AccessToken, time.Minute)
+				require.NoError(t, err)
+
+				claims, err := maker.VerifyToken(tokenStr, AccessToken)
+				require.NoError(t, err)
+				require.Equal(t, int64(1), claims.ID)
+				require.Equal(t, AccessToken, claims.Type)
+				require.Equal(t, "test-session", claims.SessionID)
+				require.True(t, claims.HasPermission(rbac.ProductsWrite))
+				require.False(t, claims.HasPermission(rbac.UsersWrite))
+			},
+		},
+		{
+			name: "refresh token leaves out roles",
+			test: func(t *testing.T) {
+				tokenStr, _, err := maker.CreateToken(testSubject, RefreshToken, time.Hour)
+				require.NoError(t, err)
+
+				claims, err := maker.VerifyToken(tokenStr, RefreshToken)
+				require.NoError(t, err)
+				require.Equal(t, "test-session", claims.SessionID)
+				require.Empty(t, claims.Roles)
+				require.Empty(t, claims.Permissions)
+			},
+		},
+		{
+			name: "refresh token used as access token",
+			test: func(t *testing.T) {
+				tokenStr, _, err := maker.CreateToken(testSubject, RefreshToken, time.Hour)
+				require.NoError(t, err)
+
+				_, err = maker.VerifyToken(tokenStr, AccessToken)
+				require.ErrorIs(t, err, ErrInvalidTokenType)
+			},
+		},
+		{
+			name: "access token used as refresh token",
+			test: func(t *testing.T) {
+				tokenStr, _, err := maker.CreateToken(testSubject, AccessToken, time.Minute)
+				require.NoError(t, err)
+
+				_, err = maker.VerifyToken(tokenStr, RefreshToken)
+				require.ErrorIs(t, err, ErrInvalidTokenType)
+			},
+		},
+		{
+			name: "wrong audience",
+			test: func(t *testing.T) {
+				other := newHMACMaker(t, "ecom-api", "other-service")
+				tokenStr, _, err := other.CreateToken(testSubject, AccessToken, time.Minute)
+				require.NoError(t, err)
+
+				_, err = maker.VerifyToken(tokenStr, AccessToken)
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "wrong issuer",
+			test: func(t *testing.T) {
+				other := newHMACMaker(t, "other-issuer", "ecom-api")
+				tokenStr, _, err := other.CreateToken(testSubject, AccessToken, time.Minute)
+				require.NoError(t, err)
+
+				_, err = maker.VerifyToken(tokenStr, AccessToken)
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "expired token",
+			test: func(t *testing.T) {
+				tokenStr, _, err := maker.CreateToken(testSubject, AccessToken, -time.Minute)
+				require.NoError(t, err)
+
+				_, err = maker.VerifyToken(tokenStr, AccessToken)
+				require.Error(t, err)
+			},
+		},
+		{
+			name: "oidc state",
+			test: func(t *testing.T) {
+				tokenStr, err := maker.CreateOIDCState("google", "state", "nonce", "verifier", time.Minute)
+				require.NoError(t, err)
+
+				claims, err := maker.VerifyOIDCState(tokenStr)
+				require.NoError(t, err)
+				require.Equal(t, "google", claims.Provider)
+				require.Equal(t, "verifier", claims.CodeVerifier)
+
+				_, err = maker.VerifyToken(tokenStr, AccessToken)
+				require.ErrorIs(t, err, ErrInvalidTokenType)
+			},
+		},
+		{
+			name: "access token used as oidc state",
+			test: func(t *testing.T) {
+				tokenStr, _, err := maker.CreateToken(testSubject, AccessToken, time.Minute)
+				require.NoError(t, err)
+
+				_, err = maker.VerifyOIDCState(tokenStr)
+				require.ErrorIs(t, err, ErrInvalidTokenType)
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, tc.test)
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeRSAKey(t, dir, "2026-01")
+
+	keys, err := NewKeySet("test-secret", dir, "")
+	require.NoError(t, err)
+	maker := NewJWTMaker(keys, "ecom-api", "ecom-api")
+
+	// issued with the shared secret before keys were introduced
+	legacy, _, err := newHMACMaker(t, "ecom-api", "ecom-api").CreateToken(testSubject, AccessToken, time.Minute)
+	require.NoError(t, err)
+
+	oldToken, _, err := maker.CreateToken(testSubject, AccessToken, time.Minute)
+	require.NoError(t, err)
+
+	writeEd25519Key(t, dir, "2026-02")
+	require.NoError(t, keys.Reload())
+
+	newToken, _, err := maker.CreateToken(testSubject, AccessToken, time.Minute)
+	require.NoError(t, err)
+
+	for _, tokenStr := range []string{legacy, oldToken, newToken} {
+		_, err := maker.VerifyToken(tokenStr, AccessToken)
+		require.NoError(t, err)
+	}
+
+	jwks := maker.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	require.Equal(t, "2026-01", jwks.Keys[0].Kid)
+	require.Equal(t, "RS256", jwks.Keys[0].Alg)
+	require.Equal(t, "2026-02", jwks.Keys[1].Kid)
+	require.Equal(t, "EdDSA", jwks.Keys[1].Alg)
+}
+
+func TestKeySetUnknownKey(t *testing.T) {
+	dir := t.TempDir()
+	writeEd25519Key(t, dir, "a")
+
+	keys, err := NewKeySet("", dir, "")
+	require.NoError(t, err)
+	tokenStr, _, err := NewJWTMaker(keys, "ecom-api", "ecom-api").CreateToken(testSubject, AccessToken, time.Minute)
+	require.NoError(t, err)
+
+	_, err = newHMACMaker(t, "ecom-api", "ecom-api").VerifyToken(tokenStr, AccessToken)
+	require.ErrorIs(t, err, ErrUnknownKey)
+}
+
+var testSubject = Subject{
+	UserID:      1,
+	Email:       "test@example.com",
+	Roles:       []string{"catalog-manager"},
+	Permissions: []rbac.Permission{rbac.ProductsWrite},
+	SessionID:   "test-session",
+}
+
+func newHMACMaker(t *testing.T, issuer, audience string) *JWTMaker {
+	keys, err := NewKeySet("test-secret", "", "")
+	require.NoError(t, err)
+	return NewJWTMaker(keys, issuer, audience)
+}
+
+func writeRSAKey(t *testing.T, dir, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writePEM(t, dir, kid, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+}
+
+func writeEd25519Key(t *testing.T, dir, kid string) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	writePEM(t, dir, kid, "PRIVATE KEY", der)
+}
+
+func writePEM(t *testing.T, dir, kid, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600))
+}
@@ -0,0 +1,239 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// hmacKeyID identifies the shared-secret key. Tokens signed before key IDs
+// were introduced carry no kid header and are matched against it.
+const hmacKeyID = "hs256"
+
+const minRSAKeyBits = 2048
+
+var (
+	ErrNoSigningKey = errors.New("no signing key configured")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// Key is a single signing or verification key identified by its kid. Keys
+// loaded from a public key file can only verify tokens.
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	signingKey any
+	verifyKey  any
+}
+
+func (k *Key) canSign() bool {
+	return k.signingKey != nil
+}
+
+// NewHMACKey returns an HS256 key for the shared secret. Symmetric keys are
+// never published in the JWKS.
+func NewHMACKey(secret []byte) *Key {
+	return &Key{
+		ID:         hmacKeyID,
+		Method:     jwt.SigningMethodHS256,
+		signingKey: secret,
+		verifyKey:  secret,
+	}
+}
+
+// ParseKey parses a PEM encoded RSA or Ed25519 key. Private keys sign and
+// verify, public keys only verify.
+func ParseKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("error decoding PEM for key %q", id)
+	}
+
+	var (
+		parsed any
+		err    error
+	)
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q for key %q", block.Type, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing key %q: %w", id, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key %q is shorter than %d bits", id, minRSAKeyBits)
+		}
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, signingKey: k, verifyKey: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key %q is shorter than %d bits", id, minRSAKeyBits)
+		}
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, verifyKey: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, signingKey: k, verifyKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, verifyKey: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T for key %q", parsed, id)
+	}
+}
+
+// KeySet holds every key tokens may be verified with and the one new tokens
+// are signed with.
+//
+// Keys are read from a directory of <kid>.pem files. To rotate, add the new
+// private key, keep the previous key (its public half is enough) until the
+// tokens it signed have expired, and call Reload. The active key is the
+// configured kid or, if none is configured, the highest sorting kid that has
+// a private key, so date-based kids rotate by simply adding a file.
+type KeySet struct {
+	mu       sync.RWMutex
+	secret   []byte
+	dir      string
+	activeID string
+	keys     map[string]*Key
+	active   *Key
+}
+
+// NewKeySet builds a keyset from an optional HS256 secret and an optional
+// key directory. When both are given the directory keys sign new tokens and
+// the secret is kept to verify tokens issued before the switch.
+func NewKeySet(secret, dir, activeID string) (*KeySet, error) {
+	ks := &KeySet{dir: dir, activeID: activeID}
+	if secret != "" {
+		ks.secret = []byte(secret)
+	}
+
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// Reload re-reads the key directory and selects the active key. The
+// previous keys stay in place if reloading fails.
+func (ks *KeySet) Reload() error {
+	keys := make(map[string]*Key)
+	if ks.secret != nil {
+		keys[hmacKeyID] = NewHMACKey(ks.secret)
+	}
+
+	if ks.dir != "" {
+		files, err := filepath.Glob(filepath.Join(ks.dir, "*.pem"))
+		if err != nil {
+			return fmt.Errorf("error listing keys: %w", err)
+		}
+
+		for _, f := range files {
+			data, err := os.ReadFile(f)
+			if err != nil {
+				return fmt.Errorf("error reading key file: %w", err)
+			}
+
+			id := strings.TrimSuffix(filepath.Base(f), ".pem")
+			k, err := ParseKey(id, data)
+			if err != nil {
+				return err
+			}
+			keys[id] = k
+		}
+	}
+
+	active, err := selectActiveKey(keys, ks.activeID)
+	if err != nil {
+		return err
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+	ks.active = active
+
+	return nil
+}
+
+func selectActiveKey(keys map[string]*Key, activeID string) (*Key, error) {
+	if activeID != "" {
+		k, ok := keys[activeID]
+		if !ok || !k.canSign() {
+			return nil, fmt.Errorf("active key %q not found or has no private key", activeID)
+		}
+		return k, nil
+	}
+
+	var ids []string
+	for id, k := range keys {
+		if k.canSign() && id != hmacKeyID {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > 0 {
+		sort.Strings(ids)
+		return keys[ids[len(ids)-1]], nil
+	}
+
+	if k, ok := keys[hmacKeyID]; ok {
+		return k, nil
+	}
+
+	return nil, ErrNoSigningKey
+}
+
+func (ks *KeySet) signingKey() *Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.active
+}
+
+func (ks *KeySet) lookup(kid string) (*Key, error) {
+	if kid == "" {
+		kid = hmacKeyID
+	}
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return k, nil
+}
+
+// publicKeys returns the asymmetric verification keys sorted by kid.
+func (ks *KeySet) publicKeys() []*Key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var keys []*Key
+	for _, k := range ks.keys {
+		if k.Method != jwt.SigningMethodHS256 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+
+	return keys
+}
@@ -0,0 +1,61 @@
+package token
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCState is issued when an OpenID Connect login is started and kept in a
+// cookie until the provider redirects back.
+const OIDCState TokenType = "oidc_state"
+
+// OIDCStateClaims hold what the callback needs to finish a login that was
+// started in the same browser.
+type OIDCStateClaims struct {
+	Provider     string    `json:"provider"`
+	State        string    `json:"state"`
+	Nonce        string    `json:"nonce"`
+	CodeVerifier string    `json:"code_verifier"`
+	Type         TokenType `json:"token_type"`
+	jwt.RegisteredClaims
+}
+
+func (maker *JWTMaker) CreateOIDCState(provider, state, nonce, codeVerifier string, duration time.Duration) (string, error) {
+	now := time.Now()
+	claims := &OIDCStateClaims{
+		Provider:     provider,
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		Type:         OIDCState,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    maker.issuer,
+			Audience:  jwt.ClaimStrings{maker.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
+		},
+	}
+
+	return maker.sign(claims)
+}
+
+func (maker *JWTMaker) VerifyOIDCState(tokenStr string) (*OIDCStateClaims, error) {
+	token, err := maker.parse(tokenStr, &OIDCStateClaims{})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(*OIDCStateClaims)
+	if !ok {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	if claims.Type != OIDCState {
+		return nil, ErrInvalidTokenType
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,67 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// RFC 6238 appendix B uses this ASCII secret for SHA1.
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	tcs := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+	}
+
+	for _, tc := range tcs {
+		code, err := Code(rfcSecret, Step(time.Unix(tc.unix, 0)))
+		require.NoError(t, err)
+		require.Equal(t, tc.code, code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	tcs := []struct {
+		name string
+		code string
+		at   time.Time
+		ok   bool
+	}{
+		{name: "current step", code: "081804", at: now, ok: true},
+		{name: "previous step allowed", code: "081804", at: now.Add(Period), ok: true},
+		{name: "two steps late", code: "081804", at: now.Add(2 * Period), ok: false},
+		{name: "wrong code", code: "000000", at: now, ok: false},
+		{name: "wrong length", code: "81804", at: now, ok: false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tc.code, tc.at)
+			require.Equal(t, tc.ok, ok)
+			if ok {
+				require.Equal(t, Step(now), step)
+			}
+		})
+	}
+}
+
+func TestURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+
+	uri := URI("ecom-api", "test@example.com", secret)
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/ecom-api:test@example.com?"))
+	require.Contains(t, uri, "secret="+secret)
+}
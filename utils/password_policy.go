@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrPasswordTooShort = errors.New("password is too short")
+	ErrPasswordTooLong  = errors.New("password is too long")
+	ErrPasswordBreached = errors.New("password appears in a list of breached passwords")
+)
+
+// PasswordPolicy decides which new passwords are acceptable.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MaxBytes also limits the length in bytes when set, for hashers such
+	// as bcrypt that only take so many bytes.
+	MaxBytes int
+	breached map[string]struct{}
+}
+
+func NewPasswordPolicy(minLength, maxLength int) *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength: minLength,
+		MaxLength: maxLength,
+		breached:  make(map[string]struct{}),
+	}
+}
+
+// LoadBreachedList reads known breached passwords, one per line, from path.
+// Blank lines and lines starting with # are skipped.
+func (p *PasswordPolicy) LoadBreachedList(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening breached password list: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.breached[line] = struct{}{}
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("error reading breached password list: %w", err)
+	}
+
+	return nil
+}
+
+// Validate checks password against the policy. Length is counted in
+// characters, not bytes, except for MaxBytes.
+func (p *PasswordPolicy) Validate(password string) error {
+	n := utf8.RuneCountInString(password)
+	if n < p.MinLength {
+		return fmt.Errorf("%w: at least %d characters required", ErrPasswordTooShort, p.MinLength)
+	}
+	if p.MaxLength > 0 && n > p.MaxLength {
+		return fmt.Errorf("%w: at most %d characters allowed", ErrPasswordTooLong, p.MaxLength)
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		return fmt.Errorf("%w: at most %d bytes allowed", ErrPasswordTooLong, p.MaxBytes)
+	}
+
+	if _, ok := p.breached[password]; ok {
+		return ErrPasswordBreached
+	}
+
+	return nil
+}
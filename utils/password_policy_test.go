@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	err := os.WriteFile(path, []byte("# common passwords\npassword123\n\nletmein-now\n"), 0o600)
+	require.NoError(t, err)
+
+	p := NewPasswordPolicy(8, 20)
+	require.NoError(t, p.LoadBreachedList(path))
+
+	tcs := []struct {
+		name     string
+		password string
+		err      error
+	}{
+		{name: "success", password: "correct horse"},
+		{name: "too short", password: "short", err: ErrPasswordTooShort},
+		{name: "too long", password: "this password is far too long", err: ErrPasswordTooLong},
+		{name: "multibyte characters count once", password: "ผ่านผ่านผ่าน"},
+		{name: "breached", password: "password123", err: ErrPasswordBreached},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := p.Validate(tc.password)
+			if tc.err == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestPasswordPolicyMaxBytes(t *testing.T) {
+	p := NewPasswordPolicy(8, 256)
+	p.MaxBytes = 72
+
+	// 25 Thai characters are 75 bytes, too many for bcrypt
+	long := strings.Repeat("ผ", 25)
+	require.ErrorIs(t, p.Validate(long), ErrPasswordTooLong)
+	_, err := NewBcryptHasher(bcrypt.MinCost).Hash(long)
+	require.ErrorIs(t, err, bcrypt.ErrPasswordTooLong)
+
+	require.NoError(t, p.Validate(strings.Repeat("ผ", 24)))
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2idParams = Argon2idParams{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestHashPassword(t *testing.T) {
+	tcs := []struct {
+		name   string
+		hasher PasswordHasher
+		prefix string
+	}{
+		{name: "argon2id", hasher: NewArgon2idHasher(testArgon2idParams), prefix: "$argon2id$v=19$m=1024,t=1,p=1$"},
+		{name: "bcrypt", hasher: NewBcryptHasher(bcrypt.MinCost), prefix: "$2a$04$"},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			hashed, err := tc.hasher.Hash("correct horse")
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(hashed, tc.prefix), hashed)
+
+			require.NoError(t, CheckPassword("correct horse", hashed))
+			require.ErrorIs(t, CheckPassword("wrong horse", hashed), ErrPasswordMismatch)
+			require.False(t, tc.hasher.NeedsRehash(hashed))
+
+			again, err := tc.hasher.Hash("correct horse")
+			require.NoError(t, err)
+			require.NotEqual(t, hashed, again)
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	stronger := testArgon2idParams
+	stronger.Iterations = 2
+	old, err := NewArgon2idHasher(testArgon2idParams).Hash("correct horse")
+	require.NoError(t, err)
+
+	tcs := []struct {
+		name   string
+		hasher PasswordHasher
+		hash   string
+		rehash bool
+	}{
+		{name: "bcrypt to argon2id", hasher: NewArgon2idHasher(testArgon2idParams), hash: string(legacy), rehash: true},
+		{name: "argon2id params changed", hasher: NewArgon2idHasher(stronger), hash: old, rehash: true},
+		{name: "argon2id to bcrypt", hasher: NewBcryptHasher(bcrypt.MinCost), hash: old, rehash: true},
+		{name: "bcrypt cost changed", hasher: NewBcryptHasher(bcrypt.MinCost + 1), hash: string(legacy), rehash: true},
+		{name: "bcrypt unchanged", hasher: NewBcryptHasher(bcrypt.MinCost), hash: string(legacy)},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.rehash, tc.hasher.NeedsRehash(tc.hash))
+		})
+	}
+}
+
+func TestCheckPasswordMalformed(t *testing.T) {
+	require.ErrorIs(t, CheckPassword("pw", "plaintext"), ErrUnknownHashFormat)
+	require.ErrorIs(t, CheckPassword("pw", "$argon2id$v=19$m=1024$bad"), ErrUnknownHashFormat)
+	require.ErrorIs(t, CheckPassword("pw", "$argon2id$v=16$m=1024,t=1,p=1$c2FsdA$a2V5"), ErrUnknownHashFormat)
+}
+
+func TestBcryptRejectsLongPasswords(t *testing.T) {
+	_, err := NewBcryptHasher(bcrypt.MinCost).Hash(strings.Repeat("a", 73))
+	require.ErrorIs(t, err, bcrypt.ErrPasswordTooLong)
+}